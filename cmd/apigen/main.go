@@ -0,0 +1,354 @@
+// Command apigen generates the Go client in pkg/client from the OpenAPI spec in pkg/api.
+//
+// Run it through go generate in pkg/client after changing the spec.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/jimmitjoo/livestream-results/pkg/api"
+	"go/format"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+func main() {
+	specPath := flag.String("spec", "", "OpenAPI spec to read, the embedded spec when empty")
+	out := flag.String("out", "client_gen.go", "file to write the client to")
+	pkg := flag.String("package", "client", "package name of the generated file")
+	flag.Parse()
+
+	data := api.Spec
+	if *specPath != "" {
+		var err error
+		data, err = os.ReadFile(*specPath)
+		if err != nil {
+			log.Fatalf("Error reading spec: %v", err)
+		}
+	}
+
+	doc, err := api.Parse(data)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	source, err := generate(doc, *pkg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*out, source, 0644); err != nil {
+		log.Fatalf("Error writing client: %v", err)
+	}
+}
+
+// generator writes Go source for one spec
+type generator struct {
+	doc *api.Document
+	buf bytes.Buffer
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func generate(doc *api.Document, pkg string) ([]byte, error) {
+	g := &generator{doc: doc}
+
+	names := make([]string, 0, len(doc.Components.Schemas))
+	for name := range doc.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := g.schemaType(name, doc.Components.Schemas[name]); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, path := range doc.PathNames() {
+		for _, op := range doc.Paths[path].Operations() {
+			if err := g.operation(path, op); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	imports := []string{"context", "fmt", "net/url"}
+	if bytes.Contains(g.buf.Bytes(), []byte("time.Time")) {
+		imports = append(imports, "time")
+	}
+
+	var file bytes.Buffer
+	fmt.Fprintf(&file, "// Code generated by apigen from pkg/api/openapi.json. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&file, "package %s\n\nimport (\n", pkg)
+	for _, name := range imports {
+		fmt.Fprintf(&file, "%q\n", name)
+	}
+	fmt.Fprintf(&file, ")\n\n")
+	file.Write(g.buf.Bytes())
+
+	source, err := format.Source(file.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("error formatting generated client: %w", err)
+	}
+	return source, nil
+}
+
+// schemaType writes a named type for a schema in components
+func (g *generator) schemaType(name string, schema *api.Schema) error {
+	comment := schema.Description
+	if comment == "" {
+		comment = "is the " + name + " schema of the API"
+	}
+	g.printf("// %s %s\n", name, comment)
+
+	if schema.Type != "object" {
+		goType, err := g.goType(schema)
+		if err != nil {
+			return fmt.Errorf("error in schema %s: %w", name, err)
+		}
+		g.printf("type %s %s\n\n", name, goType)
+		return nil
+	}
+
+	required := make(map[string]bool)
+	for _, property := range schema.Required {
+		required[property] = true
+	}
+
+	properties := make([]string, 0, len(schema.Properties))
+	for property := range schema.Properties {
+		properties = append(properties, property)
+	}
+	sort.Strings(properties)
+
+	g.printf("type %s struct {\n", name)
+	for _, property := range properties {
+		goType, err := g.goType(schema.Properties[property])
+		if err != nil {
+			return fmt.Errorf("error in schema %s property %s: %w", name, property, err)
+		}
+		if description := schema.Properties[property].Description; description != "" {
+			g.printf("// %s\n", description)
+		}
+		tag := property
+		if !required[property] {
+			tag += ",omitempty"
+		}
+		g.printf("%s %s `json:%q`\n", exported(property), goType, tag)
+	}
+	g.printf("}\n\n")
+	return nil
+}
+
+// goType is the Go type for values of schema
+func (g *generator) goType(schema *api.Schema) (string, error) {
+	if schema == nil {
+		return "interface{}", nil
+	}
+	if schema.Ref != "" {
+		return api.RefName(schema.Ref), nil
+	}
+
+	var goType string
+	switch schema.Type {
+	case "":
+		return "interface{}", nil
+	case "string":
+		goType = "string"
+		if schema.Format == "date-time" {
+			goType = "time.Time"
+		}
+	case "integer":
+		goType = "int"
+		if schema.Format == "int64" {
+			goType = "int64"
+		}
+	case "number":
+		goType = "float64"
+	case "boolean":
+		goType = "bool"
+	case "array":
+		item, err := g.goType(schema.Items)
+		if err != nil {
+			return "", err
+		}
+		return "[]" + item, nil
+	case "object":
+		if schema.AdditionalProperties != nil {
+			value, err := g.goType(schema.AdditionalProperties)
+			if err != nil {
+				return "", err
+			}
+			return "map[string]" + value, nil
+		}
+		return "map[string]interface{}", nil
+	default:
+		return "", fmt.Errorf("unsupported type %s", schema.Type)
+	}
+
+	if schema.Nullable {
+		return "*" + goType, nil
+	}
+	return goType, nil
+}
+
+// operation writes a client method for one operation. Operations without a
+// 2xx response, like the browser redirects of the OAuth flow, and event
+// streams get no method.
+func (g *generator) operation(path string, op api.MethodOperation) error {
+	if op.OperationID == "" {
+		return fmt.Errorf("%s %s has no operationId", op.Method, path)
+	}
+	name := exported(op.OperationID)
+
+	status, response, ok, err := g.successResponse(op.Operation)
+	if err != nil {
+		return fmt.Errorf("error in %s %s: %w", op.Method, path, err)
+	}
+	if !ok {
+		return nil
+	}
+	if _, stream := response.Content["text/event-stream"]; stream {
+		return nil
+	}
+
+	var pathParams, queryParams []api.Parameter
+	for _, param := range g.doc.Parameters(path, op.Operation) {
+		switch param.In {
+		case "path":
+			pathParams = append(pathParams, param)
+		case "query":
+			queryParams = append(queryParams, param)
+		}
+	}
+
+	if len(queryParams) > 0 {
+		g.printf("// %sParams holds the query parameters of %s\n", name, name)
+		g.printf("type %sParams struct {\n", name)
+		for _, param := range queryParams {
+			goType, err := g.goType(param.Schema)
+			if err != nil {
+				return err
+			}
+			if !param.Required {
+				goType = "*" + goType
+			}
+			g.printf("%s %s\n", exported(param.Name), goType)
+		}
+		g.printf("}\n\n")
+	}
+
+	args := []string{"ctx context.Context"}
+	pathFormat := path
+	var pathArgs []string
+	for _, param := range pathParams {
+		goType, err := g.goType(param.Schema)
+		if err != nil {
+			return err
+		}
+		args = append(args, param.Name+" "+goType)
+		pathFormat = strings.ReplaceAll(pathFormat, "{"+param.Name+"}", "%v")
+		pathArgs = append(pathArgs, "url.PathEscape(fmt.Sprint("+param.Name+"))")
+	}
+	if len(queryParams) > 0 {
+		args = append(args, "params "+name+"Params")
+	}
+
+	bodyArg := "nil"
+	if op.RequestBody != nil {
+		if media, ok := op.RequestBody.Content["application/json"]; ok {
+			goType, err := g.goType(media.Schema)
+			if err != nil {
+				return err
+			}
+			args = append(args, "body "+goType)
+			bodyArg = "body"
+		}
+	}
+
+	resultType, outArg := "", "nil"
+	if response != nil {
+		if media, ok := response.Content["application/json"]; ok {
+			goType, err := g.goType(media.Schema)
+			if err != nil {
+				return err
+			}
+			resultType, outArg = goType, "&out"
+		} else if _, ok := response.Content["text/plain"]; ok {
+			resultType, outArg = "string", "&out"
+		}
+	}
+
+	g.printf("// %s sends %s %s: %s\n", name, op.Method, path, op.Summary)
+	if resultType != "" {
+		g.printf("func (c *Client) %s(%s) (%s, error) {\n", name, strings.Join(args, ", "), resultType)
+	} else {
+		g.printf("func (c *Client) %s(%s) error {\n", name, strings.Join(args, ", "))
+	}
+
+	queryArg := "nil"
+	if len(queryParams) > 0 {
+		queryArg = "query"
+		g.printf("query := url.Values{}\n")
+		for _, param := range queryParams {
+			field := "params." + exported(param.Name)
+			if param.Required {
+				g.printf("query.Set(%q, fmt.Sprint(%s))\n", param.Name, field)
+				continue
+			}
+			g.printf("if %s != nil {\nquery.Set(%q, fmt.Sprint(*%s))\n}\n", field, param.Name, field)
+		}
+	}
+
+	pathExpr := strconv.Quote(path)
+	if len(pathArgs) > 0 {
+		pathExpr = fmt.Sprintf("fmt.Sprintf(%q, %s)", pathFormat, strings.Join(pathArgs, ", "))
+	}
+
+	if resultType != "" {
+		g.printf("var out %s\n", resultType)
+		g.printf("err := c.do(ctx, %q, %s, %s, %s, %d, %s)\n", op.Method, pathExpr, queryArg, bodyArg, status, outArg)
+		g.printf("return out, err\n}\n\n")
+		return nil
+	}
+	g.printf("return c.do(ctx, %q, %s, %s, %s, %d, nil)\n}\n\n", op.Method, pathExpr, queryArg, bodyArg, status)
+	return nil
+}
+
+// successResponse finds the 2xx response of an operation
+func (g *generator) successResponse(op *api.Operation) (int, *api.Response, bool, error) {
+	codes := make([]string, 0, len(op.Responses))
+	for code := range op.Responses {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	for _, code := range codes {
+		if !strings.HasPrefix(code, "2") {
+			continue
+		}
+		status, err := strconv.Atoi(code)
+		if err != nil {
+			return 0, nil, false, fmt.Errorf("invalid status code %s", code)
+		}
+		response, err := g.doc.Response(op.Responses[code])
+		if err != nil {
+			return 0, nil, false, err
+		}
+		return status, &response, true, nil
+	}
+	return 0, nil, false, nil
+}
+
+// exported turns a JSON or parameter name into an exported Go identifier
+func exported(name string) string {
+	runes := []rune(name)
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jimmitjoo/livestream-results/pkg/auth"
+	"github.com/jimmitjoo/livestream-results/pkg/db"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// loginRequest is the body for logging in
+type loginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// userRequest is the body for creating or updating a user. An empty password
+// on update keeps the current one.
+type userRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+}
+
+// user validates the request and builds the user it describes
+func (req userRequest) user(requirePassword bool) (db.User, error) {
+	if strings.TrimSpace(req.Username) == "" {
+		return db.User{}, fmt.Errorf("username is required")
+	}
+	role, err := auth.ParseRole(req.Role)
+	if err != nil {
+		return db.User{}, err
+	}
+	if requirePassword && req.Password == "" {
+		return db.User{}, fmt.Errorf("password is required")
+	}
+
+	user := db.User{Username: strings.TrimSpace(req.Username), Role: string(role)}
+	if req.Password != "" {
+		if user.PasswordHash, err = auth.HashPassword(req.Password); err != nil {
+			return db.User{}, err
+		}
+	}
+	return user, nil
+}
+
+// tokenRequest is the body for creating an API token acting as a user
+type tokenRequest struct {
+	Name   string `json:"name"`
+	UserID int    `json:"userID"`
+}
+
+// loginHandler serves POST /api/login and starts a session cookie
+func loginHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("invalid request method"))
+		return
+	}
+
+	var req loginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	token, user, err := authenticator.Login(req.Username, req.Password)
+	if errors.Is(err, auth.ErrInvalidLogin) {
+		writeError(w, http.StatusUnauthorized, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	auth.SetSessionCookie(w, token)
+	writeJSON(w, http.StatusOK, user)
+}
+
+// logoutHandler serves POST /api/logout and ends the session
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("invalid request method"))
+		return
+	}
+	if err := authenticator.Logout(r); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	auth.ClearSessionCookie(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// meHandler serves GET /api/me with the logged in user
+func meHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := auth.UserFrom(r.Context())
+	writeJSON(w, http.StatusOK, user)
+}
+
+// usersHandler serves /api/users: GET lists users and POST creates one
+func usersHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		users, err := db.ListUsers(database)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, users)
+
+	case "POST":
+		var req userRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		user, err := req.user(true)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		user.UserID, err = db.CreateUser(database, user)
+		if err != nil {
+			writeError(w, statusFor(err), err)
+			return
+		}
+		user.PasswordHash = ""
+
+		w.Header().Set("Location", fmt.Sprintf("/api/users/%d", user.UserID))
+		writeJSON(w, http.StatusCreated, user)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("invalid request method"))
+	}
+}
+
+// userHandler serves /api/users/{id}: PUT updates the user and DELETE removes
+// it. Admins cannot remove their own account or their own admin role.
+func userHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/users/"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("invalid user ID"))
+		return
+	}
+	current, _ := auth.UserFrom(r.Context())
+
+	switch r.Method {
+	case "PUT":
+		var req userRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		user, err := req.user(false)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if userID == current.UserID && user.Role != string(auth.Admin) {
+			writeError(w, http.StatusConflict, fmt.Errorf("you cannot remove your own admin role"))
+			return
+		}
+		user.UserID = userID
+
+		if err := db.UpdateUser(database, user); err != nil {
+			writeError(w, statusFor(err), err)
+			return
+		}
+		user.PasswordHash = ""
+		writeJSON(w, http.StatusOK, user)
+
+	case "DELETE":
+		if userID == current.UserID {
+			writeError(w, http.StatusConflict, fmt.Errorf("you cannot delete your own account"))
+			return
+		}
+		if err := db.DeleteUser(database, userID); err != nil {
+			writeError(w, statusFor(err), err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("invalid request method"))
+	}
+}
+
+// tokensHandler serves /api/tokens: GET lists API tokens and POST creates one.
+// The token itself is only returned when it is created.
+func tokensHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		tokens, err := db.ListAPITokens(database)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, tokens)
+
+	case "POST":
+		var req tokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if strings.TrimSpace(req.Name) == "" {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("name is required"))
+			return
+		}
+		if _, err := db.GetUser(database, req.UserID); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("userID %d does not exist", req.UserID))
+			return
+		}
+
+		token, err := auth.NewToken()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		tokenID, err := db.CreateAPIToken(database, req.Name, auth.HashToken(token), req.UserID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		w.Header().Set("Location", fmt.Sprintf("/api/tokens/%d", tokenID))
+		writeJSON(w, http.StatusCreated, map[string]interface{}{
+			"tokenID": tokenID,
+			"name":    req.Name,
+			"token":   token,
+		})
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("invalid request method"))
+	}
+}
+
+// tokenHandler serves DELETE /api/tokens/{id}, which revokes the token
+func tokenHandler(w http.ResponseWriter, r *http.Request) {
+	tokenID, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/tokens/"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("invalid token ID"))
+		return
+	}
+	if r.Method != "DELETE" {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("invalid request method"))
+		return
+	}
+
+	if err := db.DeleteAPIToken(database, tokenID); err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
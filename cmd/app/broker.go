@@ -0,0 +1,27 @@
+package main
+
+import (
+	"flag"
+	"github.com/jimmitjoo/livestream-results/pkg/mqtt"
+	"log"
+)
+
+// runMQTTBroker runs a small MQTT broker and prints every message published to
+// it, to try out the MQTT publisher without a broker of one's own:
+//
+//	mqtt-broker [-listen :1883]
+func runMQTTBroker(args []string) error {
+	fs := flag.NewFlagSet("mqtt-broker", flag.ContinueOnError)
+	listen := fs.String("listen", ":1883", "address to listen on")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	broker := &mqtt.Broker{
+		OnPublish: func(topic string, payload []byte, qos byte, retained bool) {
+			log.Printf("%s (QoS %d, retained %t): %s", topic, qos, retained, payload)
+		},
+	}
+	log.Printf("MQTT broker listening at %s", *listen)
+	return broker.ListenAndServe(*listen)
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/jimmitjoo/livestream-results/pkg/config"
+	"github.com/jimmitjoo/livestream-results/pkg/db"
+	"github.com/jimmitjoo/livestream-results/pkg/parser"
+	"github.com/jimmitjoo/livestream-results/pkg/publisher"
+	"github.com/jimmitjoo/livestream-results/pkg/sheets"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// command is a subcommand of the program
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"serve":            {"serve [flags]", runServe},
+	"import-startlist": {"import-startlist [flags] -race <name> (-tab <tab> | <file.csv>)", runImportStartList},
+	"ingest":           {"ingest [flags] <timing file>", runIngest},
+	"results":          {"results [flags] [-format table|csv|json] <event ID or name, 0 for all>", runResults},
+	"export":           {"export [flags] -format csv|html|json [-event <ID>] <target>", runExport},
+	"migrate":          {"migrate [flags]", runMigrate},
+	"replay":           {"replay [-speed 10] [-rebase] [-truncate] <timing file> <target file or tcp://host:port>", runReplay},
+	"generate":         {"generate [flags] <output file>", runGenerate},
+	"webhook-receiver": {"webhook-receiver [-listen :9090] -secret <secret> [-fail 0]", runWebhookReceiver},
+	"mqtt-broker":      {"mqtt-broker [-listen :1883]", runMQTTBroker},
+}
+
+// main runs the command named by the first argument. Without one, or when the
+// first argument is a flag, the server is started as before there were commands.
+func main() {
+	args := os.Args[1:]
+	name := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	if name == "help" {
+		usage()
+		return
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(args); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [arguments]\n\nCommands:\n", os.Args[0])
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %s\n", commands[name].usage)
+	}
+	fmt.Fprintln(os.Stderr, "\nEvery command except replay, generate, webhook-receiver and mqtt-broker takes the settings' flags, e.g. -db and -config.")
+}
+
+// openDatabase loads the settings with fs's own flags and opens the database
+func openDatabase(fs *flag.FlagSet, args []string) (*sql.DB, error) {
+	var err error
+	cfg, err = config.LoadFlags(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	database, err := db.SetupDatabase(cfg.DBPath)
+	if err != nil {
+		return nil, fmt.Errorf("error setting up the database: %w", err)
+	}
+	return database, nil
+}
+
+// closeDatabase flushes and closes a database opened by a command
+func closeDatabase(database *sql.DB) {
+	if err := db.Checkpoint(database); err != nil {
+		log.Printf("Error checkpointing the database: %v", err)
+	}
+	database.Close()
+}
+
+// runImportStartList imports a start list from a Google Sheets tab of the
+// configured spreadsheet, or from a CSV file with the same columns
+func runImportStartList(args []string) error {
+	fs := flag.NewFlagSet("import-startlist", flag.ContinueOnError)
+	race := fs.String("race", "", "name of the race, classes are named after it")
+	tab := fs.String("tab", "", "tab of the spreadsheet with the start list")
+	database, err := openDatabase(fs, args)
+	if err != nil {
+		return err
+	}
+	defer closeDatabase(database)
+
+	if *race == "" {
+		return fmt.Errorf("-race is required")
+	}
+
+	var rows [][]interface{}
+	switch {
+	case *tab != "" && fs.NArg() == 0:
+		if !cfg.HasCredentials() {
+			return fmt.Errorf("no Google credentials found at %s", cfg.CredentialsPath)
+		}
+		service, err := sheets.NewSheetsService(cfg.CredentialsPath, cfg.SpreadsheetID)
+		if err != nil {
+			return fmt.Errorf("error setting up Google Sheets service: %w", err)
+		}
+		if rows, err = service.ReadSheet(*tab); err != nil {
+			return fmt.Errorf("error reading participants: %w", err)
+		}
+	case *tab == "" && fs.NArg() == 1:
+		if rows, err = readStartListCSV(fs.Arg(0)); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("give either -tab or a CSV file")
+	}
+
+	imported, err := importStartList(database, *race, rows)
+	if err != nil {
+		return err
+	}
+	log.Printf("Imported %d participants for %s, %d were already registered", imported.Imported, *race, imported.Duplicates)
+	return nil
+}
+
+// runIngest stores the reads of a timing file, skipping those already stored
+func runIngest(args []string) error {
+	fs := flag.NewFlagSet("ingest", flag.ContinueOnError)
+	database, err := openDatabase(fs, args)
+	if err != nil {
+		return err
+	}
+	defer closeDatabase(database)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("ingest needs a timing file")
+	}
+	results, err := parser.ParseTimingFile(fs.Arg(0))
+	var malformed *parser.MalformedError
+	if errors.As(err, &malformed) {
+		log.Printf("Error parsing timing data: %v", malformed)
+	} else if err != nil {
+		return fmt.Errorf("error parsing timing data: %w", err)
+	}
+	inserted, err := db.IngestTimingResults(database, results)
+	if err != nil {
+		return err
+	}
+	log.Printf("Read %d lines from %s, %d new reads stored", len(results), fs.Arg(0), inserted)
+	return nil
+}
+
+// runResults prints the ranked results of an event
+func runResults(args []string) error {
+	fs := flag.NewFlagSet("results", flag.ContinueOnError)
+	format := fs.String("format", "table", "table, csv or json")
+	database, err := openDatabase(fs, args)
+	if err != nil {
+		return err
+	}
+	defer closeDatabase(database)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("results needs an event ID or name, 0 for all events")
+	}
+	eventID, err := strconv.Atoi(fs.Arg(0))
+	if err != nil {
+		if eventID, err = db.GetEventByName(database, fs.Arg(0)); err != nil {
+			return fmt.Errorf("no event named %s", fs.Arg(0))
+		}
+	}
+
+	rows, err := db.GetResults(database, db.ResultQuery{EventID: eventID, FinishAntenna: cfg.FinishAntenna})
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "Plac\tStartnr\tNamn\tFörening\tKlass\tTid")
+		for _, row := range rows {
+			fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%s\t%s\n", row.Position, row.BibNumber, strings.TrimSpace(row.FirstName+" "+row.LastName), row.Club, row.EventName, publisher.DisplayTime(row))
+		}
+		return w.Flush()
+	case "csv", "json":
+		return writeResults(os.Stdout, *format, rows)
+	default:
+		return fmt.Errorf("unknown format %s", *format)
+	}
+}
+
+// runExport writes the ranked results to a file, or a directory for html,
+// with the same output as the publishers
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", "csv", "csv, html or json")
+	eventID := fs.Int("event", 0, "only this event")
+	database, err := openDatabase(fs, args)
+	if err != nil {
+		return err
+	}
+	defer closeDatabase(database)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("export needs a target file or directory")
+	}
+	rows, err := db.GetResults(database, db.ResultQuery{EventID: *eventID, FinishAntenna: cfg.FinishAntenna})
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "json":
+		file, err := os.Create(fs.Arg(0))
+		if err != nil {
+			return fmt.Errorf("error creating %s: %w", fs.Arg(0), err)
+		}
+		defer file.Close()
+		if err := writeResults(file, "json", rows); err != nil {
+			return err
+		}
+	case "csv", "html":
+		p, err := publisher.New(*format, fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		if err := p.Publish(context.Background(), rows); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown format %s", *format)
+	}
+	log.Printf("Exported %d results to %s", len(rows), fs.Arg(0))
+	return nil
+}
+
+// runMigrate creates missing tables and columns, then exits
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	database, err := openDatabase(fs, args)
+	if err != nil {
+		return err
+	}
+	closeDatabase(database)
+	log.Printf("Database %s is up to date", cfg.DBPath)
+	return nil
+}
+
+// writeResults writes rows as csv in the publisher's columns or as json
+func writeResults(w io.Writer, format string, rows []db.ResultRow) error {
+	if format == "csv" {
+		return publisher.WriteCSV(w, rows)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(rows)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jimmitjoo/livestream-results/pkg/db"
+	"github.com/jimmitjoo/livestream-results/pkg/publisher"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockStatus is a race clock as shown on displays. Displays add the time since
+// they fetched it to elapsedMs instead of trusting their own clock.
+type clockStatus struct {
+	EventID    int    `json:"eventID"`
+	Running    bool   `json:"running"`
+	StartedAt  string `json:"startedAt"`
+	StoppedAt  string `json:"stoppedAt,omitempty"`
+	ElapsedMs  int64  `json:"elapsedMs"`
+	Elapsed    string `json:"elapsed"`
+	ServerTime string `json:"serverTime"`
+}
+
+func newClockStatus(clock db.RaceClock) clockStatus {
+	now := db.WallClock(time.Now())
+	started, _ := time.Parse(db.TimestampLayout, clock.StartedAt)
+	elapsed := clock.Elapsed(now)
+	return clockStatus{
+		EventID:    clock.EventID,
+		Running:    clock.StoppedAt == "" && !now.Before(started),
+		StartedAt:  clock.StartedAt,
+		StoppedAt:  clock.StoppedAt,
+		ElapsedMs:  elapsed.Milliseconds(),
+		Elapsed:    publisher.FormatDuration(elapsed),
+		ServerTime: now.Format(db.TimestampLayout),
+	}
+}
+
+// clockStartRequest is the body for starting a clock. Without startedAt the
+// clock starts now.
+type clockStartRequest struct {
+	StartedAt string `json:"startedAt"`
+}
+
+// clockAdjustRequest is the body for adjusting a clock, by is a duration such
+// as "1.5s" or "-2s" added to the time on the clock
+type clockAdjustRequest struct {
+	By string `json:"by"`
+}
+
+// clocksHandler serves GET /api/clocks with the clocks of all events that have one
+func clocksHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("invalid request method"))
+		return
+	}
+
+	clocks, err := db.ListRaceClocks(database)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	statuses := make([]clockStatus, 0, len(clocks))
+	for _, clock := range clocks {
+		statuses = append(statuses, newClockStatus(clock))
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+// clockHandler serves /api/clocks/{event}: GET returns the clock, which is the
+// race's clock for a class without its own, and POST to /start, /stop and
+// /adjust operates it
+func clockHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/clocks/"), "/")
+	eventID, err := strconv.Atoi(parts[0])
+	if err != nil || len(parts) > 2 {
+		writeError(w, http.StatusNotFound, fmt.Errorf("invalid event ID"))
+		return
+	}
+
+	if len(parts) == 1 {
+		if r.Method != "GET" {
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("invalid request method"))
+			return
+		}
+		clock, err := clockFor(eventID)
+		if err != nil {
+			writeError(w, statusFor(err), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, newClockStatus(clock))
+		return
+	}
+
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("invalid request method"))
+		return
+	}
+	if _, err := db.GetEvent(database, eventID); err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+
+	now := db.WallClock(time.Now())
+	switch parts[1] {
+	case "start":
+		var req clockStartRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		startedAt := now
+		if req.StartedAt != "" {
+			if startedAt, err = time.Parse(db.TimestampLayout, req.StartedAt); err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("startedAt must be formatted as %s", db.TimestampLayout))
+				return
+			}
+		}
+		err = db.StartRaceClock(database, eventID, startedAt)
+
+	case "stop":
+		err = db.StopRaceClock(database, eventID, now)
+
+	case "adjust":
+		var req clockAdjustRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		by, parseErr := time.ParseDuration(req.By)
+		if parseErr != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("by must be a duration such as 1.5s or -2s"))
+			return
+		}
+		err = db.AdjustRaceClock(database, eventID, by)
+
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown clock operation %q", parts[1]))
+		return
+	}
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+
+	clock, err := db.GetRaceClock(database, eventID)
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	// Race times of reads may have changed
+	publishers.Notify()
+	if parts[1] == "adjust" {
+		announceCorrection(eventID, "clock adjusted")
+	} else {
+		announceStatus(clock)
+	}
+	writeJSON(w, http.StatusOK, newClockStatus(clock))
+}
+
+// clockFor returns the clock of an event, or of its race when it has none
+func clockFor(eventID int) (db.RaceClock, error) {
+	clock, err := db.GetRaceClock(database, eventID)
+	if !errors.Is(err, db.ErrNotFound) {
+		return clock, err
+	}
+
+	event, eventErr := db.GetEvent(database, eventID)
+	if eventErr != nil {
+		return db.RaceClock{}, eventErr
+	}
+	if event.ParentEventID == 0 {
+		return db.RaceClock{}, err
+	}
+	return db.GetRaceClock(database, event.ParentEventID)
+}
@@ -0,0 +1,504 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jimmitjoo/livestream-results/pkg/api"
+	"github.com/jimmitjoo/livestream-results/pkg/auth"
+	"github.com/jimmitjoo/livestream-results/pkg/client"
+	"github.com/jimmitjoo/livestream-results/pkg/config"
+	"github.com/jimmitjoo/livestream-results/pkg/db"
+	"github.com/jimmitjoo/livestream-results/pkg/live"
+	"github.com/jimmitjoo/livestream-results/pkg/overlay"
+	"github.com/jimmitjoo/livestream-results/pkg/publisher"
+	"github.com/jimmitjoo/livestream-results/pkg/watcher"
+	"github.com/jimmitjoo/livestream-results/pkg/webhook"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// uncovered are the operations the contract test does not call, with the reason
+var uncovered = map[string]string{
+	"startOAuth":        "redirects to Google",
+	"oauthCallback":     "needs a code from Google",
+	"streamLiveUpdates": "is a stream of server-sent events",
+}
+
+// contractTransport checks every response against the spec and records which
+// operations were called
+type contractTransport struct {
+	t         *testing.T
+	validator *api.Validator
+
+	mu     sync.Mutex
+	called map[string]bool
+}
+
+func (c *contractTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultTransport.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	if op, ok := c.validator.Operation(r); ok {
+		c.mu.Lock()
+		c.called[op.OperationID] = true
+		c.mu.Unlock()
+	}
+	if err := c.validator.ValidateResponse(r, resp.StatusCode, body); err != nil {
+		c.t.Errorf("%s %s: %v\n%s", r.Method, r.URL.Path, err, body)
+	}
+	return resp, nil
+}
+
+// newContractClient returns a client whose requests are checked by transport
+func newContractClient(t *testing.T, baseURL string, transport *contractTransport) *client.Client {
+	t.Helper()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := client.New(baseURL)
+	c.HTTPClient = &http.Client{Transport: transport, Jar: jar}
+	return c
+}
+
+// startContractServer sets up the server like runServe, without Google Sheets
+// and MQTT, and serves its handlers behind the spec's validation
+func startContractServer(t *testing.T) (*httptest.Server, *api.Document) {
+	t.Helper()
+	var err error
+
+	cfg = config.Default()
+	cfg.DBPath = filepath.Join(t.TempDir(), "race.db")
+	cfg.Notifications.Stub = true
+	database, err = db.SetupDatabase(cfg.DBPath)
+	if err != nil {
+		t.Fatalf("SetupDatabase: %v", err)
+	}
+	authenticator = auth.New(database)
+	if _, err := authenticator.Bootstrap("secret"); err != nil {
+		t.Fatalf("Bootstrap: %v", err)
+	}
+	webhooks = webhook.NewDispatcher(database)
+	notifier, err = newNotifier(cfg.Notifications)
+	if err != nil {
+		t.Fatalf("newNotifier: %v", err)
+	}
+	publishers = publisher.NewManager(loadResults, 0)
+	liveSite = live.New(database, cfg.FinishAntenna)
+	publishers.Add(liveSite)
+	watchers = watcher.NewManager(database, ingestFile)
+
+	overlays, err := overlay.New("")
+	if err != nil {
+		t.Fatalf("overlay.New: %v", err)
+	}
+	spec, err := api.Load()
+	if err != nil {
+		t.Fatalf("api.Load: %v", err)
+	}
+	mux := http.NewServeMux()
+	registerHandlers(mux, overlays, api.NewValidator(spec))
+	server := httptest.NewServer(mux)
+	t.Cleanup(func() {
+		server.Close()
+		watchers.Close()
+		publishers.Close()
+		webhooks.Close()
+		notifier.Close()
+		liveSite.Close()
+		database.Close()
+	})
+	return server, spec
+}
+
+// expectStatus fails the test unless err is a StatusError with code
+func expectStatus(t *testing.T, what string, err error, code int) {
+	t.Helper()
+	var statusErr *client.StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != code {
+		t.Errorf("%s: error = %v, want status %d", what, err, code)
+	}
+}
+
+func intPtr(n int) *int {
+	return &n
+}
+
+// TestAPIContract drives the real handlers through the spec's validation with
+// the generated client and checks every response against the spec's schemas
+func TestAPIContract(t *testing.T) {
+	server, spec := startContractServer(t)
+	transport := &contractTransport{t: t, validator: api.NewValidator(spec), called: make(map[string]bool)}
+	c := newContractClient(t, server.URL, transport)
+	ctx := context.Background()
+
+	// Users, sessions and tokens
+	anonymous := newContractClient(t, server.URL, transport)
+	_, err := anonymous.GetCurrentUser(ctx)
+	expectStatus(t, "GetCurrentUser without login", err, http.StatusUnauthorized)
+	_, err = anonymous.Login(ctx, client.LoginRequest{Username: "admin", Password: "wrong"})
+	expectStatus(t, "Login with a wrong password", err, http.StatusUnauthorized)
+
+	admin, err := c.Login(ctx, client.LoginRequest{Username: "admin", Password: "secret"})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if me, err := c.GetCurrentUser(ctx); err != nil || me.UserID != admin.UserID {
+		t.Errorf("GetCurrentUser = %+v, %v, want %+v", me, err, admin)
+	}
+
+	speaker, err := c.CreateUser(ctx, client.UserRequest{Username: "speaker", Password: "speaker-password", Role: "speaker"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	_, err = c.CreateUser(ctx, client.UserRequest{Username: "speaker", Password: "speaker-password", Role: "speaker"})
+	expectStatus(t, "CreateUser with a taken name", err, http.StatusConflict)
+	_, err = c.CreateUser(ctx, client.UserRequest{Username: "x", Password: "speaker-password", Role: "referee"})
+	expectStatus(t, "CreateUser with an unknown role", err, http.StatusBadRequest)
+	if _, err := c.UpdateUser(ctx, speaker.UserID, client.UserRequest{Username: "speaker", Role: "speaker"}); err != nil {
+		t.Errorf("UpdateUser: %v", err)
+	}
+	if users, err := c.ListUsers(ctx); err != nil || len(users) != 2 {
+		t.Errorf("ListUsers = %+v, %v, want 2 users", users, err)
+	}
+
+	token, err := c.CreateAPIToken(ctx, client.TokenRequest{Name: "speaker screen", UserID: speaker.UserID})
+	if err != nil {
+		t.Fatalf("CreateAPIToken: %v", err)
+	}
+	if tokens, err := c.ListAPITokens(ctx); err != nil || len(tokens) != 1 {
+		t.Errorf("ListAPITokens = %+v, %v, want 1 token", tokens, err)
+	}
+	speakerClient := newContractClient(t, server.URL, transport)
+	speakerClient.Token = token.Token
+	if me, err := speakerClient.GetCurrentUser(ctx); err != nil || me.Role != "speaker" {
+		t.Errorf("GetCurrentUser with a token = %+v, %v, want the speaker", me, err)
+	}
+	_, err = speakerClient.ListUsers(ctx)
+	expectStatus(t, "ListUsers as speaker", err, http.StatusForbidden)
+
+	// Events and participants
+	race, err := c.CreateEvent(ctx, client.EventRequest{EventName: "Mila", StartTime: "2024-05-04 10:00:00", Distance: 10000})
+	if err != nil {
+		t.Fatalf("CreateEvent: %v", err)
+	}
+	class, err := c.CreateEvent(ctx, client.EventRequest{EventName: "Mila H21", ParentEventID: race.EventID, Classification: "H21"})
+	if err != nil {
+		t.Fatalf("CreateEvent: %v", err)
+	}
+	_, err = c.CreateEvent(ctx, client.EventRequest{EventName: " "})
+	expectStatus(t, "CreateEvent without a name", err, http.StatusBadRequest)
+	_, err = c.GetEvent(ctx, 999)
+	expectStatus(t, "GetEvent of an unknown event", err, http.StatusNotFound)
+	if _, err := c.UpdateEvent(ctx, class.EventID, client.EventRequest{EventName: "Mila H21", ParentEventID: race.EventID, Classification: "H21", Distance: 10000}); err != nil {
+		t.Errorf("UpdateEvent: %v", err)
+	}
+	if events, err := c.ListEvents(ctx); err != nil || len(events) != 2 {
+		t.Errorf("ListEvents = %+v, %v, want the race and its class", events, err)
+	}
+	if event, err := c.GetEvent(ctx, race.EventID); err != nil || event.StartTime != "2024-05-04 10:00:00" {
+		t.Errorf("GetEvent = %+v, %v", event, err)
+	}
+
+	var participants []client.Participant
+	for _, bibNumber := range []int{1, 2, 3} {
+		participant, err := c.CreateParticipant(ctx, client.ParticipantRequest{
+			BibNumber: bibNumber, EventID: class.EventID, FirstName: "Löpare", LastName: string(rune('A' + bibNumber)),
+			Club: "IFK", Birthdate: "1990", Gender: "M", Phone: "+46701234567", NotifyFinish: bibNumber == 1,
+		})
+		if err != nil {
+			t.Fatalf("CreateParticipant: %v", err)
+		}
+		participants = append(participants, participant)
+	}
+	_, err = c.CreateParticipant(ctx, client.ParticipantRequest{BibNumber: 1, EventID: class.EventID, FirstName: "Löpare", LastName: "X"})
+	expectStatus(t, "CreateParticipant with a taken bib", err, http.StatusConflict)
+	_, err = c.CreateParticipant(ctx, client.ParticipantRequest{BibNumber: 4, EventID: class.EventID, FirstName: "Löpare", LastName: "X", Phone: "nej"})
+	expectStatus(t, "CreateParticipant with a bad phone number", err, http.StatusBadRequest)
+	if _, err := c.UpdateParticipant(ctx, participants[2].ParticipantID, client.ParticipantRequest{BibNumber: 3, EventID: class.EventID, FirstName: "Löpare", LastName: "C", Club: "OK Ravinen"}); err != nil {
+		t.Errorf("UpdateParticipant: %v", err)
+	}
+	if page, err := c.SearchParticipants(ctx, client.SearchParticipantsParams{Event: intPtr(class.EventID), Limit: intPtr(2)}); err != nil || page.Total != 3 || len(page.Participants) != 2 {
+		t.Errorf("SearchParticipants = %+v, %v, want 2 of 3", page, err)
+	}
+	if participant, err := speakerClient.GetParticipant(ctx, participants[0].ParticipantID); err != nil || participant.Phone != "" {
+		t.Errorf("GetParticipant as speaker = %+v, %v, want no phone", participant, err)
+	}
+	if all, err := c.ListAllParticipants(ctx); err != nil || len(all["Mila H21"]) != 3 {
+		t.Errorf("ListAllParticipants = %+v, %v, want 3 in Mila H21", all, err)
+	}
+
+	// Webhooks, posted to a receiver that accepts everything
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+	hook, err := c.CreateWebhook(ctx, client.WebhookRequest{Url: receiver.URL, Active: true, Types: []string{"finish"}})
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+	_, err = c.CreateWebhook(ctx, client.WebhookRequest{Url: receiver.URL, Types: []string{"lap"}})
+	expectStatus(t, "CreateWebhook with an unknown type", err, http.StatusBadRequest)
+	if hook.Secret == "" {
+		t.Error("CreateWebhook did not return the secret")
+	}
+	if _, err := c.UpdateWebhook(ctx, hook.WebhookID, client.WebhookRequest{Url: receiver.URL, Active: true}); err != nil {
+		t.Errorf("UpdateWebhook: %v", err)
+	}
+	// Only the answer to creating a webhook shows its secret
+	for _, path := range []string{"/api/webhooks", fmt.Sprintf("/api/webhooks/%d", hook.WebhookID)} {
+		resp, err := c.HTTPClient.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil || resp.StatusCode != http.StatusOK || strings.Contains(string(body), hook.Secret) || strings.Contains(string(body), "ecret") {
+			t.Errorf("GET %s answered %d with the secret: %s", path, resp.StatusCode, body)
+		}
+	}
+	if _, err := c.GetWebhook(ctx, hook.WebhookID); err != nil {
+		t.Errorf("GetWebhook: %v", err)
+	}
+	if _, err := c.TestWebhook(ctx, hook.WebhookID); err != nil {
+		t.Errorf("TestWebhook: %v", err)
+	}
+	if hooks, err := c.ListWebhooks(ctx); err != nil || len(hooks) != 1 {
+		t.Errorf("ListWebhooks = %+v, %v, want 1", hooks, err)
+	}
+
+	// Publishers and watchers, with a tie at the finish between bib 1 and 2
+	csvPath := filepath.Join(t.TempDir(), "results.csv")
+	if _, err := c.AddPublisher(ctx, client.PublisherRequest{Type: "csv", Target: csvPath}); err != nil {
+		t.Errorf("AddPublisher: %v", err)
+	}
+	_, err = c.AddPublisher(ctx, client.PublisherRequest{Type: "fax", Target: csvPath})
+	expectStatus(t, "AddPublisher of an unknown type", err, http.StatusBadRequest)
+	if names, err := c.ListPublishers(ctx); err != nil || len(names) != 2 {
+		t.Errorf("ListPublishers = %v, %v, want the live site and the CSV file", names, err)
+	}
+
+	timingPath := filepath.Join(t.TempDir(), "timing.txt")
+	reads := "1\t2024-05-04 10:35:00.000\t2\t1\n2\t2024-05-04 10:35:00.000\t2\t1\n3\t2024-05-04 10:40:00.500\t2\t1\n"
+	if err := os.WriteFile(timingPath, []byte(reads), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.StartWatch(ctx, client.WatchRequest{FilePath: timingPath}); err != nil {
+		t.Fatalf("StartWatch: %v", err)
+	}
+	waitFor(t, "the results", 10*time.Second, func() bool {
+		classes, err := c.ListLiveClasses(ctx)
+		return err == nil && len(classes) > 0 && classes[len(classes)-1].Finishers == 3
+	})
+	if watchers, err := c.ListWatchers(ctx); err != nil || len(watchers) != 1 || watchers[0].Lines != 3 {
+		t.Errorf("ListWatchers = %+v, %v, want 3 lines read", watchers, err)
+	}
+	if _, err := c.RestartWatch(ctx, client.WatchRequest{FilePath: timingPath}); err != nil {
+		t.Errorf("RestartWatch: %v", err)
+	}
+	if _, err := c.StopWatch(ctx, client.WatchRequest{FilePath: timingPath}); err != nil {
+		t.Errorf("StopWatch: %v", err)
+	}
+	_, err = c.StopWatch(ctx, client.WatchRequest{FilePath: "/no/such/file"})
+	expectStatus(t, "StopWatch of a file that is not watched", err, http.StatusNotFound)
+	if _, err := c.GetPublishStatus(ctx); err != nil {
+		t.Errorf("GetPublishStatus: %v", err)
+	}
+
+	// Results
+	results, err := anonymous.ListResults(ctx, client.ListResultsParams{Event: intPtr(class.EventID)})
+	if err != nil || len(results) != 3 || results[1].Position != 1 || results[2].RaceTimeMs == nil {
+		t.Fatalf("ListResults = %+v, %v, want bib 1 and 2 tied first", results, err)
+	}
+	_, err = anonymous.ListResults(ctx, client.ListResultsParams{Limit: intPtr(-1)})
+	expectStatus(t, "ListResults with a negative limit", err, http.StatusBadRequest)
+	if _, err := speakerClient.GetSpeakerBoard(ctx, client.GetSpeakerBoardParams{Minutes: intPtr(60)}); err != nil {
+		t.Errorf("GetSpeakerBoard: %v", err)
+	}
+
+	ties, err := speakerClient.ListTies(ctx)
+	if err != nil || len(ties) != 1 {
+		t.Fatalf("ListTies = %+v, %v, want the tie of bib 1 and 2", ties, err)
+	}
+	order := []client.TieEntry{{BibNumber: 2, EventID: class.EventID}, {BibNumber: 1, EventID: class.EventID}}
+	_, err = speakerClient.ResolveTie(ctx, client.TieRequest{Timestamp: ties[0].Timestamp, Order: order})
+	expectStatus(t, "ResolveTie as speaker", err, http.StatusForbidden)
+	if tie, err := c.ResolveTie(ctx, client.TieRequest{Timestamp: ties[0].Timestamp, Order: order}); err != nil || !tie.Resolved {
+		t.Errorf("ResolveTie = %+v, %v", tie, err)
+	}
+	if err := c.ClearTie(ctx, client.ClearTieParams{Timestamp: ties[0].Timestamp}); err != nil {
+		t.Errorf("ClearTie: %v", err)
+	}
+	err = c.ClearTie(ctx, client.ClearTieParams{Timestamp: "2024-05-04 11:00:00.000"})
+	expectStatus(t, "ClearTie without a tie", err, http.StatusNotFound)
+
+	// The public site
+	waitFor(t, "the public site", 10*time.Second, func() bool {
+		entries, err := anonymous.GetLiveClassResults(ctx, class.EventID)
+		return err == nil && len(entries) == 3
+	})
+	if athlete, err := anonymous.GetLiveAthlete(ctx, class.EventID, 3); err != nil || athlete.Position != 3 {
+		t.Errorf("GetLiveAthlete = %+v, %v", athlete, err)
+	}
+	_, err = anonymous.GetLiveAthlete(ctx, class.EventID, 99)
+	expectStatus(t, "GetLiveAthlete of an unknown bib", err, http.StatusNotFound)
+	if latest, err := anonymous.ListLatestFinishers(ctx, client.ListLatestFinishersParams{Event: intPtr(class.EventID)}); err != nil || len(latest) != 3 {
+		t.Errorf("ListLatestFinishers = %+v, %v", latest, err)
+	}
+	q := "Ravinen"
+	if found, err := anonymous.SearchLive(ctx, client.SearchLiveParams{Q: &q}); err != nil || len(found) != 1 {
+		t.Errorf("SearchLive = %+v, %v, want bib 3", found, err)
+	}
+
+	// Notifications and webhook deliveries of the finishes
+	waitFor(t, "the finish notification", 10*time.Second, func() bool {
+		sent, err := c.ListParticipantNotifications(ctx, participants[0].ParticipantID)
+		return err == nil && len(sent) == 1 && sent[0].Status == "sent"
+	})
+	_, err = speakerClient.ListParticipantNotifications(ctx, participants[0].ParticipantID)
+	expectStatus(t, "ListParticipantNotifications as speaker", err, http.StatusForbidden)
+	waitFor(t, "the webhook deliveries", 10*time.Second, func() bool {
+		deliveries, err := c.ListWebhookDeliveries(ctx, hook.WebhookID, client.ListWebhookDeliveriesParams{Limit: intPtr(10)})
+		return err == nil && len(deliveries) > 1 && deliveries[0].Status == "delivered"
+	})
+
+	// Race clocks
+	if _, err := c.StartClock(ctx, race.EventID, client.ClockStartRequest{StartedAt: "2024-05-04 10:00:00.000"}); err != nil {
+		t.Errorf("StartClock: %v", err)
+	}
+	_, err = c.StartClock(ctx, race.EventID, client.ClockStartRequest{StartedAt: "klockan tio"})
+	expectStatus(t, "StartClock with a bad time", err, http.StatusBadRequest)
+	if _, err := c.AdjustClock(ctx, race.EventID, client.ClockAdjustRequest{By: "-1.5s"}); err != nil {
+		t.Errorf("AdjustClock: %v", err)
+	}
+	if clock, err := c.StopClock(ctx, race.EventID); err != nil || clock.Running {
+		t.Errorf("StopClock = %+v, %v", clock, err)
+	}
+	_, err = c.StopClock(ctx, class.EventID)
+	expectStatus(t, "StopClock of a clock that never started", err, http.StatusNotFound)
+	if clock, err := anonymous.GetClock(ctx, race.EventID); err != nil || clock.StartedAt == "" {
+		t.Errorf("GetClock = %+v, %v", clock, err)
+	}
+	if clocks, err := anonymous.ListClocks(ctx); err != nil || len(clocks) != 1 {
+		t.Errorf("ListClocks = %+v, %v", clocks, err)
+	}
+
+	// Google Sheets is not set up
+	if status, err := c.GetOAuthStatus(ctx, client.GetOAuthStatusParams{}); err != nil || status.Available {
+		t.Errorf("GetOAuthStatus = %+v, %v, want unavailable", status, err)
+	}
+	_, err = c.SetGoogleSheet(ctx, client.GoogleSheetRequest{SheetID: "sheet"})
+	expectStatus(t, "SetGoogleSheet without credentials", err, http.StatusServiceUnavailable)
+	_, err = c.ImportStartList(ctx, client.StartListRequest{PrimaryEventName: "Mila", ParticipantsSheetName: "Startlista"})
+	expectStatus(t, "ImportStartList without credentials", err, http.StatusServiceUnavailable)
+
+	// Clean up through the API
+	cascade := false
+	err = c.DeleteEvent(ctx, race.EventID, client.DeleteEventParams{Cascade: &cascade})
+	expectStatus(t, "DeleteEvent with participants", err, http.StatusConflict)
+	if err := c.DeleteParticipant(ctx, participants[2].ParticipantID); err != nil {
+		t.Errorf("DeleteParticipant: %v", err)
+	}
+	if err := c.DeleteWebhook(ctx, hook.WebhookID); err != nil {
+		t.Errorf("DeleteWebhook: %v", err)
+	}
+	cascade = true
+	if err := c.DeleteEvent(ctx, race.EventID, client.DeleteEventParams{Cascade: &cascade}); err != nil {
+		t.Errorf("DeleteEvent: %v", err)
+	}
+	if err := c.DeleteAPIToken(ctx, token.TokenID); err != nil {
+		t.Errorf("DeleteAPIToken: %v", err)
+	}
+	if err := c.DeleteUser(ctx, speaker.UserID); err != nil {
+		t.Errorf("DeleteUser: %v", err)
+	}
+	err = c.DeleteUser(ctx, admin.UserID)
+	expectStatus(t, "DeleteUser of oneself", err, http.StatusConflict)
+	if err := c.Logout(ctx); err != nil {
+		t.Errorf("Logout: %v", err)
+	}
+
+	var missing []string
+	for _, path := range spec.PathNames() {
+		for _, op := range spec.Paths[path].Operations() {
+			if !transport.called[op.OperationID] && uncovered[op.OperationID] == "" {
+				missing = append(missing, op.OperationID)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		t.Errorf("operations not covered by the contract test: %v", missing)
+	}
+}
+
+// TestValidationAfterAuthentication checks that requests are authenticated
+// before their body is validated, and that bodies over the limit are refused
+// instead of cut short
+func TestValidationAfterAuthentication(t *testing.T) {
+	server, _ := startContractServer(t)
+
+	login, err := http.Post(server.URL+"/api/login", "application/json", strings.NewReader(`{"username":"admin","password":"secret"}`))
+	if err != nil {
+		t.Fatalf("logging in: %v", err)
+	}
+	login.Body.Close()
+	var session *http.Cookie
+	for _, cookie := range login.Cookies() {
+		if cookie.Name == auth.SessionCookie {
+			session = cookie
+		}
+	}
+	if session == nil {
+		t.Fatalf("login answered %s without a session", login.Status)
+	}
+
+	invalid := `{"username":5}`
+	large := `{"username":"admin2","password":"` + strings.Repeat("a", 2<<20) + `","role":"speaker"}`
+	tests := []struct {
+		name   string
+		signed bool
+		body   string
+		want   int
+	}{
+		{"invalid without login", false, invalid, http.StatusUnauthorized},
+		{"large without login", false, large, http.StatusUnauthorized},
+		{"invalid", true, invalid, http.StatusBadRequest},
+		{"large", true, large, http.StatusRequestEntityTooLarge},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/api/users", strings.NewReader(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if test.signed {
+			req.AddCookie(session)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.want {
+			t.Errorf("%s: status = %d, want %d", test.name, resp.StatusCode, test.want)
+		}
+	}
+}
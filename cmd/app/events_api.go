@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jimmitjoo/livestream-results/pkg/db"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// eventRequest is the body for creating or updating an event
+type eventRequest struct {
+	EventName      string `json:"eventName"`
+	ParentEventID  int    `json:"parentEventID"`
+	Classification string `json:"classification"`
+	StartTime      string `json:"startTime"`
+	Distance       int    `json:"distance"`
+}
+
+func (req eventRequest) validate() error {
+	if strings.TrimSpace(req.EventName) == "" {
+		return fmt.Errorf("eventName is required")
+	}
+	if req.StartTime != "" {
+		if _, err := time.ParseInLocation(db.StartTimeLayout, req.StartTime, time.Local); err != nil {
+			return fmt.Errorf("startTime must be formatted as %s", db.StartTimeLayout)
+		}
+	}
+	if req.Distance < 0 {
+		return fmt.Errorf("distance must not be negative")
+	}
+	return nil
+}
+
+// eventsHandler serves /api/events: GET lists all events and POST creates one
+func eventsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		events, err := db.ListEvents(database)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, events)
+
+	case "POST":
+		var req eventRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := req.validate(); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if req.ParentEventID != 0 {
+			if _, err := db.GetEvent(database, req.ParentEventID); err != nil {
+				writeError(w, statusFor(err), err)
+				return
+			}
+		}
+
+		eventID, err := db.InsertEvent(database, db.Event{
+			EventName:      req.EventName,
+			ParentEventID:  req.ParentEventID,
+			Classification: req.Classification,
+			StartTime:      req.StartTime,
+			Distance:       req.Distance,
+		})
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		event, err := db.GetEvent(database, eventID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.Header().Set("Location", fmt.Sprintf("/api/events/%d", eventID))
+		writeJSON(w, http.StatusCreated, event)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("invalid request method"))
+	}
+}
+
+// eventHandler serves /api/events/{id}: GET returns the event with its classes,
+// PUT updates it and DELETE removes it. Deleting an event with classes,
+// participants, results or webhooks requires ?cascade=true.
+func eventHandler(w http.ResponseWriter, r *http.Request) {
+	eventID, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/events/"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("invalid event ID"))
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		event, err := db.GetEvent(database, eventID)
+		if err != nil {
+			writeError(w, statusFor(err), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, event)
+
+	case "PUT":
+		var req eventRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := req.validate(); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		err := db.UpdateEvent(database, db.Event{
+			EventID:        eventID,
+			EventName:      req.EventName,
+			Classification: req.Classification,
+			StartTime:      req.StartTime,
+			Distance:       req.Distance,
+		})
+		if err != nil {
+			writeError(w, statusFor(err), err)
+			return
+		}
+
+		event, err := db.GetEvent(database, eventID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		publishers.Notify()
+		announceCorrection(eventID, "event updated")
+		writeJSON(w, http.StatusOK, event)
+
+	case "DELETE":
+		cascade := r.URL.Query().Get("cascade") == "true"
+		if err := db.DeleteEvent(database, eventID, cascade); err != nil {
+			if errors.Is(err, db.ErrHasDependents) {
+				err = fmt.Errorf("event %d has classes, participants, results or webhooks, use ?cascade=true to delete them too", eventID)
+				writeError(w, http.StatusConflict, err)
+				return
+			}
+			writeError(w, statusFor(err), err)
+			return
+		}
+		publishers.Notify()
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("invalid request method"))
+	}
+}
+
+// statusFor maps errors from the db package to HTTP status codes
+func statusFor(err error) int {
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, db.ErrHasDependents), errors.Is(err, db.ErrDuplicate):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -1,59 +1,270 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/fsnotify/fsnotify"
+	"github.com/jimmitjoo/livestream-results/pkg/api"
+	"github.com/jimmitjoo/livestream-results/pkg/auth"
+	"github.com/jimmitjoo/livestream-results/pkg/config"
 	"github.com/jimmitjoo/livestream-results/pkg/db"
+	"github.com/jimmitjoo/livestream-results/pkg/live"
+	"github.com/jimmitjoo/livestream-results/pkg/mqtt"
+	"github.com/jimmitjoo/livestream-results/pkg/notify"
+	"github.com/jimmitjoo/livestream-results/pkg/overlay"
 	"github.com/jimmitjoo/livestream-results/pkg/parser"
+	"github.com/jimmitjoo/livestream-results/pkg/publisher"
 	"github.com/jimmitjoo/livestream-results/pkg/sheets"
+	"github.com/jimmitjoo/livestream-results/pkg/watcher"
+	"github.com/jimmitjoo/livestream-results/pkg/webhook"
 	_ "github.com/mattn/go-sqlite3"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 )
 
+// shutdownTimeout is how long running HTTP requests get to finish on shutdown
+const shutdownTimeout = 10 * time.Second
+
+var cfg config.Config
 var database *sql.DB
-var watcher *fsnotify.Watcher
+var watchers *watcher.Manager
 var sheetsService *sheets.SheetsService
-var sheetName string
-
-func main() {
+var serviceAccountSheets *sheets.SheetsService
+var oauthFlow *sheets.OAuthFlow
+var sheetsPublisher *publisher.SheetsPublisher
+var publishers *publisher.Manager
+var authenticator *auth.Authenticator
+var liveSite *live.Site
+var webhooks *webhook.Dispatcher
+var mqttSink *mqtt.Sink
+var notifier *notify.Notifier
+
+// runServe starts the web server, ingesting watched files and publishing results
+// until it is interrupted
+func runServe(args []string) error {
 	var err error
 
+	cfg, err = config.Load(args)
+	if err != nil {
+		return fmt.Errorf("error loading configuration: %w", err)
+	}
+
 	// Set up the database
-	database, err = db.SetupDatabase()
+	database, err = db.SetupDatabase(cfg.DBPath)
+	if err != nil {
+		return fmt.Errorf("error setting up the database: %w", err)
+	}
+
+	// Create the first admin account on a new database
+	authenticator = auth.New(database)
+	password, err := authenticator.Bootstrap(cfg.AdminPassword)
+	if err != nil {
+		return fmt.Errorf("error creating the admin user: %w", err)
+	}
+	if password != "" && cfg.AdminPassword == "" {
+		log.Printf("Created user admin with password %s, change it after logging in", password)
+	}
+
+	// Webhooks are delivered in the background, starting with those pending from the last run
+	webhooks = webhook.NewDispatcher(database)
+
+	// Finish notifications to participants are sent in the background like webhooks
+	notifier, err = newNotifier(cfg.Notifications)
 	if err != nil {
-		log.Fatalf("Error setting up the database: %v", err)
+		return fmt.Errorf("error setting up notifications: %w", err)
+	}
+	if notifier != nil {
+		for channel, provider := range notifier.Providers() {
+			log.Printf("Sending %s finish notifications with %s", channel, provider)
+		}
+	}
+
+	// Set up result publishers, each running independently of ingestion
+	publishers = publisher.NewManager(loadResults, cfg.Publish.Interval.Duration)
+
+	// Set up Google Sheets service, without credentials we run without Sheets
+	if cfg.HasCredentials() {
+		serviceAccountSheets, err = sheets.NewSheetsService(cfg.CredentialsPath, cfg.SpreadsheetID)
+		if err != nil {
+			return fmt.Errorf("error setting up Google Sheets service: %w", err)
+		}
+		useSheetsService(serviceAccountSheets)
+	} else {
+		log.Printf("No Google credentials found at %s, running without Google Sheets", cfg.CredentialsPath)
+	}
+
+	// Set up the OAuth flow so organisers can connect their own Google account
+	if cfg.HasOAuthClient() {
+		oauthFlow, err = sheets.NewOAuthFlow(cfg.OAuthClientPath, cfg.TokenDir)
+		if err != nil {
+			return fmt.Errorf("error setting up Google OAuth: %w", err)
+		}
+	}
+
+	for _, publisherConfig := range cfg.Publishers {
+		p, err := publisher.New(publisherConfig.Type, publisherConfig.Target)
+		if err != nil {
+			return fmt.Errorf("error setting up publisher: %w", err)
+		}
+		publishers.Add(p)
 	}
-	defer database.Close()
 
-	// Initialize file watcher
-	watcher, err = fsnotify.NewWatcher()
+	// Publish reads, passages and leaderboards to an MQTT broker when one is configured
+	if cfg.MQTT.Broker != "" {
+		mqttSink, err = mqtt.New(mqtt.Options{
+			Broker:   cfg.MQTT.Broker,
+			ClientID: cfg.MQTT.ClientID,
+			Username: cfg.MQTT.Username,
+			Password: cfg.MQTT.Password,
+			QoS:      byte(cfg.MQTT.QoS),
+			Topics:   mqtt.Topics(cfg.MQTT.Topics),
+		})
+		if err != nil {
+			return fmt.Errorf("error setting up MQTT: %w", err)
+		}
+		publishers.Add(mqttSink)
+	}
+
+	// The public results site is rebuilt like any other publisher, filled once at startup
+	liveSite = live.New(database, cfg.FinishAntenna)
+	publishers.Add(liveSite)
+	publishers.Notify()
+
+	// Start watching timing files, both those from the last run and configured ones
+	watchers = watcher.NewManager(database, ingestFile)
+	if err := watchers.Resume(); err != nil {
+		log.Printf("Error resuming watched files: %v", err)
+	}
+	for _, filePath := range cfg.WatchFiles {
+		if err := watchers.Start(filePath); err != nil {
+			log.Printf("Error watching %s: %v", filePath, err)
+		}
+	}
+
+	// Overlays for streaming software, built-in templates unless overlayDir replaces them
+	overlays, err := overlay.New(cfg.OverlayDir)
 	if err != nil {
-		log.Fatalf("Error creating file watcher: %v", err)
+		return fmt.Errorf("error loading overlays: %w", err)
 	}
-	defer watcher.Close()
 
-	// Set up Google Sheets service
-	sheetsService, err = sheets.NewSheetsService("credentials.json", "1bRygOoC50s3AZT8lfUpZl2EvWGHfEpEyh-_X-9r6xAc")
+	// Requests are validated against the OpenAPI spec before reaching the handlers
+	spec, err := api.Load()
 	if err != nil {
-		log.Fatalf("Error setting up Google Sheets service: %v", err)
+		return fmt.Errorf("error loading API spec: %w", err)
 	}
 
 	// Set up HTTP handlers
-	http.HandleFunc("/start-watch", startWatchHandler)
-	http.HandleFunc("/google-sheets", googleSheetsHandler)
-	http.HandleFunc("/read-startlista", readParticipantsHandler)
-	http.HandleFunc("/list-participants", listParticipantsHandler)
+	mux := http.NewServeMux()
+	registerHandlers(mux, overlays, api.NewValidator(spec))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server := &http.Server{Addr: cfg.ListenAddr, Handler: mux}
+	server.RegisterOnShutdown(liveSite.Close)
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+	log.Printf("Server started at %s", cfg.ListenAddr)
+
+	select {
+	case err := <-serverErr:
+		log.Printf("Error running server: %v", err)
+	case <-ctx.Done():
+		log.Println("Shutting down")
+	}
+
+	shutdown(server)
+	return nil
+}
+
+// registerHandlers sets up the HTTP handlers on mux.
+// Speakers may read, operators run the timing and admins configure the race.
+// Requests are validated against the spec after authentication, so a request
+// without the role is refused before its parameters are looked at.
+func registerHandlers(mux *http.ServeMux, overlays *overlay.Handler, validator *api.Validator) {
+	validate := validator.Validate
+	mux.HandleFunc("/start-watch", authenticator.Require(auth.Operator, validate(startWatchHandler)))
+	mux.HandleFunc("/watchers", authenticator.Require(auth.Speaker, validate(listWatchersHandler)))
+	mux.HandleFunc("/watchers/stop", authenticator.Require(auth.Operator, validate(stopWatchHandler)))
+	mux.HandleFunc("/watchers/restart", authenticator.Require(auth.Operator, validate(restartWatchHandler)))
+	mux.HandleFunc("/google-sheets", authenticator.Require(auth.Admin, validate(googleSheetsHandler)))
+	mux.HandleFunc("/oauth/start", authenticator.Require(auth.Admin, validate(oauthStartHandler)))
+	mux.HandleFunc("/oauth/callback", authenticator.Require(auth.Admin, validate(oauthCallbackHandler)))
+	mux.HandleFunc("/oauth/status", authenticator.Require(auth.Speaker, validate(oauthStatusHandler)))
+	mux.HandleFunc("/read-startlista", authenticator.Require(auth.Admin, validate(readParticipantsHandler)))
+	mux.HandleFunc("/list-participants", authenticator.Require(auth.Speaker, validate(listParticipantsHandler)))
+	mux.HandleFunc("/publishers", authenticator.RequireMethods(auth.Speaker, auth.Operator, validate(publishersHandler)))
+	mux.HandleFunc("/publish-status", authenticator.Require(auth.Speaker, validate(publishStatusHandler)))
+	mux.HandleFunc("/api/results", validate(resultsHandler))
+	mux.HandleFunc("/api/clocks", validate(clocksHandler))
+	mux.HandleFunc("/api/clocks/", authenticator.RequireWrites(auth.Operator, validate(clockHandler)))
+	mux.HandleFunc("/api/speaker", authenticator.Require(auth.Speaker, validate(speakerHandler)))
+	mux.Handle("/api/live/", validator.Middleware(liveSite))
+	mux.Handle("/overlay/", overlays)
+	mux.HandleFunc("/api/events", authenticator.RequireMethods(auth.Speaker, auth.Admin, validate(eventsHandler)))
+	mux.HandleFunc("/api/events/", authenticator.RequireMethods(auth.Speaker, auth.Admin, validate(eventHandler)))
+	mux.HandleFunc("/api/participants", authenticator.RequireMethods(auth.Speaker, auth.Operator, validate(participantsHandler)))
+	mux.HandleFunc("/api/participants/", authenticator.RequireMethods(auth.Speaker, auth.Operator, validate(participantHandler)))
+	mux.HandleFunc("/api/ties", authenticator.RequireMethods(auth.Speaker, auth.Operator, validate(tiesHandler)))
+	mux.HandleFunc("/api/login", validate(loginHandler))
+	mux.HandleFunc("/api/logout", validate(logoutHandler))
+	mux.HandleFunc("/api/me", authenticator.Require(auth.Speaker, validate(meHandler)))
+	mux.HandleFunc("/api/users", authenticator.Require(auth.Admin, validate(usersHandler)))
+	mux.HandleFunc("/api/users/", authenticator.Require(auth.Admin, validate(userHandler)))
+	mux.HandleFunc("/api/tokens", authenticator.Require(auth.Admin, validate(tokensHandler)))
+	mux.HandleFunc("/api/tokens/", authenticator.Require(auth.Admin, validate(tokenHandler)))
+	mux.HandleFunc("/api/webhooks", authenticator.Require(auth.Admin, validate(webhooksHandler)))
+	mux.HandleFunc("/api/webhooks/", authenticator.Require(auth.Admin, validate(webhookHandler)))
+	mux.HandleFunc("/api/openapi.json", api.SpecHandler)
+	mux.HandleFunc("/api/docs", api.DocsHandler)
 
 	// Serve static files from the frontend directory
 	fs := http.FileServer(http.Dir("./frontend"))
-	http.Handle("/", fs)
+	mux.Handle("/", fs)
+}
+
+// shutdown stops the server in an order that loses no data: no new requests,
+// then finish ingesting, then push pending results, then flush the database
+func shutdown(server *http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("Error shutting down server: %v", err)
+	}
+
+	// Waits for file reads that are being ingested to finish
+	watchers.Close()
+
+	// Gives every publisher a last chance to push pending changes
+	publishers.Close()
+
+	// Webhooks and notifications still pending are sent after the next start
+	webhooks.Close()
+	if notifier != nil {
+		notifier.Close()
+	}
+
+	if mqttSink != nil {
+		mqttSink.Close()
+	}
+
+	if err := db.Checkpoint(database); err != nil {
+		log.Printf("Error checkpointing the database: %v", err)
+	}
+	if err := database.Close(); err != nil {
+		log.Printf("Error closing the database: %v", err)
+	}
 
-	log.Println("Server started at :8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	log.Println("Shutdown complete")
 }
 
 func startWatchHandler(w http.ResponseWriter, r *http.Request) {
@@ -76,164 +287,252 @@ func startWatchHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Start watching the specified file
-	go watchFile(requestData.FilePath)
+	if err := watchers.Start(requestData.FilePath); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// A missing file is not an error, reader software often creates it at the first read
+	if _, err := os.Stat(requestData.FilePath); err != nil {
+		fmt.Fprintf(w, "Could not open %s yet (%v), it will be read as soon as it appears", requestData.FilePath, err)
+		return
+	}
 
 	fmt.Fprintf(w, "Started watching file: %s", requestData.FilePath)
 }
 
-func googleSheetsHandler(w http.ResponseWriter, r *http.Request) {
+func listWatchersHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(watchers.List())
+}
+
+func stopWatchHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
 		return
 	}
 
 	var requestData struct {
-		SheetID   string `json:"sheetID"`
-		SheetName string `json:"sheetName"`
+		FilePath string `json:"filePath"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	sheetsService.SheetID = requestData.SheetID
-	sheetName = requestData.SheetName
+	if err := watchers.Stop(requestData.FilePath); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
 
-	fmt.Fprintf(w, "Google Sheets ID: %s, Sheet Name: %s", requestData.SheetID, requestData.SheetName)
+	fmt.Fprintf(w, "Stopped watching file: %s", requestData.FilePath)
 }
 
-func readParticipantsHandler(w http.ResponseWriter, r *http.Request) {
+func restartWatchHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
 		return
 	}
 
 	var requestData struct {
-		PrimaryEventName      string `json:"primaryEventName"`
-		ParticipantsSheetName string `json:"participantsSheetName"`
+		FilePath string `json:"filePath"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	fmt.Println("Event Name:", requestData.PrimaryEventName)
-	fmt.Println("Sheet Name:", requestData.ParticipantsSheetName)
+	if err := watchers.Restart(requestData.FilePath); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
 
-	data, err := sheetsService.ReadSheet(requestData.ParticipantsSheetName)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error reading participants: %v", err), http.StatusInternalServerError)
+	fmt.Fprintf(w, "Restarted watching file: %s", requestData.FilePath)
+}
+
+func googleSheetsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
 		return
 	}
 
-	primaryEventID, err := db.GetEventByName(database, requestData.PrimaryEventName)
-	if err != nil {
-		primaryEventID, err = db.CreateEvent(database, requestData.PrimaryEventName, 0, "")
+	var requestData struct {
+		SheetID   string `json:"sheetID"`
+		SheetName string `json:"sheetName"`
+		Auth      string `json:"auth"`
+		EventName string `json:"eventName"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if requestData.Auth == "oauth" {
+		if oauthFlow == nil {
+			http.Error(w, "Google account login is not configured", http.StatusServiceUnavailable)
+			return
+		}
+		service, err := oauthFlow.NewService(requestData.EventName, requestData.SheetID)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Error creating primary event: %v", err), http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		useSheetsService(service)
+	} else {
+		if serviceAccountSheets == nil {
+			http.Error(w, "Google Sheets is not configured", http.StatusServiceUnavailable)
+			return
+		}
+		serviceAccountSheets.SheetID = requestData.SheetID
+		useSheetsService(serviceAccountSheets)
 	}
 
-	// Loop through the data and log
-	for _, row := range data {
-		if len(row) < 1 {
-			fmt.Println("Row is empty")
-			continue
-		}
-		var bibNumber int
-		// check if row[0] interface value is a number
-		// if not, skip the row
-		if _, ok := row[0].(float64); !ok {
-
-			// Try to convert the value to an int
-			if _, err := strconv.Atoi(row[0].(string)); err != nil {
-				fmt.Println("Row does not have a valid bib number: ", row[0])
-				continue
-			}
-
-			bibNumber, err = strconv.Atoi(row[0].(string)) // Convert the value to an int
-			if err != nil {
-				fmt.Println("Error converting bib number to int: ", err)
-				continue
-			}
-			fmt.Println("Bib Number:", bibNumber)
-		}
+	sheetsPublisher.SetSheetName(requestData.SheetName)
 
-		// if row[9] does not exist, skip the row
-		if len(row) < 8 {
-			fmt.Println("Row does not have enough columns")
-			continue
-		}
+	fmt.Fprintf(w, "Google Sheets ID: %s, Sheet Name: %s", requestData.SheetID, requestData.SheetName)
+}
 
-		// Get the first name from the row
-		firstName := row[1].(string)
-		fmt.Println("First Name:", firstName)
+// useSheetsService makes service the one used for reading start lists and publishing results
+func useSheetsService(service *sheets.SheetsService) {
+	sheetsService = service
+	if sheetsPublisher == nil {
+		sheetsPublisher = publisher.NewSheetsPublisher(service, cfg.SheetName)
+		publishers.Add(sheetsPublisher)
+		return
+	}
+	sheetsPublisher.SetService(service)
+}
 
-		// Get the last name from the row
-		lastName := row[2].(string)
-		fmt.Println("Last Name:", lastName)
+// oauthRedirectURL is where Google sends the user after the consent page
+func oauthRedirectURL(r *http.Request) string {
+	return "http://" + r.Host + "/oauth/callback"
+}
 
-		// Get the birthdate from the row
-		birthdate := row[3].(string)
-		fmt.Println("Birthdate:", birthdate)
+func oauthStartHandler(w http.ResponseWriter, r *http.Request) {
+	if oauthFlow == nil {
+		http.Error(w, "Google account login is not configured", http.StatusServiceUnavailable)
+		return
+	}
 
-		// Get the club from the row
-		club := row[4].(string)
-		fmt.Println("Club:", club)
+	race := r.URL.Query().Get("race")
+	if race == "" {
+		http.Error(w, "Race is required", http.StatusBadRequest)
+		return
+	}
 
-		// Get the classification from the row
-		classification := row[5].(string)
-		fmt.Println("Classification:", classification)
+	authURL, err := oauthFlow.AuthURL(race, oauthRedirectURL(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
 
-		// Get the gender from the row
-		var gender string
-		genderString := row[6].(string)
-		if genderString == "K" || genderString == "F" || genderString == "W" || genderString == "Kvinna" || genderString == "Woman" {
-			gender = "F"
-		}
-		if genderString == "M" || genderString == "Man" || genderString == "Male" {
-			gender = "M"
-		}
+func oauthCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if oauthFlow == nil {
+		http.Error(w, "Google account login is not configured", http.StatusServiceUnavailable)
+		return
+	}
 
-		fmt.Println("Gender", gender)
+	if errorCode := r.URL.Query().Get("error"); errorCode != "" {
+		http.Error(w, fmt.Sprintf("Google login failed: %s", errorCode), http.StatusBadRequest)
+		return
+	}
 
-		eventName := requestData.PrimaryEventName + " " + classification
-		fmt.Println("Event: ", eventName)
+	race, err := oauthFlow.Exchange(r.Context(), r.URL.Query().Get("state"), r.URL.Query().Get("code"), oauthRedirectURL(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-		// Check if the event exists in the database
-		eventID, err := db.GetEventByName(database, eventName)
-		if err != nil {
-			eventID, err = db.CreateEvent(database, eventName, primaryEventID, classification)
-		}
-		if eventID > 0 {
-			participant := db.Participant{
-				BibNumber:      bibNumber,
-				FirstName:      firstName,
-				LastName:       lastName,
-				Gender:         gender,
-				Birthdate:      birthdate,
-				Club:           club,
-				Classification: classification,
-			}
-
-			err := db.InsertParticipant(database, participant, eventID)
-			if err != nil {
-				fmt.Println("Error inserting participant: ", err)
-				continue
-			}
-
-			fmt.Println("Event does not exist in the database")
-			continue
-		}
+	log.Printf("Google account connected for %s", race)
+	http.Redirect(w, r, "/", http.StatusFound)
+}
 
-		fmt.Println("-----")
+func oauthStatusHandler(w http.ResponseWriter, r *http.Request) {
+	race := r.URL.Query().Get("race")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{
+		"available": oauthFlow != nil,
+		"connected": oauthFlow != nil && race != "" && oauthFlow.HasToken(race),
+	})
+}
+
+func readParticipantsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var requestData struct {
+		PrimaryEventName      string `json:"primaryEventName"`
+		ParticipantsSheetName string `json:"participantsSheetName"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if sheetsService == nil {
+		http.Error(w, "Google Sheets is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	data, err := sheetsService.ReadSheet(requestData.ParticipantsSheetName)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading participants: %v", err), http.StatusInternalServerError)
+		return
 	}
 
+	imported, err := importStartList(database, requestData.PrimaryEventName, data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Imported %d participants for %s from %s, %d were already registered", imported.Imported, requestData.PrimaryEventName, requestData.ParticipantsSheetName, imported.Duplicates)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(data)
 }
 
+func publishersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "GET" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(publishers.Names())
+		return
+	}
+
+	if r.Method != "POST" {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var requestData struct {
+		Type   string `json:"type"`
+		Target string `json:"target"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	p, err := publisher.New(requestData.Type, requestData.Target)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	publishers.Add(p)
+	publishers.Notify()
+
+	fmt.Fprintf(w, "Added publisher: %s", p.Name())
+}
+
+func publishStatusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(publishers.Status())
+}
+
 func listParticipantsHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Group participants by event
@@ -247,90 +546,76 @@ func listParticipantsHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(participants)
 }
 
-func watchFile(filePath string) {
-	err := watcher.Add(filePath)
-	if err != nil {
-		log.Fatalf("Error adding file to watcher: %v", err)
-	}
-
-	for {
-		select {
-		case event, ok := <-watcher.Events:
-			if !ok {
-				return
-			}
-			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Chmod) != 0 {
-				log.Printf("File modified: %s", event.Name)
-				results, err := parser.ParseTimingFile(filePath)
-				if err != nil {
-					log.Printf("Error parsing timing data: %v", err)
-					continue
-				}
-
-				for _, result := range results {
-					// Find participant by bib number
-					participant, err := db.GetParticipantByBibNumber(database, result.BibNumber)
-
-					err = db.InsertTimingResult(database, result, participant)
-					if err != nil {
-						log.Printf("Error inserting timing result for bib number %d: %v", result.BibNumber, err)
-					}
-				}
-
-				log.Println("Timing data parsed and inserted successfully!")
-
-				// Get new data and update Google Sheets
-				data, err := getNewData()
-				if err != nil {
-					log.Printf("Error getting new data: %v", err)
-					continue
-				}
-
-				err = sheetsService.UpdateSheet(sheetName, data)
-				if err != nil {
-					log.Printf("Error updating Google Sheets: %v", err)
-				} else {
-					log.Println("Google Sheets updated successfully")
-				}
-			}
-		case err, ok := <-watcher.Errors:
-			if !ok {
-				return
-			}
-			log.Printf("Error watching file: %v", err)
-		}
+// ingestFile reads a timing file into the database and returns the number of timing lines in it
+func ingestFile(filePath string) (int, error) {
+	start := time.Now()
+	results, err := parser.ParseTimingFile(filePath)
+	var malformed *parser.MalformedError
+	if err != nil && !errors.As(err, &malformed) {
+		return 0, fmt.Errorf("error parsing timing data: %w", err)
 	}
-}
 
-func getNewData() ([][]interface{}, error) {
-	// Retrieve new data from the database
-	rows, err := database.Query("SELECT bib_number, timestamp, placement FROM timing_results ORDER BY timestamp ASC LIMIT 10000")
+	reads, err := db.IngestReads(database, results)
 	if err != nil {
-		return nil, fmt.Errorf("error querying new data: %v", err)
+		return 0, err
 	}
-	defer rows.Close()
 
-	var data [][]interface{}
-	for rows.Next() {
-		var bibNumber int
-		var timestamp string
-		// placement is a nullable column, so we need to use a pointer
-		var placement *int
+	log.Printf("Read %d lines from %s, %d new reads stored in %s", len(results), filePath, len(reads), time.Since(start))
 
-		if err := rows.Scan(&bibNumber, &timestamp, &placement); err != nil {
-			return nil, fmt.Errorf("error scanning row: %v", err)
-		}
-		participant, err := db.GetParticipantByBibNumber(database, bibNumber)
-		if err != nil {
-			return nil, fmt.Errorf("error getting participant by bib number: %v", err)
-		}
+	// Let the publishers push the new results in the background
+	if len(reads) > 0 {
+		publishers.Notify()
+		announceReads(reads)
+	}
 
-		data = append(data, []interface{}{bibNumber, participant.FirstName, participant.LastName, participant.Club, participant.Birthdate, timestamp, placement})
+	// The lines that could be parsed are stored, the others show as an error of the source
+	if malformed != nil {
+		return len(results), fmt.Errorf("error parsing timing data in %s: %w", filePath, malformed)
 	}
+	return len(results), nil
+}
+
+// loadResults returns all ranked results for the publishers
+func loadResults() ([]db.ResultRow, error) {
+	return db.GetResults(database, db.ResultQuery{FinishAntenna: cfg.FinishAntenna})
+}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error with rows: %v", err)
+// resultsHandler streams ranked results as a JSON array. The optional query
+// parameters event, limit and offset select an event and a page.
+func resultsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := db.ResultQuery{FinishAntenna: cfg.FinishAntenna}
+	for name, target := range map[string]*int{"event": &q.EventID, "limit": &q.Limit, "offset": &q.Offset} {
+		value := r.URL.Query().Get(name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			http.Error(w, fmt.Sprintf("Invalid %s: %s", name, value), http.StatusBadRequest)
+			return
+		}
+		*target = n
 	}
 
-	return data, nil
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	first := true
+	fmt.Fprint(w, "[")
+	err := db.EachResult(database, q, func(result db.ResultRow) error {
+		if !first {
+			fmt.Fprint(w, ",")
+		}
+		first = false
+		return encoder.Encode(result)
+	})
+	if err != nil {
+		// The status is already sent, so all we can do is log and end the array early
+		log.Printf("Error streaming results: %v", err)
+	}
+	fmt.Fprint(w, "]")
 }
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"github.com/jimmitjoo/livestream-results/pkg/config"
+	"github.com/jimmitjoo/livestream-results/pkg/db"
+	"github.com/jimmitjoo/livestream-results/pkg/mqtt"
+	"github.com/jimmitjoo/livestream-results/pkg/notify"
+	"github.com/jimmitjoo/livestream-results/pkg/publisher"
+	"github.com/jimmitjoo/livestream-results/pkg/webhook"
+	"log"
+	"strings"
+	"time"
+)
+
+// passageNotification is the data of finish and split notifications
+type passageNotification struct {
+	BibNumber  int    `json:"bibNumber"`
+	Name       string `json:"name"`
+	Club       string `json:"club"`
+	EventName  string `json:"eventName"`
+	Antenna    *int   `json:"antenna"`
+	Timestamp  string `json:"timestamp"`
+	RaceTimeMs *int64 `json:"raceTimeMs"`
+	RaceTime   string `json:"raceTime,omitempty"`
+	Position   int    `json:"position,omitempty"`
+}
+
+// statusNotification is the data of status notifications
+type statusNotification struct {
+	Status    string `json:"status"`
+	StartedAt string `json:"startedAt"`
+	StoppedAt string `json:"stoppedAt,omitempty"`
+}
+
+// correctionNotification is the data of correction notifications
+type correctionNotification struct {
+	Reason string `json:"reason"`
+}
+
+// announceReads publishes newly stored reads to MQTT and notifies about the
+// first passage of every runner at an antenna among them, texting runners who
+// opted in when they finish
+func announceReads(reads []db.Read) {
+	if mqttSink != nil {
+		mqttSink.PublishReads(reads)
+	}
+
+	passages, err := db.Passages(database, reads)
+	if err != nil {
+		log.Printf("Error finding passages: %v", err)
+		return
+	}
+	if len(passages) == 0 {
+		return
+	}
+
+	// Positions only matter for finishes, and one ranking covers the whole batch
+	finishes := false
+	for _, passage := range passages {
+		finishes = finishes || db.IsFinish(passage, cfg.FinishAntenna)
+	}
+	positions := make(map[[2]int]int)
+	if finishes {
+		rows, err := db.GetResults(database, db.ResultQuery{FinishAntenna: cfg.FinishAntenna})
+		if err != nil {
+			log.Printf("Error ranking finishes: %v", err)
+		}
+		for _, row := range rows {
+			positions[[2]int{row.EventID, row.BibNumber}] = row.Position
+		}
+	}
+	eventNames := make(map[int]string)
+	if events, err := db.ListEvents(database); err == nil {
+		for _, event := range events {
+			eventNames[event.EventID] = event.EventName
+		}
+	}
+	participants := make(map[[2]int]db.Participant)
+	if all, _, err := db.SearchParticipants(database, db.ParticipantQuery{}); err == nil {
+		for _, participant := range all {
+			participants[[2]int{participant.EventID, participant.BibNumber}] = participant
+		}
+	}
+
+	events := make([]webhook.Event, 0, len(passages))
+	var mqttPassages []mqtt.Passage
+	for _, passage := range passages {
+		notification := passageNotification{
+			BibNumber:  passage.BibNumber,
+			EventName:  eventNames[passage.EventID],
+			Antenna:    passage.Antenna,
+			Timestamp:  passage.Timestamp,
+			RaceTimeMs: passage.RaceTimeMs,
+		}
+		participant, ok := participants[[2]int{passage.EventID, passage.BibNumber}]
+		if ok {
+			notification.Name = strings.TrimSpace(participant.FirstName + " " + participant.LastName)
+			notification.Club = participant.Club
+		}
+		if passage.RaceTimeMs != nil {
+			notification.RaceTime = publisher.FormatDuration(time.Duration(*passage.RaceTimeMs) * time.Millisecond)
+		}
+
+		event := webhook.Event{Type: webhook.Split, EventID: passage.EventID, Data: notification}
+		if db.IsFinish(passage, cfg.FinishAntenna) {
+			event.Type = webhook.Finish
+			notification.Position = positions[[2]int{passage.EventID, passage.BibNumber}]
+			event.Data = notification
+			if notifier != nil && participant.NotifyFinish {
+				finish := notify.Finish{
+					Name:      notification.Name,
+					FirstName: participant.FirstName,
+					LastName:  participant.LastName,
+					BibNumber: passage.BibNumber,
+					Club:      participant.Club,
+					EventName: notification.EventName,
+					Time:      publisher.DisplayTime(db.ResultRow{Timestamp: passage.Timestamp, RaceTimeMs: passage.RaceTimeMs}),
+					Position:  notification.Position,
+				}
+				if err := notifier.Finish(participant, finish); err != nil {
+					log.Printf("Error queueing finish notification for bib %d: %v", passage.BibNumber, err)
+				}
+			}
+		}
+		events = append(events, event)
+		mqttPassages = append(mqttPassages, mqtt.Passage{Finish: event.Type == webhook.Finish, EventID: event.EventID, Data: event.Data})
+	}
+
+	if mqttSink != nil {
+		mqttSink.PublishPassages(mqttPassages)
+	}
+	if err := webhooks.Send(events...); err != nil {
+		log.Printf("Error queueing webhook notifications: %v", err)
+	}
+}
+
+// announceStatus notifies that the clock of an event was started or stopped
+func announceStatus(clock db.RaceClock) {
+	status := "started"
+	if clock.StoppedAt != "" {
+		status = "stopped"
+	}
+	event := webhook.Event{
+		Type:    webhook.Status,
+		EventID: clock.EventID,
+		Data:    statusNotification{Status: status, StartedAt: clock.StartedAt, StoppedAt: clock.StoppedAt},
+	}
+	if err := webhooks.Send(event); err != nil {
+		log.Printf("Error queueing webhook notifications: %v", err)
+	}
+}
+
+// announceCorrection notifies that stored results of an event changed
+func announceCorrection(eventID int, reason string) {
+	event := webhook.Event{Type: webhook.Correction, EventID: eventID, Data: correctionNotification{Reason: reason}}
+	if err := webhooks.Send(event); err != nil {
+		log.Printf("Error queueing webhook notifications: %v", err)
+	}
+}
+
+// newNotifier sets up finish notifications to participants with the configured
+// providers. Without any it returns nil and nobody is notified.
+func newNotifier(c config.NotifyConfig) (*notify.Notifier, error) {
+	opts := notify.Options{
+		SMSTemplate:   c.SMSTemplate,
+		EmailSubject:  c.EmailSubject,
+		EmailTemplate: c.EmailTemplate,
+		RatePerMinute: c.RatePerMinute,
+	}
+	if c.SMSGateway.URL != "" {
+		opts.SMS = &notify.HTTPGateway{URL: c.SMSGateway.URL, Token: c.SMSGateway.Token, From: c.SMSGateway.From}
+	}
+	if c.SMTP.Addr != "" {
+		opts.Email = &notify.SMTP{Addr: c.SMTP.Addr, Username: c.SMTP.Username, Password: c.SMTP.Password, From: c.SMTP.From}
+	}
+	if c.Stub {
+		stub := &notify.Stub{}
+		opts.SMS, opts.Email = stub, stub
+	}
+	if opts.SMS == nil && opts.Email == nil {
+		return nil, nil
+	}
+	return notify.New(database, opts)
+}
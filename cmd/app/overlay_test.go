@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/jimmitjoo/livestream-results/pkg/db"
+	"github.com/jimmitjoo/livestream-results/pkg/live"
+	"github.com/jimmitjoo/livestream-results/pkg/parser"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// overlayRace is a race with one class whose clock ran from 10:00 to 10:45
+// and three finishers
+type overlayRace struct {
+	url     string
+	raceID  int
+	classID int
+}
+
+func seedOverlayRace(t *testing.T) overlayRace {
+	t.Helper()
+	server, _ := startContractServer(t)
+	race := overlayRace{url: server.URL}
+
+	var err error
+	if race.raceID, err = db.InsertEvent(database, db.Event{EventName: "Mila", Distance: 10000}); err != nil {
+		t.Fatalf("InsertEvent: %v", err)
+	}
+	if race.classID, err = db.InsertEvent(database, db.Event{EventName: "Mila H21", ParentEventID: race.raceID, Classification: "H21"}); err != nil {
+		t.Fatalf("InsertEvent: %v", err)
+	}
+	start := time.Date(2024, 5, 4, 10, 0, 0, 0, time.UTC)
+	if err := db.StartRaceClock(database, race.raceID, start); err != nil {
+		t.Fatalf("StartRaceClock: %v", err)
+	}
+	if err := db.StopRaceClock(database, race.raceID, start.Add(45*time.Minute)); err != nil {
+		t.Fatalf("StopRaceClock: %v", err)
+	}
+
+	runners := []struct {
+		first, last, club string
+		finish            time.Duration
+	}{
+		{"Per", "Lund", "IK Stern", 35 * time.Minute},
+		{"Olof", "Ek", "OK Ravinen", 37*time.Minute + 30*time.Second},
+		{"Nils", "Berg", "", 40 * time.Minute},
+	}
+	var reads []parser.TimingResult
+	for i, runner := range runners {
+		participant := db.Participant{BibNumber: i + 1, FirstName: runner.first, LastName: runner.last, Club: runner.club, EventID: race.classID}
+		if _, err := db.CreateParticipant(database, participant); err != nil {
+			t.Fatalf("CreateParticipant: %v", err)
+		}
+		reads = append(reads, parser.TimingResult{BibNumber: i + 1, Timestamp: start.Add(runner.finish)})
+	}
+	if _, err := db.IngestReads(database, reads); err != nil {
+		t.Fatalf("IngestReads: %v", err)
+	}
+
+	rows, err := loadResults()
+	if err != nil {
+		t.Fatalf("loadResults: %v", err)
+	}
+	if err := liveSite.Publish(context.Background(), rows); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	return race
+}
+
+// getPage fetches path and fails unless it answers 200
+func getPage(t *testing.T, url string, path string) string {
+	t.Helper()
+	resp, err := http.Get(url + path)
+	if err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s answered %s: %s", path, resp.Status, body)
+	}
+	return string(body)
+}
+
+// getJSON fetches path and decodes its JSON into v
+func getJSON(t *testing.T, url string, path string, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal([]byte(getPage(t, url, path)), v); err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+}
+
+// scriptConst returns the number a rendered overlay assigns to a script variable
+func scriptConst(t *testing.T, page string, name string) int {
+	t.Helper()
+	match := regexp.MustCompile(`(?:const|let) ` + name + ` = \s*(\d+)\s*;`).FindStringSubmatch(page)
+	if match == nil {
+		t.Fatalf("the overlay does not set %s:\n%s", name, page)
+	}
+	n, _ := strconv.Atoi(match[1])
+	return n
+}
+
+func TestClockOverlay(t *testing.T) {
+	race := seedOverlayRace(t)
+
+	page := getPage(t, race.url, "/overlay/clock?event="+strconv.Itoa(race.classID))
+	if event := scriptConst(t, page, "event"); event != race.classID {
+		t.Errorf("event = %d, want %d", event, race.classID)
+	}
+	if !strings.Contains(page, `id="clock"`) || !strings.Contains(page, "'/api/clocks/' + event") {
+		t.Errorf("the clock overlay does not show /api/clocks/{event}:\n%s", page)
+	}
+
+	// The class has no clock of its own and shows the race's
+	var clock clockStatus
+	getJSON(t, race.url, "/api/clocks/"+strconv.Itoa(race.classID), &clock)
+	if clock.Running || clock.ElapsedMs != (45*time.Minute).Milliseconds() || clock.Elapsed != "0:45:00" {
+		t.Errorf("clock = %+v, want stopped at 0:45:00", clock)
+	}
+
+	// Without ?event= the overlay picks from all clocks
+	if event := scriptConst(t, getPage(t, race.url, "/overlay/clock"), "event"); event != 0 {
+		t.Errorf("event without ?event= = %d, want 0", event)
+	}
+	var clocks []clockStatus
+	getJSON(t, race.url, "/api/clocks", &clocks)
+	if len(clocks) != 1 || clocks[0].EventID != race.raceID {
+		t.Errorf("clocks = %+v, want the race's", clocks)
+	}
+}
+
+func TestFinisherOverlay(t *testing.T) {
+	race := seedOverlayRace(t)
+
+	page := getPage(t, race.url, "/overlay/finisher?event="+strconv.Itoa(race.classID)+"&seconds=5")
+	if event := scriptConst(t, page, "event"); event != race.classID {
+		t.Errorf("event = %d, want %d", event, race.classID)
+	}
+	if seconds := scriptConst(t, page, "seconds"); seconds != 5 {
+		t.Errorf("seconds = %d, want 5", seconds)
+	}
+	for _, id := range []string{"popup", "position", "name", "info", "time"} {
+		if !strings.Contains(page, `id="`+id+`"`) {
+			t.Errorf("the finisher overlay has no #%s", id)
+		}
+	}
+
+	// The popup follows the latest finishers of the class, newest first
+	var latest []live.Entry
+	getJSON(t, race.url, "/api/live/latest?event="+strconv.Itoa(race.classID), &latest)
+	if len(latest) != 3 {
+		t.Fatalf("latest = %+v, want 3 finishers", latest)
+	}
+	if newest := latest[0]; newest.BibNumber != 3 || newest.Position != 3 || newest.Name != "Nils Berg" || newest.Time != "0:40:00" || newest.EventName != "Mila H21" {
+		t.Errorf("newest finisher = %+v", newest)
+	}
+}
+
+func TestLeaderboardOverlay(t *testing.T) {
+	race := seedOverlayRace(t)
+
+	page := getPage(t, race.url, "/overlay/leaderboard?event="+strconv.Itoa(race.classID)+"&count=2")
+	if count := scriptConst(t, page, "count"); count != 2 {
+		t.Errorf("count = %d, want 2", count)
+	}
+	if event := scriptConst(t, page, "event"); event != race.classID {
+		t.Errorf("event = %d, want %d", event, race.classID)
+	}
+	if !strings.Contains(page, `id="title"`) || !strings.Contains(page, `id="rows"`) {
+		t.Errorf("the leaderboard overlay has no title or rows:\n%s", page)
+	}
+
+	var classes []live.Class
+	getJSON(t, race.url, "/api/live/classes", &classes)
+	found := false
+	for _, class := range classes {
+		if class.EventID == race.classID {
+			found = class.EventName == "Mila H21" && class.Finishers == 3
+		}
+	}
+	if !found {
+		t.Errorf("classes = %+v, want Mila H21 with 3 finishers", classes)
+	}
+
+	var entries []live.Entry
+	getJSON(t, race.url, "/api/live/classes/"+strconv.Itoa(race.classID), &entries)
+	want := []struct {
+		name, club, time string
+	}{
+		{"Per Lund", "IK Stern", "0:35:00"},
+		{"Olof Ek", "OK Ravinen", "0:37:30"},
+		{"Nils Berg", "", "0:40:00"},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("entries = %+v, want %d", entries, len(want))
+	}
+	for i, w := range want {
+		if e := entries[i]; e.Position != i+1 || e.Name != w.name || e.Club != w.club || e.Time != w.time {
+			t.Errorf("entry %d = %+v, want %s of %s in %s", i+1, e, w.name, w.club, w.time)
+		}
+	}
+}
+
+func TestOverlayRejectsBadParameters(t *testing.T) {
+	race := seedOverlayRace(t)
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/overlay/leaderboard?count=-1", http.StatusBadRequest},
+		{"/overlay/finisher?seconds=soon", http.StatusBadRequest},
+		{"/overlay/scoreboard", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		resp, err := http.Get(race.url + test.path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", test.path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.want {
+			t.Errorf("GET %s answered %d, want %d", test.path, resp.StatusCode, test.want)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/jimmitjoo/livestream-results/pkg/auth"
+	"github.com/jimmitjoo/livestream-results/pkg/db"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// phonePattern is a phone number after spaces and dashes are removed
+var phonePattern = regexp.MustCompile(`^\+?[0-9]{6,15}$`)
+
+// participantRequest is the body for creating or updating a participant.
+// Changing bibNumber or eventID on update is a bib change or class transfer.
+type participantRequest struct {
+	BibNumber int    `json:"bibNumber"`
+	EventID   int    `json:"eventID"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+	Gender    string `json:"gender"`
+	Birthdate string `json:"birthdate"`
+	Club      string `json:"club"`
+	// Phone and Email are where the finish notification goes if notifyFinish is set
+	Phone        string `json:"phone"`
+	Email        string `json:"email"`
+	NotifyFinish bool   `json:"notifyFinish"`
+}
+
+// participant validates the request and builds the participant it describes
+func (req participantRequest) participant() (db.Participant, error) {
+	if req.BibNumber <= 0 {
+		return db.Participant{}, fmt.Errorf("bibNumber must be a positive number")
+	}
+	if strings.TrimSpace(req.FirstName) == "" || strings.TrimSpace(req.LastName) == "" {
+		return db.Participant{}, fmt.Errorf("firstName and lastName are required")
+	}
+	if req.Gender != "" && req.Gender != "M" && req.Gender != "F" {
+		return db.Participant{}, fmt.Errorf("gender must be M or F")
+	}
+
+	phone := strings.NewReplacer(" ", "", "-", "").Replace(req.Phone)
+	if phone != "" && !phonePattern.MatchString(phone) {
+		return db.Participant{}, fmt.Errorf("phone must be a phone number such as +46701234567")
+	}
+	email := strings.TrimSpace(req.Email)
+	if email != "" {
+		if _, err := mail.ParseAddress(email); err != nil {
+			return db.Participant{}, fmt.Errorf("email must be an email address")
+		}
+	}
+	if req.NotifyFinish && phone == "" && email == "" {
+		return db.Participant{}, fmt.Errorf("notifyFinish needs a phone number or an email address")
+	}
+
+	event, err := db.GetEvent(database, req.EventID)
+	if err != nil {
+		return db.Participant{}, fmt.Errorf("eventID %d does not exist", req.EventID)
+	}
+
+	return db.Participant{
+		BibNumber:      req.BibNumber,
+		EventID:        req.EventID,
+		FirstName:      req.FirstName,
+		LastName:       req.LastName,
+		Gender:         req.Gender,
+		Birthdate:      req.Birthdate,
+		Club:           req.Club,
+		Classification: event.Classification,
+		Phone:          phone,
+		Email:          email,
+		NotifyFinish:   req.NotifyFinish,
+	}, nil
+}
+
+// hideContact blanks the contact details of participants for users below
+// operator, such as the speaker
+func hideContact(r *http.Request, participants []db.Participant) {
+	if user, _ := auth.UserFrom(r.Context()); auth.Role(user.Role).Allows(auth.Operator) {
+		return
+	}
+	for i := range participants {
+		participants[i].Phone = ""
+		participants[i].Email = ""
+	}
+}
+
+// participantsHandler serves /api/participants: GET searches participants with
+// the query parameters q, event, limit and offset, and POST registers one
+func participantsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		q := db.ParticipantQuery{Search: strings.TrimSpace(r.URL.Query().Get("q")), Limit: 50}
+		for name, target := range map[string]*int{"event": &q.EventID, "limit": &q.Limit, "offset": &q.Offset} {
+			value := r.URL.Query().Get(name)
+			if value == "" {
+				continue
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid %s: %s", name, value))
+				return
+			}
+			*target = n
+		}
+
+		participants, total, err := db.SearchParticipants(database, q)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		hideContact(r, participants)
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"participants": participants,
+			"total":        total,
+			"limit":        q.Limit,
+			"offset":       q.Offset,
+		})
+
+	case "POST":
+		var req participantRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		participant, err := req.participant()
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		participantID, err := db.CreateParticipant(database, participant)
+		if err != nil {
+			writeError(w, statusFor(err), err)
+			return
+		}
+
+		participant, err = db.GetParticipant(database, participantID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		publishers.Notify()
+		w.Header().Set("Location", fmt.Sprintf("/api/participants/%d", participantID))
+		writeJSON(w, http.StatusCreated, participant)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("invalid request method"))
+	}
+}
+
+// participantHandler serves /api/participants/{id}: GET returns the participant,
+// PUT updates it, including bib changes and class transfers, and DELETE removes it.
+// GET /api/participants/{id}/notifications returns the messages sent to the participant.
+func participantHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/participants/"), "/")
+	participantID, err := strconv.Atoi(parts[0])
+	if err != nil || len(parts) > 2 || (len(parts) == 2 && parts[1] != "notifications") {
+		writeError(w, http.StatusNotFound, fmt.Errorf("invalid participant ID"))
+		return
+	}
+	if len(parts) == 2 {
+		participantNotificationsHandler(w, r, participantID)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		participant, err := db.GetParticipant(database, participantID)
+		if err != nil {
+			writeError(w, statusFor(err), err)
+			return
+		}
+		participants := []db.Participant{participant}
+		hideContact(r, participants)
+		writeJSON(w, http.StatusOK, participants[0])
+
+	case "PUT":
+		var req participantRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		participant, err := req.participant()
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		participant.ParticipantID = participantID
+
+		if err := db.UpdateParticipant(database, participant); err != nil {
+			writeError(w, statusFor(err), err)
+			return
+		}
+
+		participant, err = db.GetParticipant(database, participantID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		publishers.Notify()
+		announceCorrection(participant.EventID, "participant updated")
+		writeJSON(w, http.StatusOK, participant)
+
+	case "DELETE":
+		participant, err := db.GetParticipant(database, participantID)
+		if err != nil {
+			writeError(w, statusFor(err), err)
+			return
+		}
+		if err := db.DeleteParticipant(database, participantID); err != nil {
+			writeError(w, statusFor(err), err)
+			return
+		}
+		publishers.Notify()
+		announceCorrection(participant.EventID, "participant deleted")
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("invalid request method"))
+	}
+}
+
+// participantNotificationsHandler serves the log of messages sent to a
+// participant, which only operators may read
+func participantNotificationsHandler(w http.ResponseWriter, r *http.Request, participantID int) {
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("invalid request method"))
+		return
+	}
+	if user, _ := auth.UserFrom(r.Context()); !auth.Role(user.Role).Allows(auth.Operator) {
+		writeError(w, http.StatusForbidden, fmt.Errorf("%s role required", auth.Operator))
+		return
+	}
+	if _, err := db.GetParticipant(database, participantID); err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+
+	notifications, err := db.ListNotifications(database, participantID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, notifications)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/jimmitjoo/livestream-results/pkg/webhook"
+	"log"
+	"net/http"
+)
+
+// runWebhookReceiver accepts signed webhook deliveries and prints them, to try
+// out webhooks without a receiver of one's own:
+//
+//	webhook-receiver [-listen :9090] -secret <secret> [-fail 2]
+func runWebhookReceiver(args []string) error {
+	fs := flag.NewFlagSet("webhook-receiver", flag.ContinueOnError)
+	listen := fs.String("listen", ":9090", "address to listen on")
+	secret := fs.String("secret", "", "secret of the webhook")
+	fail := fs.Int("fail", 0, "answer the first attempts of every delivery with 503 to try retries")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *secret == "" {
+		return fmt.Errorf("-secret is required")
+	}
+
+	receiver := &webhook.Receiver{
+		Secret: *secret,
+		Fail:   *fail,
+		Handle: func(delivery string, p webhook.Payload) {
+			log.Printf("Delivery %s: %s in event %d (race %d): %s", delivery, p.Type, p.EventID, p.RaceID, p.Data)
+		},
+	}
+	log.Printf("Receiving webhooks at %s", *listen)
+	return http.ListenAndServe(*listen, receiver)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/jimmitjoo/livestream-results/pkg/config"
+	"github.com/jimmitjoo/livestream-results/pkg/db"
+	"github.com/jimmitjoo/livestream-results/pkg/replay"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// defaultDistance is used for generated reads of events without a distance
+const defaultDistance = 10000
+
+// runReplay plays a timing file into a target file or TCP port:
+//
+//	replay [-speed 10] [-rebase] [-truncate] <timing file> <target file or tcp://host:port>
+func runReplay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	speed := fs.Float64("speed", 1, "times faster than real time, 0 sends everything at once")
+	rebase := fs.Bool("rebase", false, "move timestamps so the first read happens now")
+	truncate := fs.Bool("truncate", false, "empty the target file first")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: replay [flags] <timing file> <target file or tcp://host:port>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return fmt.Errorf("replay needs a timing file and a target")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	started := time.Now()
+	sent, err := replay.Replay(ctx, fs.Arg(0), replay.Options{
+		Target:   fs.Arg(1),
+		Speed:    *speed,
+		Rebase:   *rebase,
+		Truncate: *truncate,
+		Progress: func(sent int, at time.Time) {
+			if sent%100 == 0 {
+				log.Printf("Sent %d reads, at %s", sent, at.Format("15:04:05"))
+			}
+		},
+	})
+	log.Printf("Sent %d reads to %s in %s", sent, fs.Arg(1), time.Since(started).Round(time.Millisecond))
+	return err
+}
+
+// runGenerate writes synthetic reads for the start list in the database, or
+// for -count runners when the database has no participants:
+//
+//	generate [-db race_timing.db] [-splits 2] [-pace 5m] <output file>
+func runGenerate(args []string) error {
+	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
+	dbPath := fs.String("db", config.Default().DBPath, "database with the start list")
+	eventID := fs.Int("event", 0, "only participants of this race or class")
+	count := fs.Int("count", 0, "generate runners with bibs 1 to count instead of using the start list")
+	start := fs.String("start", "", "start time as 2006-01-02 15:04:05, default the events' start or now")
+	splits := fs.Int("splits", 2, "number of split antennas")
+	finishAntenna := fs.Int("finish-antenna", 0, "antenna at the finish, default the one after the splits")
+	pace := fs.Duration("pace", 5*time.Minute, "average time per kilometer")
+	spread := fs.Float64("spread", 0.15, "how much paces differ between runners")
+	missRate := fs.Float64("miss-rate", 0.02, "chance that a split read is missed")
+	duplicates := fs.Int("duplicates", 2, "most extra reads of one passage")
+	dnfRate := fs.Float64("dnf-rate", 0.01, "chance that a runner does not finish")
+	seed := fs.Int64("seed", time.Now().UnixNano(), "seed for repeatable reads")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: generate [flags] <output file or - for stdout>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("generate needs an output file")
+	}
+
+	fallbackStart := db.WallClock(time.Now()).Truncate(time.Second)
+	if *start != "" {
+		parsed, err := time.Parse(db.StartTimeLayout, *start)
+		if err != nil {
+			return fmt.Errorf("start must be formatted as %s: %w", db.StartTimeLayout, err)
+		}
+		fallbackStart = parsed
+	}
+
+	var runners []replay.Runner
+	if *count > 0 {
+		for bibNumber := 1; bibNumber <= *count; bibNumber++ {
+			runners = append(runners, replay.Runner{BibNumber: bibNumber, Start: fallbackStart, Distance: defaultDistance})
+		}
+	} else {
+		var err error
+		runners, err = startListRunners(*dbPath, *eventID, fallbackStart, *start != "")
+		if err != nil {
+			return err
+		}
+		if len(runners) == 0 {
+			return fmt.Errorf("no participants in %s, import a start list or use -count", *dbPath)
+		}
+	}
+
+	var out io.Writer = os.Stdout
+	if fs.Arg(0) != "-" {
+		file, err := os.Create(fs.Arg(0))
+		if err != nil {
+			return fmt.Errorf("error creating output file: %w", err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	lines, err := replay.Generate(out, runners, replay.GenerateOptions{
+		Splits:        *splits,
+		FinishAntenna: *finishAntenna,
+		Pace:          *pace,
+		Spread:        *spread,
+		MissRate:      *missRate,
+		Duplicates:    *duplicates,
+		DNFRate:       *dnfRate,
+		Seed:          *seed,
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Generated %d reads for %d runners", lines, len(runners))
+	return nil
+}
+
+// startListRunners turns the participants in the database into runners, each
+// starting with their event unless start overrides it
+func startListRunners(dbPath string, eventID int, start time.Time, override bool) ([]replay.Runner, error) {
+	database, err := db.SetupDatabase(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer database.Close()
+
+	events, err := db.ListEvents(database)
+	if err != nil {
+		return nil, err
+	}
+	parents := make(map[int]int)
+	distances := make(map[int]int)
+	for _, event := range events {
+		parents[event.EventID] = event.ParentEventID
+		distances[event.EventID] = event.Distance
+	}
+	starts, err := db.StartTimes(database)
+	if err != nil {
+		return nil, err
+	}
+	participants, _, err := db.SearchParticipants(database, db.ParticipantQuery{})
+	if err != nil {
+		return nil, err
+	}
+
+	var runners []replay.Runner
+	for _, p := range participants {
+		if eventID != 0 && p.EventID != eventID && parents[p.EventID] != eventID {
+			continue
+		}
+		runner := replay.Runner{BibNumber: p.BibNumber, Start: start, Distance: distances[p.EventID]}
+		if runner.Distance == 0 {
+			runner.Distance = distances[parents[p.EventID]]
+		}
+		if runner.Distance == 0 {
+			runner.Distance = defaultDistance
+		}
+		if eventStart, ok := starts[p.EventID]; ok && !override {
+			runner.Start = eventStart
+		}
+		runners = append(runners, runner)
+	}
+	return runners, nil
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"fmt"
+	"github.com/jimmitjoo/livestream-results/pkg/db"
+	"github.com/jimmitjoo/livestream-results/pkg/parser"
+	"github.com/jimmitjoo/livestream-results/pkg/replay"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestMain runs the program itself when a test starts it as a subprocess
+func TestMain(m *testing.M) {
+	if os.Getenv("LSR_TEST_RUN_MAIN") == "1" {
+		os.Args = append([]string{os.Args[0]}, flagArgs(os.Args[1:])...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// flagArgs drops the test binary's own flags, which come before "--"
+func flagArgs(args []string) []string {
+	for i, arg := range args {
+		if arg == "--" {
+			return args[i+1:]
+		}
+	}
+	return args
+}
+
+// startServe runs "serve" on dbPath in a subprocess, which is killed at the end
+// of the test. Its log is shown when the test fails.
+func startServe(t *testing.T, dir string, dbPath string, args ...string) *exec.Cmd {
+	t.Helper()
+	args = append([]string{"-test.run=^$", "--", "serve", "-db", dbPath, "-listen", "127.0.0.1:0"}, args...)
+	var output bytes.Buffer
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "LSR_TEST_RUN_MAIN=1", "LSR_ADMIN_PASSWORD=secret")
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("starting serve: %v", err)
+	}
+
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+		if t.Failed() {
+			t.Logf("serve %v:\n%s", args[2:], output.String())
+		}
+	})
+	return cmd
+}
+
+// timingLines generates a timing file for runners and returns its lines
+func timingLines(t *testing.T, runners int) [][]byte {
+	t.Helper()
+	start := time.Date(2024, 5, 4, 10, 0, 0, 0, time.UTC)
+	list := make([]replay.Runner, runners)
+	for i := range list {
+		list[i] = replay.Runner{BibNumber: i + 1, Start: start, Distance: 10000}
+	}
+
+	var file bytes.Buffer
+	if _, err := replay.Generate(&file, list, replay.GenerateOptions{Splits: 2, Pace: 4 * time.Minute, Spread: 0.1, Seed: 1}); err != nil {
+		t.Fatalf("generating reads: %v", err)
+	}
+
+	var lines [][]byte
+	scanner := bufio.NewScanner(&file)
+	for scanner.Scan() {
+		lines = append(lines, []byte(scanner.Text()+"\n"))
+	}
+	return lines
+}
+
+// appendLines writes lines to path in chunks, the way a timing system appends reads
+func appendLines(path string, lines [][]byte, chunk int, done chan<- error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		done <- err
+		return
+	}
+	defer file.Close()
+
+	for i := 0; i < len(lines); i += chunk {
+		var buf bytes.Buffer
+		for _, line := range lines[i:minInt(i+chunk, len(lines))] {
+			buf.Write(line)
+		}
+		if _, err := file.Write(buf.Bytes()); err != nil {
+			done <- err
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	done <- nil
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// countRows counts the rows of table without taking part in writing the
+// database, 0 before the table exists
+func countRows(dbPath string, table string) int {
+	conn, err := sql.Open("sqlite3", "file:"+dbPath+"?mode=ro&_busy_timeout=5000")
+	if err != nil {
+		return 0
+	}
+	defer conn.Close()
+
+	var n int
+	if err := conn.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&n); err != nil {
+		return 0
+	}
+	return n
+}
+
+// storedReads opens the database like the server does and returns its reads by bib number and timestamp
+func storedReads(t *testing.T, dbPath string) map[string]bool {
+	t.Helper()
+	database, err := db.SetupDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("reopening the database: %v", err)
+	}
+	defer database.Close()
+
+	var integrity string
+	if err := database.QueryRow("PRAGMA integrity_check").Scan(&integrity); err != nil || integrity != "ok" {
+		t.Fatalf("integrity check = %q, %v", integrity, err)
+	}
+
+	rows, err := database.Query("SELECT bib_number, timestamp FROM timing_results")
+	if err != nil {
+		t.Fatalf("reading reads: %v", err)
+	}
+	defer rows.Close()
+
+	reads := make(map[string]bool)
+	for rows.Next() {
+		var bibNumber int
+		var timestamp string
+		if err := rows.Scan(&bibNumber, &timestamp); err != nil {
+			t.Fatalf("scanning read: %v", err)
+		}
+		reads[fmt.Sprintf("%d %s", bibNumber, timestamp)] = true
+	}
+	return reads
+}
+
+// fileReads returns the reads of a timing file by bib number and timestamp
+func fileReads(t *testing.T, path string) map[string]bool {
+	t.Helper()
+	results, err := parser.ParseTimingFile(path)
+	if err != nil {
+		t.Fatalf("parsing %s: %v", path, err)
+	}
+	reads := make(map[string]bool)
+	for _, result := range results {
+		reads[fmt.Sprintf("%d %s", result.BibNumber, result.Timestamp.Format(db.TimestampLayout))] = true
+	}
+	return reads
+}
+
+func waitFor(t *testing.T, what string, timeout time.Duration, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestServeKeepsReadsWhenStoppedMidBatch stops the server while reads are being
+// appended and ingested. Every read that was stored before the signal must still
+// be there, and a restart must store the rest of the file.
+func TestServeKeepsReadsWhenStoppedMidBatch(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts the server in a subprocess")
+	}
+
+	for _, sig := range []syscall.Signal{syscall.SIGKILL, syscall.SIGTERM} {
+		t.Run(sig.String(), func(t *testing.T) {
+			dir := t.TempDir()
+			dbPath := filepath.Join(dir, "race.db")
+			timingPath := filepath.Join(dir, "timing.txt")
+			if err := os.WriteFile(timingPath, nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+			lines := timingLines(t, 10000)
+
+			serve := startServe(t, dir, dbPath, "-watch", timingPath)
+			waitFor(t, "the server to watch the file", 30*time.Second, func() bool {
+				return countRows(dbPath, "watch_sources") > 0
+			})
+			written := make(chan error, 1)
+			go appendLines(timingPath, lines, 500, written)
+
+			// Stop the server a quarter into the file, when every write is followed by an
+			// ingest of the whole file that is likely to be running
+			var accepted int
+			waitFor(t, "the first reads", 30*time.Second, func() bool {
+				accepted = countRows(dbPath, "timing_results")
+				return accepted > len(lines)/4
+			})
+			if err := serve.Process.Signal(sig); err != nil {
+				t.Fatalf("signalling serve: %v", err)
+			}
+			err := serve.Wait()
+			if sig == syscall.SIGTERM && err != nil {
+				t.Fatalf("serve did not shut down cleanly: %v", err)
+			}
+			if err := <-written; err != nil {
+				t.Fatalf("appending reads: %v", err)
+			}
+
+			all := fileReads(t, timingPath)
+			stored := storedReads(t, dbPath)
+			if len(stored) < accepted {
+				t.Errorf("%d reads stored after %s, %d were stored before", len(stored), sig, accepted)
+			}
+			// A terminated server finishes what it is ingesting, which may be the whole file
+			if sig == syscall.SIGKILL && len(stored) >= len(all) {
+				t.Fatalf("all %d reads were stored before %s, the test did not stop the server mid-batch", len(all), sig)
+			}
+			for read := range stored {
+				if !all[read] {
+					t.Errorf("stored read %s is not in the file", read)
+				}
+			}
+
+			// The watched file is resumed on restart and the reads missed meanwhile are stored
+			serve = startServe(t, dir, dbPath)
+			waitFor(t, "the rest of the reads", 60*time.Second, func() bool {
+				return countRows(dbPath, "timing_results") == len(all)
+			})
+			if err := serve.Process.Signal(syscall.SIGTERM); err != nil {
+				t.Fatalf("signalling serve: %v", err)
+			}
+			if err := serve.Wait(); err != nil {
+				t.Fatalf("serve did not shut down cleanly: %v", err)
+			}
+
+			stored = storedReads(t, dbPath)
+			for read := range all {
+				if !stored[read] {
+					t.Errorf("read %s in the file was not stored", read)
+				}
+			}
+			if len(stored) != len(all) {
+				t.Errorf("%d reads stored, want the %d in the file", len(stored), len(all))
+			}
+		})
+	}
+}
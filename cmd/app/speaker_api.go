@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jimmitjoo/livestream-results/pkg/speaker"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// defaultSpeakerWindow is how far back the speaker view looks without ?minutes=
+const defaultSpeakerWindow = 5 * time.Minute
+
+// speakerHandler serves GET /api/speaker with the runners approaching the
+// finish and the latest finishers. ?minutes= sets how far back to look,
+// ?eventID= limits it to a race or class and ?limit= shortens the finish feed.
+func speakerHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("invalid request method"))
+		return
+	}
+
+	q := speaker.Query{FinishAntenna: cfg.FinishAntenna, Window: defaultSpeakerWindow}
+	query := r.URL.Query()
+	if v := query.Get("minutes"); v != "" {
+		minutes, err := strconv.Atoi(v)
+		if err != nil || minutes < 1 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("minutes must be a positive integer"))
+			return
+		}
+		q.Window = time.Duration(minutes) * time.Minute
+	}
+	if v := query.Get("eventID"); v != "" {
+		eventID, err := strconv.Atoi(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("eventID must be an integer"))
+			return
+		}
+		q.EventID = eventID
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("limit must be a non-negative integer"))
+			return
+		}
+		q.Limit = limit
+	}
+
+	board, err := speaker.Build(database, q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, board)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/jimmitjoo/livestream-results/pkg/db"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// startListColumns is the least number of columns in a start list row:
+// bib, first name, last name, birthdate, club, class and gender
+const startListColumns = 7
+
+// startListImport counts the outcome of importStartList
+type startListImport struct {
+	// Imported participants were stored
+	Imported int
+	// Duplicates were already in their class and left as they were
+	Duplicates int
+}
+
+// importStartList stores the participants in rows under the race primaryEventName,
+// with one class per classification. Rows without a bib number, like headers,
+// are skipped, and so are participants already in their class.
+func importStartList(database *sql.DB, primaryEventName string, rows [][]interface{}) (startListImport, error) {
+	var imported startListImport
+	primaryEventID, err := db.GetEventByName(database, primaryEventName)
+	if err != nil {
+		primaryEventID, err = db.CreateEvent(database, primaryEventName, 0, "")
+		if err != nil {
+			return imported, fmt.Errorf("error creating primary event: %w", err)
+		}
+	}
+
+	for _, row := range rows {
+		if len(row) < startListColumns {
+			log.Printf("Skipping start list row with %d columns: %v", len(row), row)
+			continue
+		}
+		bibNumber, err := strconv.Atoi(cell(row[0]))
+		if err != nil {
+			log.Printf("Skipping start list row without a valid bib number: %v", row[0])
+			continue
+		}
+
+		classification := cell(row[5])
+		eventName := primaryEventName + " " + classification
+		eventID, err := db.GetEventByName(database, eventName)
+		if err != nil {
+			eventID, err = db.CreateEvent(database, eventName, primaryEventID, classification)
+			if err != nil {
+				return imported, fmt.Errorf("error creating class %s: %w", eventName, err)
+			}
+		}
+
+		participant := db.Participant{
+			BibNumber:      bibNumber,
+			FirstName:      cell(row[1]),
+			LastName:       cell(row[2]),
+			Gender:         gender(cell(row[6])),
+			Birthdate:      cell(row[3]),
+			Club:           cell(row[4]),
+			Classification: classification,
+		}
+		err = db.InsertParticipant(database, participant, eventID)
+		if errors.Is(err, db.ErrDuplicate) {
+			imported.Duplicates++
+			continue
+		}
+		if err != nil {
+			log.Printf("Error inserting participant %d: %v", bibNumber, err)
+			continue
+		}
+		imported.Imported++
+	}
+
+	return imported, nil
+}
+
+// readStartListCSV reads a start list with the same columns as the Google
+// Sheets start list from a CSV file
+func readStartListCSV(path string) ([][]interface{}, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening start list: %w", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("error reading start list: %w", err)
+	}
+
+	rows := make([][]interface{}, len(records))
+	for i, record := range records {
+		rows[i] = make([]interface{}, len(record))
+		for j, value := range record {
+			rows[i][j] = value
+		}
+	}
+	return rows, nil
+}
+
+// cell returns a spreadsheet value as text
+func cell(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// gender normalizes the gender column to F or M, empty when unknown
+func gender(s string) string {
+	switch s {
+	case "K", "F", "W", "Kvinna", "Woman":
+		return "F"
+	case "M", "Man", "Male":
+		return "M"
+	default:
+		return ""
+	}
+}
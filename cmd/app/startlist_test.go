@@ -0,0 +1,50 @@
+package main
+
+import (
+	"github.com/jimmitjoo/livestream-results/pkg/db"
+	"path/filepath"
+	"testing"
+)
+
+func TestImportStartListCountsDuplicates(t *testing.T) {
+	database, err := db.SetupDatabase(filepath.Join(t.TempDir(), "race.db"))
+	if err != nil {
+		t.Fatalf("SetupDatabase: %v", err)
+	}
+	defer database.Close()
+
+	rows := [][]interface{}{
+		{"Nr", "Förnamn", "Efternamn", "Född", "Klubb", "Klass", "Kön"},
+		{"1", "Per", "Lund", "1990-01-01", "IK Stern", "H21", "M"},
+		{"2", "Eva", "Ek", "1992-02-02", "OK Ravinen", "D21", "K"},
+		{"1", "Per", "Lund", "1990-01-01", "IK Stern", "H21", "M"},
+	}
+	imported, err := importStartList(database, "Mila", rows)
+	if err != nil {
+		t.Fatalf("importStartList: %v", err)
+	}
+	if want := (startListImport{Imported: 2, Duplicates: 1}); imported != want {
+		t.Errorf("first import = %+v, want %+v", imported, want)
+	}
+
+	// Importing the same list again writes nothing
+	imported, err = importStartList(database, "Mila", rows)
+	if err != nil {
+		t.Fatalf("importStartList: %v", err)
+	}
+	if want := (startListImport{Duplicates: 3}); imported != want {
+		t.Errorf("second import = %+v, want %+v", imported, want)
+	}
+
+	participants, err := db.GetParticipants(database)
+	if err != nil {
+		t.Fatalf("GetParticipants: %v", err)
+	}
+	stored := 0
+	for _, class := range participants {
+		stored += len(class)
+	}
+	if stored != 2 {
+		t.Errorf("%d participants stored, want 2", stored)
+	}
+}
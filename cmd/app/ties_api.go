@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/jimmitjoo/livestream-results/pkg/db"
+	"net/http"
+	"strings"
+)
+
+// tieRequest is the body for deciding a photo finish: the runners in the tie
+// at timestamp, first to last
+type tieRequest struct {
+	Timestamp string `json:"timestamp"`
+	Order     []struct {
+		BibNumber int `json:"bibNumber"`
+		EventID   int `json:"eventID"`
+	} `json:"order"`
+	PhotoPath string `json:"photoPath"`
+}
+
+// findTie returns the tie at timestamp
+func findTie(timestamp string) (db.Tie, error) {
+	ties, err := db.Ties(database, cfg.FinishAntenna)
+	if err != nil {
+		return db.Tie{}, err
+	}
+	for _, tie := range ties {
+		if tie.Timestamp == timestamp {
+			return tie, nil
+		}
+	}
+	return db.Tie{}, fmt.Errorf("no tie at %s: %w", timestamp, db.ErrNotFound)
+}
+
+// announceTie tells publishers and webhooks of every event in a tie that its
+// positions changed
+func announceTie(tie db.Tie, reason string) {
+	publishers.Notify()
+	announced := make(map[int]bool)
+	for _, result := range tie.Results {
+		if !announced[result.EventID] {
+			announced[result.EventID] = true
+			announceCorrection(result.EventID, reason)
+		}
+	}
+}
+
+// tiesHandler serves /api/ties: GET lists the runners who share a position,
+// PUT decides their order from a photo finish and DELETE with ?timestamp= makes
+// them share a position again
+func tiesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		ties, err := db.Ties(database, cfg.FinishAntenna)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, ties)
+
+	case "PUT":
+		var req tieRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		tie, err := findTie(req.Timestamp)
+		if err != nil {
+			writeError(w, statusFor(err), err)
+			return
+		}
+
+		// The order must name every runner in the tie once
+		inTie := make(map[db.TieEntry]bool)
+		for _, result := range tie.Results {
+			inTie[db.TieEntry{BibNumber: result.BibNumber, EventID: result.EventID}] = true
+		}
+		order := make([]db.TieEntry, 0, len(req.Order))
+		for _, runner := range req.Order {
+			entry := db.TieEntry{BibNumber: runner.BibNumber, EventID: runner.EventID}
+			if !inTie[entry] {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("bib number %d in event %d is not in the tie or named twice", runner.BibNumber, runner.EventID))
+				return
+			}
+			delete(inTie, entry)
+			order = append(order, entry)
+		}
+		if len(inTie) > 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("order must name all %d runners in the tie", len(tie.Results)))
+			return
+		}
+
+		if err := db.ResolveTie(database, tie, order, strings.TrimSpace(req.PhotoPath)); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		tie, err = findTie(tie.Timestamp)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		announceTie(tie, "photo finish decided")
+		writeJSON(w, http.StatusOK, tie)
+
+	case "DELETE":
+		timestamp := r.URL.Query().Get("timestamp")
+		tie, err := findTie(timestamp)
+		if err != nil {
+			writeError(w, statusFor(err), err)
+			return
+		}
+		if err := db.ClearTie(database, timestamp); err != nil {
+			writeError(w, statusFor(err), err)
+			return
+		}
+		announceTie(tie, "photo finish cleared")
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("invalid request method"))
+	}
+}
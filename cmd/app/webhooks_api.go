@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/jimmitjoo/livestream-results/pkg/auth"
+	"github.com/jimmitjoo/livestream-results/pkg/db"
+	"github.com/jimmitjoo/livestream-results/pkg/webhook"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// defaultDeliveries is how many deliveries the delivery log shows unless asked for more
+const defaultDeliveries = 50
+
+// webhookRequest is the body for creating or updating a webhook. Without a
+// secret a new webhook gets a random one and an updated one keeps its own.
+type webhookRequest struct {
+	EventID int      `json:"eventID"`
+	URL     string   `json:"url"`
+	Secret  string   `json:"secret"`
+	Types   []string `json:"types"`
+	Active  *bool    `json:"active"`
+}
+
+// newWebhook is the answer to creating a webhook, the only one with its secret
+type newWebhook struct {
+	db.Webhook
+	Secret string `json:"secret"`
+}
+
+func (req webhookRequest) webhook() (db.Webhook, error) {
+	target, err := url.Parse(req.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return db.Webhook{}, fmt.Errorf("url must be an http or https URL")
+	}
+	for _, t := range req.Types {
+		if !webhook.IsType(t) {
+			return db.Webhook{}, fmt.Errorf("unknown type %q, use %s", t, strings.Join(webhook.Types, ", "))
+		}
+	}
+	if req.EventID != 0 {
+		if _, err := db.GetEvent(database, req.EventID); err != nil {
+			return db.Webhook{}, fmt.Errorf("eventID %d does not exist", req.EventID)
+		}
+	}
+
+	active := req.Active == nil || *req.Active
+	return db.Webhook{EventID: req.EventID, URL: req.URL, Secret: req.Secret, Types: req.Types, Active: active}, nil
+}
+
+// webhooksHandler serves /api/webhooks: GET lists all webhooks and POST creates one
+func webhooksHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		hooks, err := db.ListWebhooks(database)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, hooks)
+
+	case "POST":
+		var req webhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		hook, err := req.webhook()
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if hook.Secret == "" {
+			if hook.Secret, err = auth.NewToken(); err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+		}
+
+		webhookID, err := db.CreateWebhook(database, hook)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		hook, err = db.GetWebhook(database, webhookID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.Header().Set("Location", fmt.Sprintf("/api/webhooks/%d", webhookID))
+		writeJSON(w, http.StatusCreated, newWebhook{Webhook: hook, Secret: hook.Secret})
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("invalid request method"))
+	}
+}
+
+// webhookHandler serves /api/webhooks/{id}: GET returns the webhook, PUT updates
+// it and DELETE removes it with its delivery log. GET /api/webhooks/{id}/deliveries
+// returns the latest deliveries and POST /api/webhooks/{id}/test sends a test notification.
+func webhookHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/webhooks/"), "/")
+	webhookID, err := strconv.Atoi(parts[0])
+	if err != nil || len(parts) > 2 {
+		writeError(w, http.StatusNotFound, fmt.Errorf("invalid webhook ID"))
+		return
+	}
+
+	if len(parts) == 2 {
+		webhookActionHandler(w, r, webhookID, parts[1])
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		hook, err := db.GetWebhook(database, webhookID)
+		if err != nil {
+			writeError(w, statusFor(err), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, hook)
+
+	case "PUT":
+		var req webhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		hook, err := req.webhook()
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		hook.WebhookID = webhookID
+
+		if err := db.UpdateWebhook(database, hook); err != nil {
+			writeError(w, statusFor(err), err)
+			return
+		}
+		hook, err = db.GetWebhook(database, webhookID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, hook)
+
+	case "DELETE":
+		if err := db.DeleteWebhook(database, webhookID); err != nil {
+			writeError(w, statusFor(err), err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("invalid request method"))
+	}
+}
+
+// webhookActionHandler serves the delivery log and test notifications of a webhook
+func webhookActionHandler(w http.ResponseWriter, r *http.Request, webhookID int, action string) {
+	hook, err := db.GetWebhook(database, webhookID)
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+
+	switch action {
+	case "deliveries":
+		if r.Method != "GET" {
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("invalid request method"))
+			return
+		}
+		limit := defaultDeliveries
+		if value := r.URL.Query().Get("limit"); value != "" {
+			if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit: %s", value))
+				return
+			}
+		}
+		deliveries, err := db.ListWebhookDeliveries(database, webhookID, limit)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, deliveries)
+
+	case "test":
+		if r.Method != "POST" {
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("invalid request method"))
+			return
+		}
+		deliveryID, err := webhooks.SendTest(hook)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, map[string]int{"deliveryID": deliveryID})
+
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown webhook operation %q", action))
+	}
+}
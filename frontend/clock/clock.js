@@ -0,0 +1,94 @@
+// syncInterval is how often the clock is fetched again from the server
+const syncInterval = 30000;
+
+document.addEventListener('alpine:init', () => {
+    Alpine.data('clockData', () => ({
+        eventID: Number(new URLSearchParams(window.location.search).get('event')) || 0,
+        eventName: '',
+        events: [],
+        clock: null,
+        fetchedAt: 0,
+        display: '0:00:00',
+        canOperate: false,
+        startedAt: '',
+        by: '',
+        error: '',
+
+        load() {
+            fetch('/api/me')
+                .then(response => response.ok ? response.json() : null)
+                .then(user => {
+                    this.canOperate = user !== null && (user.Role === 'operator' || user.Role === 'admin');
+                    if (this.canOperate) {
+                        return fetch('/api/events')
+                            .then(response => response.json())
+                            .then(events => {
+                                this.events = events;
+                                if (!this.eventID && events.length > 0) {
+                                    this.eventID = events[0].EventID;
+                                    this.sync();
+                                }
+                            });
+                    }
+                });
+            this.sync();
+            setInterval(() => this.sync(), syncInterval);
+            setInterval(() => this.tick(), 100);
+        },
+
+        select() {
+            history.replaceState(null, '', '?event=' + this.eventID);
+            this.sync();
+        },
+
+        // The time since the clock was fetched is added on this device, so every
+        // screen shows the server's time regardless of its own clock
+        sync() {
+            const url = this.eventID ? '/api/clocks/' + this.eventID : '/api/clocks';
+            fetch(url)
+                .then(response => response.ok ? response.json() : null)
+                .then(clock => {
+                    if (Array.isArray(clock)) {
+                        clock = clock.find(c => c.running) || clock[0] || null;
+                    }
+                    this.clock = clock;
+                    this.fetchedAt = performance.now();
+                    const event = this.events.find(e => clock && e.EventID === clock.eventID);
+                    this.eventName = event ? event.EventName : '';
+                    this.tick();
+                });
+        },
+
+        tick() {
+            if (!this.clock) {
+                this.display = '0:00:00';
+                return;
+            }
+            let elapsed = this.clock.elapsedMs;
+            if (this.clock.running) {
+                elapsed += performance.now() - this.fetchedAt;
+            }
+            const seconds = Math.floor(elapsed / 1000);
+            this.display = Math.floor(seconds / 3600) + ':' + String(Math.floor(seconds / 60) % 60).padStart(2, '0') + ':' + String(seconds % 60).padStart(2, '0');
+        },
+
+        operate(operation, body) {
+            this.error = '';
+            fetch('/api/clocks/' + this.eventID + '/' + operation, {
+                method: 'POST',
+                headers: {'Content-Type': 'application/json'},
+                body: body ? JSON.stringify(body) : undefined,
+            })
+                .then(response => response.json().then(data => ({ok: response.ok, data: data})))
+                .then(({ok, data}) => {
+                    if (!ok) {
+                        this.error = data.error;
+                        return;
+                    }
+                    this.clock = data;
+                    this.fetchedAt = performance.now();
+                    this.tick();
+                });
+        },
+    }));
+});
@@ -0,0 +1,89 @@
+document.addEventListener('alpine:init', () => {
+    Alpine.data('liveData', () => ({
+        view: 'classes',
+        classes: [],
+        races: [],
+        currentClass: {},
+        results: [],
+        athlete: {},
+        query: '',
+        matches: [],
+        connected: false,
+
+        load() {
+            window.addEventListener('hashchange', () => this.route());
+            this.route();
+
+            // The server tells when results change, then only the open view is refetched
+            const updates = new EventSource('/api/live/updates');
+            updates.onopen = () => {
+                this.connected = true;
+            };
+            updates.onerror = () => {
+                this.connected = false;
+            };
+            updates.onmessage = () => {
+                this.route();
+            };
+        },
+
+        route() {
+            const parts = window.location.hash.replace(/^#\/?/, '').split('/');
+            this.loadClasses();
+            if (parts[0] === 'class' && parts[1]) {
+                this.view = 'class';
+                this.loadClass(parts[1]);
+            } else if (parts[0] === 'athlete' && parts[2]) {
+                this.view = 'athlete';
+                this.loadAthlete(parts[1], parts[2]);
+            } else {
+                this.view = 'classes';
+            }
+        },
+
+        loadClasses() {
+            fetch('/api/live/classes')
+                .then(response => response.json())
+                .then(classes => {
+                    this.classes = classes;
+                    this.races = classes.filter(c => !c.parentEventID);
+                    if (this.view === 'class') {
+                        this.currentClass = classes.find(c => String(c.eventID) === window.location.hash.split('/')[2]) || {};
+                    }
+                });
+        },
+
+        classesOf(race) {
+            const classes = this.classes.filter(c => c.parentEventID === race.eventID);
+            return classes.length > 0 ? classes : [race];
+        },
+
+        loadClass(eventID) {
+            fetch('/api/live/classes/' + eventID)
+                .then(response => response.ok ? response.json() : [])
+                .then(results => {
+                    this.results = results;
+                });
+        },
+
+        loadAthlete(eventID, bibNumber) {
+            fetch('/api/live/athletes/' + eventID + '/' + bibNumber)
+                .then(response => response.ok ? response.json() : {})
+                .then(athlete => {
+                    this.athlete = athlete;
+                });
+        },
+
+        search() {
+            if (this.query.trim() === '') {
+                this.matches = [];
+                return;
+            }
+            fetch('/api/live/search?q=' + encodeURIComponent(this.query))
+                .then(response => response.json())
+                .then(matches => {
+                    this.matches = matches;
+                });
+        },
+    }));
+});
@@ -135,12 +135,14 @@ document.getElementById('sheets-form').addEventListener('submit', function (even
     event.preventDefault();
     const sheetID = document.getElementById('sheetID').value;
     const sheetName = document.getElementById('sheetName').value;
+    const auth = document.getElementById('sheetsAuth').value;
+    const eventName = document.getElementById('eventName').value;
     fetch('/google-sheets', {
         method: 'POST',
         headers: {
             'Content-Type': 'application/json'
         },
-        body: JSON.stringify({sheetID, sheetName})
+        body: JSON.stringify({sheetID, sheetName, auth, eventName})
     })
         .then(response => response.text())
         .then(data => {
@@ -151,6 +153,26 @@ document.getElementById('sheets-form').addEventListener('submit', function (even
         });
 });
 
+document.getElementById('publisher-form').addEventListener('submit', function (event) {
+    event.preventDefault();
+    const type = document.getElementById('publisherType').value;
+    const target = document.getElementById('publisherTarget').value;
+    fetch('/publishers', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({type, target})
+    })
+        .then(response => response.text())
+        .then(data => {
+            document.getElementById('publisher-feedback').innerText = data;
+        })
+        .catch(error => {
+            document.getElementById('publisher-feedback').innerText = 'Error adding publisher: ' + error;
+        });
+});
+
 document.getElementById('read-startlista').addEventListener('submit', function (event) {
     event.preventDefault();
     const primaryEventName = document.getElementById('eventName').value;
@@ -182,9 +204,53 @@ document.addEventListener('alpine:init', () => {
         eventName: '',
         sheetID: '',
         sheetName: '',
+        sheetsAuth: 'service-account',
+        oauthConnected: false,
         filePath: '',
+        watchers: [],
+        events: [],
+        eventsFeedback: '',
+        participantSearch: '',
+        participantResults: [],
+        participantTotal: 0,
+        participantLimit: 50,
+        participantOffset: 0,
+        participantFeedback: '',
+        notifications: [],
+        notificationsFor: null,
+        notificationStatuses: {pending: 'Väntar', sent: 'Skickat', failed: 'Misslyckades'},
+        ties: [],
+        tiesFeedback: '',
+        user: {},
+        roleNames: {speaker: 'Speaker', operator: 'Tidtagare', admin: 'Administratör'},
+        users: [],
+        tokens: [],
+        newTokenName: '',
+        newTokenUserID: null,
+        createdToken: '',
+        usersFeedback: '',
+        webhooks: [],
+        webhookTypes: {finish: 'Målgång', split: 'Mellantid', status: 'Klocka', correction: 'Rättelse'},
+        deliveryStatuses: {pending: 'Väntar', delivered: 'Levererad', failed: 'Misslyckad'},
+        deliveries: [],
+        deliveriesFor: null,
+        webhooksFeedback: '',
 
         init() {
+            fetch('/api/me')
+                .then(response => {
+                    if (response.status === 401) {
+                        window.location.href = '/login.html';
+                        return;
+                    }
+                    return response.json().then(user => {
+                        this.user = user;
+                    });
+                });
+
+            this.loadWatchers();
+            setInterval(() => this.loadWatchers(), 5000);
+
             this.$watch('tab', () => {
                 localStorage.setItem('tab', this.tab);
             });
@@ -200,6 +266,10 @@ document.addEventListener('alpine:init', () => {
             this.$watch('sheetName', () => {
                 localStorage.setItem('sheetName', this.sheetName);
             });
+            this.$watch('sheetsAuth', () => {
+                localStorage.setItem('sheetsAuth', this.sheetsAuth);
+                this.checkOAuth();
+            });
             this.$watch('filePath', () => {
                 localStorage.setItem('filePath', this.filePath);
             });
@@ -211,9 +281,356 @@ document.addEventListener('alpine:init', () => {
             this.eventName = '';
             this.sheetID = '';
             this.sheetName = '';
+            this.sheetsAuth = 'service-account';
             this.filePath = '';
         },
 
+        logout() {
+            fetch('/api/logout', {method: 'POST'})
+                .then(() => {
+                    window.location.href = '/login.html';
+                });
+        },
+
+        loadUsers() {
+            fetch('/api/users')
+                .then(response => response.json())
+                .then(users => {
+                    this.users = users.map(user => ({...user, password: ''}));
+                });
+            fetch('/api/tokens')
+                .then(response => response.json())
+                .then(tokens => {
+                    this.tokens = tokens || [];
+                });
+        },
+
+        saveUser(account) {
+            fetch(account.UserID ? '/api/users/' + account.UserID : '/api/users', {
+                method: account.UserID ? 'PUT' : 'POST',
+                headers: {
+                    'Content-Type': 'application/json'
+                },
+                body: JSON.stringify({
+                    username: account.Username,
+                    password: account.password,
+                    role: account.Role,
+                })
+            })
+                .then(response => response.json())
+                .then(data => {
+                    if (data.error) {
+                        this.usersFeedback = data.error;
+                        return;
+                    }
+                    account.UserID = data.UserID;
+                    account.password = '';
+                    this.usersFeedback = 'Sparat: ' + data.Username;
+                });
+        },
+
+        deleteUser(account) {
+            if (!confirm('Ta bort ' + account.Username + '?')) {
+                return;
+            }
+            fetch('/api/users/' + account.UserID, {method: 'DELETE'})
+                .then(response => {
+                    if (response.ok) {
+                        this.loadUsers();
+                    }
+                });
+        },
+
+        createToken() {
+            fetch('/api/tokens', {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json'
+                },
+                body: JSON.stringify({name: this.newTokenName, userID: this.newTokenUserID})
+            })
+                .then(response => response.json())
+                .then(data => {
+                    if (data.error) {
+                        this.usersFeedback = data.error;
+                        return;
+                    }
+                    this.createdToken = data.token;
+                    this.newTokenName = '';
+                    this.loadUsers();
+                });
+        },
+
+        deleteToken(token) {
+            if (!confirm('Återkalla ' + token.Name + '?')) {
+                return;
+            }
+            fetch('/api/tokens/' + token.TokenID, {method: 'DELETE'})
+                .then(() => this.loadUsers());
+        },
+
+        loadWebhooks() {
+            this.loadEvents();
+            fetch('/api/webhooks')
+                .then(response => response.json())
+                .then(webhooks => {
+                    this.webhooks = webhooks.map(hook => ({...hook, types: hook.types || [], secret: ''}));
+                });
+        },
+
+        saveWebhook(hook) {
+            fetch(hook.webhookID ? '/api/webhooks/' + hook.webhookID : '/api/webhooks', {
+                method: hook.webhookID ? 'PUT' : 'POST',
+                headers: {
+                    'Content-Type': 'application/json'
+                },
+                body: JSON.stringify({
+                    url: hook.url,
+                    eventID: hook.eventID,
+                    types: hook.types,
+                    secret: hook.secret,
+                    active: hook.active,
+                })
+            })
+                .then(response => response.json())
+                .then(data => {
+                    if (data.error) {
+                        this.webhooksFeedback = data.error;
+                        return;
+                    }
+                    Object.assign(hook, data, {types: data.types || [], secret: ''});
+                    // The secret is only shown when the webhook is created
+                    this.webhooksFeedback = 'Sparat: ' + data.url + (data.secret ? '. Hemlighet: ' + data.secret : '');
+                });
+        },
+
+        deleteWebhook(hook) {
+            if (!confirm('Ta bort ' + hook.url + '?')) {
+                return;
+            }
+            fetch('/api/webhooks/' + hook.webhookID, {method: 'DELETE'})
+                .then(response => {
+                    if (response.ok) {
+                        this.deliveriesFor = null;
+                        this.loadWebhooks();
+                    }
+                });
+        },
+
+        testWebhook(hook) {
+            fetch('/api/webhooks/' + hook.webhookID + '/test', {method: 'POST'})
+                .then(response => response.json())
+                .then(data => {
+                    this.webhooksFeedback = data.error || 'Testanrop skickat till ' + hook.url;
+                    setTimeout(() => this.loadDeliveries(hook), 1000);
+                });
+        },
+
+        loadDeliveries(hook) {
+            fetch('/api/webhooks/' + hook.webhookID + '/deliveries')
+                .then(response => response.json())
+                .then(deliveries => {
+                    this.deliveriesFor = hook;
+                    this.deliveries = deliveries;
+                });
+        },
+
+        loadEvents() {
+            fetch('/api/events')
+                .then(response => response.json())
+                .then(events => {
+                    this.events = events;
+                });
+        },
+
+        saveEvent(event) {
+            fetch('/api/events/' + event.EventID, {
+                method: 'PUT',
+                headers: {
+                    'Content-Type': 'application/json'
+                },
+                body: JSON.stringify({
+                    eventName: event.EventName,
+                    classification: event.Classification,
+                    startTime: event.StartTime,
+                    distance: event.Distance,
+                })
+            })
+                .then(response => response.json())
+                .then(data => {
+                    this.eventsFeedback = data.error ? data.error : 'Sparat: ' + data.EventName;
+                });
+        },
+
+        searchParticipants(offset) {
+            if (this.events.length === 0) {
+                this.loadEvents();
+            }
+            const params = new URLSearchParams({q: this.participantSearch, limit: this.participantLimit, offset: offset});
+            fetch('/api/participants?' + params)
+                .then(response => response.json())
+                .then(data => {
+                    this.participantResults = data.participants;
+                    this.participantTotal = data.total;
+                    this.participantOffset = data.offset;
+                });
+        },
+
+        newParticipant() {
+            if (this.events.length === 0) {
+                this.loadEvents();
+            }
+            this.participantResults.unshift({ParticipantID: 0, BibNumber: null, FirstName: '', LastName: '', Club: '', EventID: null, Phone: '', Email: '', NotifyFinish: false});
+        },
+
+        saveParticipant(participant) {
+            const url = participant.ParticipantID ? '/api/participants/' + participant.ParticipantID : '/api/participants';
+            fetch(url, {
+                method: participant.ParticipantID ? 'PUT' : 'POST',
+                headers: {
+                    'Content-Type': 'application/json'
+                },
+                body: JSON.stringify({
+                    bibNumber: participant.BibNumber,
+                    eventID: participant.EventID,
+                    firstName: participant.FirstName,
+                    lastName: participant.LastName,
+                    club: participant.Club,
+                    gender: participant.Gender || '',
+                    birthdate: participant.Birthdate || '',
+                    phone: participant.Phone || '',
+                    email: participant.Email || '',
+                    notifyFinish: !!participant.NotifyFinish,
+                })
+            })
+                .then(response => response.json())
+                .then(data => {
+                    if (data.error) {
+                        this.participantFeedback = data.error;
+                        return;
+                    }
+                    Object.assign(participant, data);
+                    this.participantFeedback = 'Sparat: ' + data.BibNumber + ' ' + data.FirstName + ' ' + data.LastName;
+                });
+        },
+
+        deleteParticipant(participant) {
+            if (!confirm('Ta bort ' + participant.FirstName + ' ' + participant.LastName + '?')) {
+                return;
+            }
+            fetch('/api/participants/' + participant.ParticipantID, {method: 'DELETE'})
+                .then(response => {
+                    if (response.ok) {
+                        this.participantResults = this.participantResults.filter(p => p !== participant);
+                        this.participantFeedback = 'Borttagen: ' + participant.FirstName + ' ' + participant.LastName;
+                    }
+                });
+        },
+
+        loadNotifications(participant) {
+            fetch('/api/participants/' + participant.ParticipantID + '/notifications')
+                .then(response => response.json())
+                .then(data => {
+                    if (data.error) {
+                        this.participantFeedback = data.error;
+                        return;
+                    }
+                    this.notificationsFor = participant;
+                    this.notifications = data;
+                });
+        },
+
+        loadTies() {
+            fetch('/api/ties')
+                .then(response => response.json())
+                .then(ties => {
+                    this.ties = ties;
+                });
+        },
+
+        moveTieRunner(tie, index, delta) {
+            const [result] = tie.Results.splice(index, 1);
+            tie.Results.splice(index + delta, 0, result);
+        },
+
+        saveTie(tie) {
+            fetch('/api/ties', {
+                method: 'PUT',
+                headers: {
+                    'Content-Type': 'application/json'
+                },
+                body: JSON.stringify({
+                    timestamp: tie.Timestamp,
+                    order: tie.Results.map(result => ({bibNumber: result.BibNumber, eventID: result.EventID})),
+                    photoPath: tie.PhotoPath || '',
+                })
+            })
+                .then(response => response.json())
+                .then(data => {
+                    if (data.error) {
+                        this.tiesFeedback = data.error;
+                        return;
+                    }
+                    Object.assign(tie, data);
+                    this.tiesFeedback = 'Sparat: ' + data.Timestamp;
+                });
+        },
+
+        clearTie(tie) {
+            if (!confirm('Återställ ordningen för ' + tie.Timestamp + '?')) {
+                return;
+            }
+            fetch('/api/ties?' + new URLSearchParams({timestamp: tie.Timestamp}), {method: 'DELETE'})
+                .then(response => {
+                    if (response.ok) {
+                        this.tiesFeedback = 'Återställd: ' + tie.Timestamp;
+                        this.loadTies();
+                    }
+                });
+        },
+
+        loadWatchers() {
+            fetch('/watchers')
+                .then(response => response.json())
+                .then(watchers => {
+                    this.watchers = watchers;
+                });
+        },
+
+        stopWatch(filePath) {
+            this.postWatch('/watchers/stop', filePath);
+        },
+
+        restartWatch(filePath) {
+            this.postWatch('/watchers/restart', filePath);
+        },
+
+        postWatch(url, filePath) {
+            fetch(url, {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json'
+                },
+                body: JSON.stringify({filePath})
+            })
+                .then(response => response.text())
+                .then(data => {
+                    document.getElementById('watch-feedback').innerText = data;
+                    this.loadWatchers();
+                });
+        },
+
+        checkOAuth() {
+            if (this.sheetsAuth !== 'oauth' || !this.eventName) {
+                return;
+            }
+            fetch('/oauth/status?race=' + encodeURIComponent(this.eventName))
+                .then(response => response.json())
+                .then(status => {
+                    this.oauthConnected = status.connected;
+                });
+        },
+
         loadData() {
             // load from localStorage
             const tab = localStorage.getItem('tab');
@@ -221,13 +638,26 @@ document.addEventListener('alpine:init', () => {
             const eventName = localStorage.getItem('eventName');
             const sheetID = localStorage.getItem('sheetID');
             const sheetName = localStorage.getItem('sheetName');
+            const sheetsAuth = localStorage.getItem('sheetsAuth');
             const filePath = localStorage.getItem('filePath');
             if (tab) {
                 this.tab = tab;
 
+                if (tab === 'events') {
+                    this.loadEvents();
+                }
+
                 if (tab === 'participants') {
                     fetchParticipants();
                 }
+
+                if (tab === 'webhooks') {
+                    this.loadWebhooks();
+                }
+
+                if (tab === 'ties') {
+                    this.loadTies();
+                }
             }
             if (participantsSheetName) {
                 this.participantsSheetName = participantsSheetName;
@@ -244,6 +674,10 @@ document.addEventListener('alpine:init', () => {
             if (filePath) {
                 this.filePath = filePath;
             }
+            if (sheetsAuth) {
+                this.sheetsAuth = sheetsAuth;
+            }
+            this.checkOAuth();
         },
     }));
 });
@@ -0,0 +1,61 @@
+// refreshInterval moves the time window forward even when no reads arrive
+const refreshInterval = 10000;
+
+document.addEventListener('alpine:init', () => {
+    Alpine.data('speakerData', () => ({
+        board: {approaching: [], finished: []},
+        events: [],
+        eventID: Number(localStorage.getItem('speakerEventID')) || 0,
+        minutes: Number(localStorage.getItem('speakerMinutes')) || 5,
+        connected: false,
+        updated: '',
+
+        load() {
+            fetch('/api/events')
+                .then(response => {
+                    if (response.status === 401) {
+                        window.location.href = '/login.html';
+                    }
+                    return response.json();
+                })
+                .then(events => {
+                    this.events = events;
+                });
+            this.refresh();
+            setInterval(() => this.refresh(), refreshInterval);
+
+            // New results mean new reads, so refresh at once
+            const updates = new EventSource('/api/live/updates');
+            updates.onopen = () => {
+                this.connected = true;
+            };
+            updates.onerror = () => {
+                this.connected = false;
+            };
+            updates.onmessage = () => {
+                this.refresh();
+            };
+        },
+
+        refresh() {
+            localStorage.setItem('speakerEventID', this.eventID);
+            localStorage.setItem('speakerMinutes', this.minutes);
+
+            const params = new URLSearchParams({minutes: this.minutes || 5, limit: 20});
+            if (this.eventID) {
+                params.set('eventID', this.eventID);
+            }
+            fetch('/api/speaker?' + params)
+                .then(response => {
+                    if (response.status === 401) {
+                        window.location.href = '/login.html';
+                    }
+                    return response.json();
+                })
+                .then(board => {
+                    this.board = board;
+                    this.updated = new Date().toLocaleTimeString('sv-SE');
+                });
+        },
+    }));
+});
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net/http"
+)
+
+// docsPage loads Swagger UI from a CDN and points it at the served spec
+const docsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <title>livestream-results API</title>
+    <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+<script>
+    window.ui = SwaggerUIBundle({url: '/api/openapi.json', dom_id: '#swagger-ui'});
+</script>
+</body>
+</html>
+`
+
+// SpecHandler serves the OpenAPI spec as JSON
+func SpecHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(Spec)
+}
+
+// DocsHandler serves Swagger UI for the spec
+func DocsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(docsPage))
+}
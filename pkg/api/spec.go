@@ -0,0 +1,195 @@
+// Package api holds the OpenAPI description of the HTTP API, validates
+// requests against it and serves it with Swagger UI.
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Spec is the OpenAPI 3 document describing every endpoint of the server
+//
+//go:embed openapi.json
+var Spec []byte
+
+// Document is the part of an OpenAPI document needed to validate requests and generate clients
+type Document struct {
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+// PathItem holds the operations of one path, keyed by lower case HTTP method
+type PathItem struct {
+	Parameters []Parameter `json:"parameters"`
+	Get        *Operation  `json:"get"`
+	Put        *Operation  `json:"put"`
+	Post       *Operation  `json:"post"`
+	Delete     *Operation  `json:"delete"`
+}
+
+// Components holds the definitions that $ref can point to
+type Components struct {
+	Parameters map[string]Parameter `json:"parameters"`
+	Responses  map[string]Response  `json:"responses"`
+	Schemas    map[string]*Schema   `json:"schemas"`
+}
+
+// Operation is one method on one path
+type Operation struct {
+	OperationID string              `json:"operationId"`
+	Summary     string              `json:"summary"`
+	Parameters  []Parameter         `json:"parameters"`
+	RequestBody *RequestBody        `json:"requestBody"`
+	Responses   map[string]Response `json:"responses"`
+}
+
+// Parameter is a path or query parameter
+type Parameter struct {
+	Ref      string  `json:"$ref"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+// RequestBody is the body an operation accepts
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response is one possible response of an operation
+type Response struct {
+	Ref         string               `json:"$ref"`
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content"`
+}
+
+// MediaType holds the schema of a body with one content type
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema is the subset of JSON Schema used by the spec
+type Schema struct {
+	Ref         string             `json:"$ref"`
+	Type        string             `json:"type"`
+	Format      string             `json:"format"`
+	Description string             `json:"description"`
+	Required    []string           `json:"required"`
+	Properties  map[string]*Schema `json:"properties"`
+	Items       *Schema            `json:"items"`
+	Enum        []interface{}      `json:"enum"`
+	Minimum     *float64           `json:"minimum"`
+	MinLength   *int               `json:"minLength"`
+	Nullable    bool               `json:"nullable"`
+	// AdditionalProperties is the schema of an object's values when its keys
+	// are data, such as names; only the schema form is supported
+	AdditionalProperties *Schema `json:"additionalProperties"`
+}
+
+// Load parses the embedded spec
+func Load() (*Document, error) {
+	return Parse(Spec)
+}
+
+// Parse parses an OpenAPI document and checks that all its references resolve
+func Parse(data []byte) (*Document, error) {
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("error parsing OpenAPI spec: %w", err)
+	}
+
+	for _, path := range doc.PathNames() {
+		for _, op := range doc.Paths[path].Operations() {
+			for _, param := range doc.Parameters(path, op.Operation) {
+				if param.Name == "" {
+					return nil, fmt.Errorf("error in OpenAPI spec: unresolved parameter in %s %s", op.Method, path)
+				}
+			}
+			for code, response := range op.Responses {
+				if _, err := doc.Response(response); err != nil {
+					return nil, fmt.Errorf("error in OpenAPI spec: %s %s response %s: %w", op.Method, path, code, err)
+				}
+			}
+		}
+	}
+	return &doc, nil
+}
+
+// MethodOperation is an operation together with its HTTP method
+type MethodOperation struct {
+	Method string
+	*Operation
+}
+
+// Operations lists the operations of the path in a fixed order
+func (p PathItem) Operations() []MethodOperation {
+	var ops []MethodOperation
+	for _, op := range []MethodOperation{{"GET", p.Get}, {"POST", p.Post}, {"PUT", p.Put}, {"DELETE", p.Delete}} {
+		if op.Operation != nil {
+			ops = append(ops, op)
+		}
+	}
+	return ops
+}
+
+// Operation returns the operation for method, or nil when the path has none
+func (p PathItem) Operation(method string) *Operation {
+	for _, op := range p.Operations() {
+		if op.Method == method {
+			return op.Operation
+		}
+	}
+	return nil
+}
+
+// PathNames lists the paths of the document sorted by name
+func (d *Document) PathNames() []string {
+	names := make([]string, 0, len(d.Paths))
+	for name := range d.Paths {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Parameters returns the resolved parameters of an operation, including those shared by its path
+func (d *Document) Parameters(path string, op *Operation) []Parameter {
+	var params []Parameter
+	for _, param := range append(append([]Parameter{}, d.Paths[path].Parameters...), op.Parameters...) {
+		if param.Ref != "" {
+			param = d.Components.Parameters[strings.TrimPrefix(param.Ref, "#/components/parameters/")]
+		}
+		params = append(params, param)
+	}
+	return params
+}
+
+// Response resolves a response that may be a reference
+func (d *Document) Response(response Response) (Response, error) {
+	if response.Ref == "" {
+		return response, nil
+	}
+	resolved, ok := d.Components.Responses[strings.TrimPrefix(response.Ref, "#/components/responses/")]
+	if !ok {
+		return Response{}, fmt.Errorf("unknown response %s", response.Ref)
+	}
+	return resolved, nil
+}
+
+// Resolve follows a schema reference
+func (d *Document) Resolve(schema *Schema) *Schema {
+	for schema != nil && schema.Ref != "" {
+		schema = d.Components.Schemas[RefName(schema.Ref)]
+	}
+	return schema
+}
+
+// RefName is the name of the schema a reference points to
+func RefName(ref string) string {
+	return strings.TrimPrefix(ref, "#/components/schemas/")
+}
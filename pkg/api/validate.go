@@ -0,0 +1,314 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxBodySize limits the size of request bodies
+const maxBodySize = 1 << 20
+
+// Validator rejects requests that do not match the spec before they reach the handlers
+type Validator struct {
+	doc *Document
+}
+
+// NewValidator creates a Validator for doc
+func NewValidator(doc *Document) *Validator {
+	return &Validator{doc: doc}
+}
+
+// Middleware validates the parameters and JSON body of requests to paths in
+// the spec and answers 400 with an error message when they do not match, or
+// 413 when the body is larger than maxBodySize. Other paths, and methods the
+// spec does not list, are passed on untouched.
+func (v *Validator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, pathParams, ok := v.match(r.URL.Path)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		op := v.doc.Paths[path].Operation(r.Method)
+		if op == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if err := v.validate(w, r, path, op, pathParams); err != nil {
+			status := http.StatusBadRequest
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Validate is Middleware for one handler. Wrapped in the authentication of a
+// route it validates only requests of users who may make them.
+func (v *Validator) Validate(next http.HandlerFunc) http.HandlerFunc {
+	return v.Middleware(next).ServeHTTP
+}
+
+// Operation finds the operation of the spec a request is for
+func (v *Validator) Operation(r *http.Request) (*Operation, bool) {
+	path, _, ok := v.match(r.URL.Path)
+	if !ok {
+		return nil, false
+	}
+	op := v.doc.Paths[path].Operation(r.Method)
+	return op, op != nil
+}
+
+// ValidateResponse checks that the spec lists status for the operation of r and
+// that a JSON body matches the response's schema. Contract tests use it to check
+// the handlers against the spec.
+func (v *Validator) ValidateResponse(r *http.Request, status int, body []byte) error {
+	op, ok := v.Operation(r)
+	if !ok {
+		return fmt.Errorf("%s %s is not in the spec", r.Method, r.URL.Path)
+	}
+	response, ok := op.Responses[strconv.Itoa(status)]
+	if !ok {
+		return fmt.Errorf("%s answered %d, which the spec does not list", op.OperationID, status)
+	}
+	response, err := v.doc.Response(response)
+	if err != nil {
+		return err
+	}
+
+	media, ok := response.Content["application/json"]
+	if !ok {
+		return nil
+	}
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return fmt.Errorf("%s answered %d with invalid JSON: %w", op.OperationID, status, err)
+	}
+	if err := v.ValidateValue(value, media.Schema, "response"); err != nil {
+		return fmt.Errorf("%s answered %d: %w", op.OperationID, status, err)
+	}
+	return nil
+}
+
+// match finds the spec path for a request path and extracts its path parameters
+func (v *Validator) match(requestPath string) (string, map[string]string, bool) {
+	parts := strings.Split(strings.Trim(requestPath, "/"), "/")
+	for _, path := range v.doc.PathNames() {
+		segments := strings.Split(strings.Trim(path, "/"), "/")
+		if len(segments) != len(parts) {
+			continue
+		}
+
+		params := make(map[string]string)
+		matched := true
+		for i, segment := range segments {
+			if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+				params[strings.Trim(segment, "{}")] = parts[i]
+				continue
+			}
+			if segment != parts[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return path, params, true
+		}
+	}
+	return "", nil, false
+}
+
+func (v *Validator) validate(w http.ResponseWriter, r *http.Request, path string, op *Operation, pathParams map[string]string) error {
+	query := r.URL.Query()
+	for _, param := range v.doc.Parameters(path, op) {
+		var value string
+		var present bool
+		switch param.In {
+		case "path":
+			value, present = pathParams[param.Name]
+		case "query":
+			value, present = query.Get(param.Name), query.Has(param.Name)
+		default:
+			continue
+		}
+
+		if !present || value == "" {
+			if param.Required {
+				return fmt.Errorf("%s is required", param.Name)
+			}
+			continue
+		}
+		if err := v.validateParameter(value, param.Schema); err != nil {
+			return fmt.Errorf("invalid %s: %w", param.Name, err)
+		}
+	}
+
+	if op.RequestBody == nil {
+		return nil
+	}
+	media, ok := op.RequestBody.Content["application/json"]
+	if !ok {
+		return nil
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		return fmt.Errorf("error reading request body: %w", err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		if op.RequestBody.Required {
+			return fmt.Errorf("request body is required")
+		}
+		return nil
+	}
+
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return fmt.Errorf("request body is not valid JSON: %w", err)
+	}
+	return v.ValidateValue(value, media.Schema, "body")
+}
+
+// validateParameter checks a path or query parameter, which is always a string on the wire
+func (v *Validator) validateParameter(value string, schema *Schema) error {
+	schema = v.doc.Resolve(schema)
+	if schema == nil {
+		return nil
+	}
+
+	switch schema.Type {
+	case "integer":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+		if schema.Minimum != nil && float64(n) < *schema.Minimum {
+			return fmt.Errorf("%d is less than %v", n, *schema.Minimum)
+		}
+	case "boolean":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("%q is not a boolean", value)
+		}
+	case "string":
+		return v.ValidateValue(value, schema, "value")
+	}
+	return nil
+}
+
+// ValidateValue checks a decoded JSON value against schema. Numbers must be
+// decoded as json.Number. where names the value in error messages.
+func (v *Validator) ValidateValue(value interface{}, schema *Schema, where string) error {
+	schema = v.doc.Resolve(schema)
+	if schema == nil {
+		return nil
+	}
+	if value == nil {
+		if schema.Nullable || schema.Type == "" {
+			return nil
+		}
+		return fmt.Errorf("%s must not be null", where)
+	}
+
+	switch schema.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s must be an object", where)
+		}
+		for _, name := range schema.Required {
+			if _, ok := object[name]; !ok {
+				return fmt.Errorf("%s is required", name)
+			}
+		}
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			property, ok := schema.Properties[name]
+			if !ok {
+				property = schema.AdditionalProperties
+			}
+			if property == nil {
+				continue
+			}
+			if err := v.ValidateValue(object[name], property, name); err != nil {
+				return err
+			}
+		}
+
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s must be an array", where)
+		}
+		for i, item := range array {
+			if err := v.ValidateValue(item, schema.Items, fmt.Sprintf("%s[%d]", where, i)); err != nil {
+				return err
+			}
+		}
+
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s must be a string", where)
+		}
+		if schema.MinLength != nil && len(strings.TrimSpace(s)) < *schema.MinLength {
+			return fmt.Errorf("%s must not be empty", where)
+		}
+
+	case "integer", "number":
+		n, ok := value.(json.Number)
+		if !ok {
+			return fmt.Errorf("%s must be a number", where)
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return fmt.Errorf("%s must be a number", where)
+		}
+		if schema.Type == "integer" {
+			if _, err := n.Int64(); err != nil {
+				return fmt.Errorf("%s must be an integer", where)
+			}
+		}
+		if schema.Minimum != nil && f < *schema.Minimum {
+			return fmt.Errorf("%s must be at least %v", where, *schema.Minimum)
+		}
+
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s must be true or false", where)
+		}
+	}
+
+	if len(schema.Enum) > 0 {
+		for _, allowed := range schema.Enum {
+			if fmt.Sprint(allowed) == fmt.Sprint(value) {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s must be one of %v", where, schema.Enum)
+	}
+	return nil
+}
@@ -0,0 +1,256 @@
+// Package auth logs users in, keeps their sessions and checks their role
+// before requests reach the handlers.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jimmitjoo/livestream-results/pkg/db"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Role decides what a user may do. Every role may do what the roles below it may.
+type Role string
+
+const (
+	// Speaker can only read, e.g. the speaker at the finish line
+	Speaker Role = "speaker"
+	// Operator runs the timing: watched files, participants and publishing
+	Operator Role = "operator"
+	// Admin also manages events, Google Sheets, users and API tokens
+	Admin Role = "admin"
+)
+
+// SessionCookie is the name of the cookie holding the session token
+const SessionCookie = "session"
+
+// sessionTTL is how long a login lasts
+const sessionTTL = 24 * time.Hour
+
+// ErrInvalidLogin is returned for an unknown username or a wrong password
+var ErrInvalidLogin = errors.New("invalid username or password")
+
+// ErrUnauthenticated is returned for requests without a valid session or API token
+var ErrUnauthenticated = errors.New("login required")
+
+var ranks = map[Role]int{Speaker: 1, Operator: 2, Admin: 3}
+
+// ParseRole checks that s names a role
+func ParseRole(s string) (Role, error) {
+	role := Role(s)
+	if _, ok := ranks[role]; !ok {
+		return "", fmt.Errorf("unknown role %q, must be admin, operator or speaker", s)
+	}
+	return role, nil
+}
+
+// Allows reports whether a user with role r may do what needs required
+func (r Role) Allows(required Role) bool {
+	return ranks[r] >= ranks[required]
+}
+
+// HashPassword hashes a password for storing
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("error hashing password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// NewToken creates a random token for a session or an integration
+func NewToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error creating token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// HashToken is how tokens are stored, so a copy of the database does not leak them
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+type contextKey struct{}
+
+// UserFrom returns the user a request was authenticated as
+func UserFrom(ctx context.Context) (db.User, bool) {
+	user, ok := ctx.Value(contextKey{}).(db.User)
+	return user, ok
+}
+
+// Authenticator finds the user behind a request from its session cookie or API token
+type Authenticator struct {
+	database *sql.DB
+}
+
+// New creates an Authenticator using the users, sessions and api_tokens tables
+func New(database *sql.DB) *Authenticator {
+	return &Authenticator{database: database}
+}
+
+// Bootstrap creates the user admin when there are no users, so the first login
+// is possible. Without a password a random one is created and returned.
+func (a *Authenticator) Bootstrap(password string) (string, error) {
+	count, err := db.CountUsers(a.database)
+	if err != nil || count > 0 {
+		return "", err
+	}
+
+	if password == "" {
+		token, err := NewToken()
+		if err != nil {
+			return "", err
+		}
+		password = token[:16]
+	}
+
+	hash, err := HashPassword(password)
+	if err != nil {
+		return "", err
+	}
+	if _, err := db.CreateUser(a.database, db.User{Username: "admin", Role: string(Admin), PasswordHash: hash}); err != nil {
+		return "", err
+	}
+	return password, nil
+}
+
+// Login checks a username and password and starts a session, returning its token
+func (a *Authenticator) Login(username, password string) (string, db.User, error) {
+	user, err := db.GetUserByUsername(a.database, username)
+	if errors.Is(err, db.ErrNotFound) {
+		return "", db.User{}, ErrInvalidLogin
+	}
+	if err != nil {
+		return "", db.User{}, err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return "", db.User{}, ErrInvalidLogin
+	}
+
+	token, err := NewToken()
+	if err != nil {
+		return "", db.User{}, err
+	}
+	if err := db.DeleteExpiredSessions(a.database); err != nil {
+		return "", db.User{}, err
+	}
+	if err := db.CreateSession(a.database, HashToken(token), user.UserID, time.Now().Add(sessionTTL)); err != nil {
+		return "", db.User{}, err
+	}
+
+	user.PasswordHash = ""
+	return token, user, nil
+}
+
+// Logout ends the session of a request, if it has one
+func (a *Authenticator) Logout(r *http.Request) error {
+	cookie, err := r.Cookie(SessionCookie)
+	if err != nil {
+		return nil
+	}
+	return db.DeleteSession(a.database, HashToken(cookie.Value))
+}
+
+// SetSessionCookie stores the session token in the browser
+func SetSessionCookie(w http.ResponseWriter, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(sessionTTL.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// ClearSessionCookie removes the session token from the browser
+func ClearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{Name: SessionCookie, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+}
+
+// User finds the user behind a request. An "Authorization: Bearer" header
+// holds an API token, otherwise the session cookie is used.
+func (a *Authenticator) User(r *http.Request) (db.User, error) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok {
+			return db.User{}, fmt.Errorf("authorization must be a bearer token: %w", ErrUnauthenticated)
+		}
+		return unauthenticated(db.GetAPITokenUser(a.database, HashToken(strings.TrimSpace(token))))
+	}
+
+	cookie, err := r.Cookie(SessionCookie)
+	if err != nil {
+		return db.User{}, ErrUnauthenticated
+	}
+	return unauthenticated(db.GetSessionUser(a.database, HashToken(cookie.Value)))
+}
+
+// unauthenticated turns an unknown token or session into ErrUnauthenticated
+func unauthenticated(user db.User, err error) (db.User, error) {
+	if errors.Is(err, db.ErrNotFound) {
+		return db.User{}, ErrUnauthenticated
+	}
+	return user, err
+}
+
+// Require lets a request through only for users with at least role
+func (a *Authenticator) Require(role Role, next http.HandlerFunc) http.HandlerFunc {
+	return a.RequireMethods(role, role, next)
+}
+
+// RequireMethods needs read for GET and HEAD requests and write for all others
+func (a *Authenticator) RequireMethods(read, write Role, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		role := write
+		if r.Method == "GET" || r.Method == "HEAD" {
+			role = read
+		}
+
+		user, err := a.User(r)
+		if errors.Is(err, ErrUnauthenticated) {
+			writeError(w, http.StatusUnauthorized, err)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if !Role(user.Role).Allows(role) {
+			writeError(w, http.StatusForbidden, fmt.Errorf("%s role required", role))
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, user)))
+	}
+}
+
+// RequireWrites leaves GET and HEAD requests public and needs write for all others
+func (a *Authenticator) RequireWrites(write Role, next http.HandlerFunc) http.HandlerFunc {
+	protected := a.Require(write, next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" || r.Method == "HEAD" {
+			next(w, r)
+			return
+		}
+		protected(w, r)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
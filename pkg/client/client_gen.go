@@ -0,0 +1,869 @@
+// Code generated by apigen from pkg/api/openapi.json. DO NOT EDIT.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// APIToken is the APIToken schema of the API
+type APIToken struct {
+	CreatedAt  string `json:"CreatedAt,omitempty"`
+	LastUsedAt string `json:"LastUsedAt,omitempty"`
+	Name       string `json:"Name,omitempty"`
+	Role       string `json:"Role,omitempty"`
+	TokenID    int    `json:"TokenID,omitempty"`
+	UserID     int    `json:"UserID,omitempty"`
+	Username   string `json:"Username,omitempty"`
+}
+
+// ClockAdjustRequest is the ClockAdjustRequest schema of the API
+type ClockAdjustRequest struct {
+	// Duration added to the clock, such as 1.5s or -2s
+	By string `json:"by"`
+}
+
+// ClockStartRequest is the ClockStartRequest schema of the API
+type ClockStartRequest struct {
+	// Wall clock time as 2006-01-02 15:04:05.000, default now
+	StartedAt string `json:"startedAt,omitempty"`
+}
+
+// Error is the Error schema of the API
+type Error struct {
+	Error string `json:"error"`
+}
+
+// Event is the Event schema of the API
+type Event struct {
+	Classes        []Event `json:"Classes,omitempty"`
+	Classification string  `json:"Classification,omitempty"`
+	Distance       int     `json:"Distance,omitempty"`
+	EventID        int     `json:"EventID,omitempty"`
+	EventName      string  `json:"EventName,omitempty"`
+	ParentEventID  int     `json:"ParentEventID,omitempty"`
+	StartTime      string  `json:"StartTime,omitempty"`
+}
+
+// EventRequest is the EventRequest schema of the API
+type EventRequest struct {
+	Classification string `json:"classification,omitempty"`
+	// Distance in meters
+	Distance      int    `json:"distance,omitempty"`
+	EventName     string `json:"eventName"`
+	ParentEventID int    `json:"parentEventID,omitempty"`
+	// Local time formatted as 2006-01-02 15:04:05
+	StartTime string `json:"startTime,omitempty"`
+}
+
+// GoogleSheetRequest is the GoogleSheetRequest schema of the API
+type GoogleSheetRequest struct {
+	Auth      string `json:"auth,omitempty"`
+	EventName string `json:"eventName,omitempty"`
+	SheetID   string `json:"sheetID"`
+	SheetName string `json:"sheetName,omitempty"`
+}
+
+// LiveAthlete is the LiveAthlete schema of the API
+type LiveAthlete struct {
+	Behind    string      `json:"behind,omitempty"`
+	BibNumber int         `json:"bibNumber,omitempty"`
+	Club      string      `json:"club,omitempty"`
+	EventID   int         `json:"eventID,omitempty"`
+	EventName string      `json:"eventName,omitempty"`
+	Name      string      `json:"name,omitempty"`
+	Position  int         `json:"position,omitempty"`
+	Splits    []LiveSplit `json:"splits,omitempty"`
+	Time      string      `json:"time,omitempty"`
+}
+
+// LiveClass is the LiveClass schema of the API
+type LiveClass struct {
+	Classification string `json:"classification,omitempty"`
+	Distance       int    `json:"distance,omitempty"`
+	EventID        int    `json:"eventID,omitempty"`
+	EventName      string `json:"eventName,omitempty"`
+	Finishers      int    `json:"finishers,omitempty"`
+	ParentEventID  int    `json:"parentEventID,omitempty"`
+	StartTime      string `json:"startTime,omitempty"`
+	Starters       int    `json:"starters,omitempty"`
+}
+
+// LiveEntry is the LiveEntry schema of the API
+type LiveEntry struct {
+	Behind    string `json:"behind,omitempty"`
+	BibNumber int    `json:"bibNumber,omitempty"`
+	Club      string `json:"club,omitempty"`
+	EventID   int    `json:"eventID,omitempty"`
+	EventName string `json:"eventName,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Position  int    `json:"position,omitempty"`
+	// Time since the start, or time of day when the start time is not set
+	Time string `json:"time,omitempty"`
+}
+
+// LiveSplit is the LiveSplit schema of the API
+type LiveSplit struct {
+	Checkpoint string `json:"checkpoint,omitempty"`
+	Lap        string `json:"lap,omitempty"`
+	Time       string `json:"time,omitempty"`
+	Timestamp  string `json:"timestamp,omitempty"`
+}
+
+// LoginRequest is the LoginRequest schema of the API
+type LoginRequest struct {
+	Password string `json:"password"`
+	Username string `json:"username"`
+}
+
+// NewAPIToken is the NewAPIToken schema of the API
+type NewAPIToken struct {
+	Name    string `json:"name,omitempty"`
+	Token   string `json:"token,omitempty"`
+	TokenID int    `json:"tokenID,omitempty"`
+}
+
+// NewWebhook A created webhook, the only time its secret is shown
+type NewWebhook struct {
+	Active    bool   `json:"active,omitempty"`
+	CreatedAt string `json:"createdAt,omitempty"`
+	// Race whose notifications are sent, 0 for all
+	EventID int `json:"eventID,omitempty"`
+	// Key of the HMAC-SHA256 signature in X-Signature-256
+	Secret string `json:"secret,omitempty"`
+	// Types of notifications sent, all when empty
+	Types     []string `json:"types,omitempty"`
+	Url       string   `json:"url,omitempty"`
+	WebhookID int      `json:"webhookID,omitempty"`
+}
+
+// Notification is the Notification schema of the API
+type Notification struct {
+	Body           string `json:"Body,omitempty"`
+	Channel        string `json:"Channel,omitempty"`
+	CreatedAt      string `json:"CreatedAt,omitempty"`
+	Error          string `json:"Error,omitempty"`
+	EventID        int    `json:"EventID,omitempty"`
+	NotificationID int    `json:"NotificationID,omitempty"`
+	ParticipantID  int    `json:"ParticipantID,omitempty"`
+	Recipient      string `json:"Recipient,omitempty"`
+	SentAt         string `json:"SentAt,omitempty"`
+	Status         string `json:"Status,omitempty"`
+	Subject        string `json:"Subject,omitempty"`
+}
+
+// OAuthStatus is the OAuthStatus schema of the API
+type OAuthStatus struct {
+	Available bool `json:"available,omitempty"`
+	Connected bool `json:"connected,omitempty"`
+}
+
+// Participant is the Participant schema of the API
+type Participant struct {
+	BibNumber      int    `json:"BibNumber,omitempty"`
+	Birthdate      string `json:"Birthdate,omitempty"`
+	Classification string `json:"Classification,omitempty"`
+	Club           string `json:"Club,omitempty"`
+	// Empty for speakers
+	Email         string `json:"Email,omitempty"`
+	EventID       int    `json:"EventID,omitempty"`
+	EventName     string `json:"EventName,omitempty"`
+	FirstName     string `json:"FirstName,omitempty"`
+	Gender        string `json:"Gender,omitempty"`
+	LastName      string `json:"LastName,omitempty"`
+	NotifyFinish  bool   `json:"NotifyFinish,omitempty"`
+	ParticipantID int    `json:"ParticipantID,omitempty"`
+	// Empty for speakers
+	Phone string `json:"Phone,omitempty"`
+}
+
+// ParticipantPage is the ParticipantPage schema of the API
+type ParticipantPage struct {
+	Limit        int           `json:"limit,omitempty"`
+	Offset       int           `json:"offset,omitempty"`
+	Participants []Participant `json:"participants,omitempty"`
+	Total        int           `json:"total,omitempty"`
+}
+
+// ParticipantRequest is the ParticipantRequest schema of the API
+type ParticipantRequest struct {
+	BibNumber int    `json:"bibNumber"`
+	Birthdate string `json:"birthdate,omitempty"`
+	Club      string `json:"club,omitempty"`
+	Email     string `json:"email,omitempty"`
+	EventID   int    `json:"eventID"`
+	FirstName string `json:"firstName"`
+	Gender    string `json:"gender,omitempty"`
+	LastName  string `json:"lastName"`
+	// Opt in to a message with time and placement at the finish, needs phone or email
+	NotifyFinish bool `json:"notifyFinish,omitempty"`
+	// Phone number for the finish SMS, e.g. +46701234567
+	Phone string `json:"phone,omitempty"`
+}
+
+// PublisherRequest is the PublisherRequest schema of the API
+type PublisherRequest struct {
+	Target string `json:"target"`
+	Type   string `json:"type"`
+}
+
+// PublisherStatus is the PublisherStatus schema of the API
+type PublisherStatus struct {
+	Failures    int       `json:"failures,omitempty"`
+	LastError   string    `json:"lastError,omitempty"`
+	LastErrorAt time.Time `json:"lastErrorAt,omitempty"`
+	LastSuccess time.Time `json:"lastSuccess,omitempty"`
+	Name        string    `json:"name,omitempty"`
+	Pending     int       `json:"pending,omitempty"`
+	Publishing  bool      `json:"publishing,omitempty"`
+}
+
+// RaceClock is the RaceClock schema of the API
+type RaceClock struct {
+	Elapsed    string `json:"elapsed,omitempty"`
+	ElapsedMs  int64  `json:"elapsedMs,omitempty"`
+	EventID    int    `json:"eventID,omitempty"`
+	Running    bool   `json:"running,omitempty"`
+	ServerTime string `json:"serverTime,omitempty"`
+	StartedAt  string `json:"startedAt,omitempty"`
+	StoppedAt  string `json:"stoppedAt,omitempty"`
+}
+
+// ResultRow is the ResultRow schema of the API
+type ResultRow struct {
+	BibNumber       int    `json:"BibNumber,omitempty"`
+	Birthdate       string `json:"Birthdate,omitempty"`
+	Classification  string `json:"Classification,omitempty"`
+	Club            string `json:"Club,omitempty"`
+	EventID         int    `json:"EventID,omitempty"`
+	EventName       string `json:"EventName,omitempty"`
+	FirstName       string `json:"FirstName,omitempty"`
+	LastName        string `json:"LastName,omitempty"`
+	OverallPosition int    `json:"OverallPosition,omitempty"`
+	Placement       *int   `json:"Placement,omitempty"`
+	Position        int    `json:"Position,omitempty"`
+	// Milliseconds since the start, null when the start is unknown
+	RaceTimeMs *int64 `json:"RaceTimeMs,omitempty"`
+	// Order within a photo finish, null unless one was decided
+	TieOrder  *int   `json:"TieOrder,omitempty"`
+	Timestamp string `json:"Timestamp,omitempty"`
+}
+
+// SpeakerBoard is the SpeakerBoard schema of the API
+type SpeakerBoard struct {
+	Approaching []SpeakerRunner   `json:"approaching,omitempty"`
+	Finished    []SpeakerFinisher `json:"finished,omitempty"`
+}
+
+// SpeakerFinisher is the SpeakerFinisher schema of the API
+type SpeakerFinisher struct {
+	BibNumber int    `json:"bibNumber,omitempty"`
+	Club      string `json:"club,omitempty"`
+	EventID   int    `json:"eventID,omitempty"`
+	EventName string `json:"eventName,omitempty"`
+	Finished  string `json:"finished,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Position  int    `json:"position,omitempty"`
+	Time      string `json:"time,omitempty"`
+}
+
+// SpeakerRunner is the SpeakerRunner schema of the API
+type SpeakerRunner struct {
+	BibNumber  int    `json:"bibNumber,omitempty"`
+	Checkpoint string `json:"checkpoint,omitempty"`
+	Club       string `json:"club,omitempty"`
+	EventID    int    `json:"eventID,omitempty"`
+	EventName  string `json:"eventName,omitempty"`
+	Name       string `json:"name,omitempty"`
+	Passed     string `json:"passed,omitempty"`
+	// Position at the checkpoint
+	Position int `json:"position,omitempty"`
+	// Predicted time of day at the finish
+	PredictedFinish string `json:"predictedFinish,omitempty"`
+	// Predicted race time
+	PredictedTime string `json:"predictedTime,omitempty"`
+}
+
+// StartListRequest is the StartListRequest schema of the API
+type StartListRequest struct {
+	ParticipantsSheetName string `json:"participantsSheetName"`
+	PrimaryEventName      string `json:"primaryEventName"`
+}
+
+// Tie is the Tie schema of the API
+type Tie struct {
+	PhotoPath string      `json:"PhotoPath,omitempty"`
+	Resolved  bool        `json:"Resolved,omitempty"`
+	Results   []ResultRow `json:"Results,omitempty"`
+	// The earliest finish time among the runners, which identifies the tie
+	Timestamp string `json:"Timestamp,omitempty"`
+}
+
+// TieEntry is the TieEntry schema of the API
+type TieEntry struct {
+	BibNumber int `json:"bibNumber"`
+	EventID   int `json:"eventID"`
+}
+
+// TieRequest is the TieRequest schema of the API
+type TieRequest struct {
+	// Every runner in the tie, first to last
+	Order []TieEntry `json:"order"`
+	// Path to the photo finish image
+	PhotoPath string `json:"photoPath,omitempty"`
+	// Timestamp of the tie as listed
+	Timestamp string `json:"timestamp"`
+}
+
+// TokenRequest is the TokenRequest schema of the API
+type TokenRequest struct {
+	Name   string `json:"name"`
+	UserID int    `json:"userID"`
+}
+
+// User is the User schema of the API
+type User struct {
+	Role     string `json:"Role,omitempty"`
+	UserID   int    `json:"UserID,omitempty"`
+	Username string `json:"Username,omitempty"`
+}
+
+// UserRequest is the UserRequest schema of the API
+type UserRequest struct {
+	Password string `json:"password,omitempty"`
+	Role     string `json:"role"`
+	Username string `json:"username"`
+}
+
+// WatchRequest is the WatchRequest schema of the API
+type WatchRequest struct {
+	FilePath string `json:"filePath"`
+}
+
+// WatcherStatus is the WatcherStatus schema of the API
+type WatcherStatus struct {
+	Errors    int       `json:"errors,omitempty"`
+	LastError string    `json:"lastError,omitempty"`
+	LastRead  time.Time `json:"lastRead,omitempty"`
+	Lines     int       `json:"lines,omitempty"`
+	Path      string    `json:"path,omitempty"`
+	StartedAt time.Time `json:"startedAt,omitempty"`
+	State     string    `json:"state,omitempty"`
+}
+
+// Webhook is the Webhook schema of the API
+type Webhook struct {
+	Active    bool   `json:"active,omitempty"`
+	CreatedAt string `json:"createdAt,omitempty"`
+	// Race whose notifications are sent, 0 for all
+	EventID int `json:"eventID,omitempty"`
+	// Types of notifications sent, all when empty
+	Types     []string `json:"types,omitempty"`
+	Url       string   `json:"url,omitempty"`
+	WebhookID int      `json:"webhookID,omitempty"`
+}
+
+// WebhookDelivery is the WebhookDelivery schema of the API
+type WebhookDelivery struct {
+	Attempts      int    `json:"Attempts,omitempty"`
+	CreatedAt     string `json:"CreatedAt,omitempty"`
+	DeliveredAt   string `json:"DeliveredAt,omitempty"`
+	DeliveryID    int    `json:"DeliveryID,omitempty"`
+	Error         string `json:"Error,omitempty"`
+	NextAttemptAt string `json:"NextAttemptAt,omitempty"`
+	// The JSON body as sent
+	Payload        string `json:"Payload,omitempty"`
+	ResponseStatus int    `json:"ResponseStatus,omitempty"`
+	Status         string `json:"Status,omitempty"`
+	Type           string `json:"Type,omitempty"`
+	WebhookID      int    `json:"WebhookID,omitempty"`
+}
+
+// WebhookRequest is the WebhookRequest schema of the API
+type WebhookRequest struct {
+	Active  bool `json:"active,omitempty"`
+	EventID int  `json:"eventID,omitempty"`
+	// Random when empty on create, unchanged when empty on update
+	Secret string   `json:"secret,omitempty"`
+	Types  []string `json:"types,omitempty"`
+	Url    string   `json:"url"`
+}
+
+// WebhookTest is the WebhookTest schema of the API
+type WebhookTest struct {
+	DeliveryID int `json:"deliveryID,omitempty"`
+}
+
+// ListClocks sends GET /api/clocks: List the race clocks
+func (c *Client) ListClocks(ctx context.Context) ([]RaceClock, error) {
+	var out []RaceClock
+	err := c.do(ctx, "GET", "/api/clocks", nil, nil, 200, &out)
+	return out, err
+}
+
+// GetClock sends GET /api/clocks/{id}: Get the clock of an event, or of its race for a class without its own
+func (c *Client) GetClock(ctx context.Context, id int) (RaceClock, error) {
+	var out RaceClock
+	err := c.do(ctx, "GET", fmt.Sprintf("/api/clocks/%v", url.PathEscape(fmt.Sprint(id))), nil, nil, 200, &out)
+	return out, err
+}
+
+// AdjustClock sends POST /api/clocks/{id}/adjust: Add a duration to the time on the clock of an event
+func (c *Client) AdjustClock(ctx context.Context, id int, body ClockAdjustRequest) (RaceClock, error) {
+	var out RaceClock
+	err := c.do(ctx, "POST", fmt.Sprintf("/api/clocks/%v/adjust", url.PathEscape(fmt.Sprint(id))), nil, body, 200, &out)
+	return out, err
+}
+
+// StartClock sends POST /api/clocks/{id}/start: Start or restart the clock of an event, now or at startedAt
+func (c *Client) StartClock(ctx context.Context, id int, body ClockStartRequest) (RaceClock, error) {
+	var out RaceClock
+	err := c.do(ctx, "POST", fmt.Sprintf("/api/clocks/%v/start", url.PathEscape(fmt.Sprint(id))), nil, body, 200, &out)
+	return out, err
+}
+
+// StopClock sends POST /api/clocks/{id}/stop: Stop the clock of an event
+func (c *Client) StopClock(ctx context.Context, id int) (RaceClock, error) {
+	var out RaceClock
+	err := c.do(ctx, "POST", fmt.Sprintf("/api/clocks/%v/stop", url.PathEscape(fmt.Sprint(id))), nil, nil, 200, &out)
+	return out, err
+}
+
+// ListEvents sends GET /api/events: List events
+func (c *Client) ListEvents(ctx context.Context) ([]Event, error) {
+	var out []Event
+	err := c.do(ctx, "GET", "/api/events", nil, nil, 200, &out)
+	return out, err
+}
+
+// CreateEvent sends POST /api/events: Create an event or a class of an event
+func (c *Client) CreateEvent(ctx context.Context, body EventRequest) (Event, error) {
+	var out Event
+	err := c.do(ctx, "POST", "/api/events", nil, body, 201, &out)
+	return out, err
+}
+
+// GetEvent sends GET /api/events/{id}: Get an event with its classes
+func (c *Client) GetEvent(ctx context.Context, id int) (Event, error) {
+	var out Event
+	err := c.do(ctx, "GET", fmt.Sprintf("/api/events/%v", url.PathEscape(fmt.Sprint(id))), nil, nil, 200, &out)
+	return out, err
+}
+
+// UpdateEvent sends PUT /api/events/{id}: Update an event
+func (c *Client) UpdateEvent(ctx context.Context, id int, body EventRequest) (Event, error) {
+	var out Event
+	err := c.do(ctx, "PUT", fmt.Sprintf("/api/events/%v", url.PathEscape(fmt.Sprint(id))), nil, body, 200, &out)
+	return out, err
+}
+
+// DeleteEventParams holds the query parameters of DeleteEvent
+type DeleteEventParams struct {
+	Cascade *bool
+}
+
+// DeleteEvent sends DELETE /api/events/{id}: Delete an event, with its classes, participants, reads and webhooks when cascade is true
+func (c *Client) DeleteEvent(ctx context.Context, id int, params DeleteEventParams) error {
+	query := url.Values{}
+	if params.Cascade != nil {
+		query.Set("cascade", fmt.Sprint(*params.Cascade))
+	}
+	return c.do(ctx, "DELETE", fmt.Sprintf("/api/events/%v", url.PathEscape(fmt.Sprint(id))), query, nil, 204, nil)
+}
+
+// GetLiveAthlete sends GET /api/live/athletes/{event}/{bib}: Get an athlete with all passages on the public site
+func (c *Client) GetLiveAthlete(ctx context.Context, event int, bib int) (LiveAthlete, error) {
+	var out LiveAthlete
+	err := c.do(ctx, "GET", fmt.Sprintf("/api/live/athletes/%v/%v", url.PathEscape(fmt.Sprint(event)), url.PathEscape(fmt.Sprint(bib))), nil, nil, 200, &out)
+	return out, err
+}
+
+// ListLiveClasses sends GET /api/live/classes: List races and classes on the public site
+func (c *Client) ListLiveClasses(ctx context.Context) ([]LiveClass, error) {
+	var out []LiveClass
+	err := c.do(ctx, "GET", "/api/live/classes", nil, nil, 200, &out)
+	return out, err
+}
+
+// GetLiveClassResults sends GET /api/live/classes/{id}: Get the results of a class on the public site
+func (c *Client) GetLiveClassResults(ctx context.Context, id int) ([]LiveEntry, error) {
+	var out []LiveEntry
+	err := c.do(ctx, "GET", fmt.Sprintf("/api/live/classes/%v", url.PathEscape(fmt.Sprint(id))), nil, nil, 200, &out)
+	return out, err
+}
+
+// ListLatestFinishersParams holds the query parameters of ListLatestFinishers
+type ListLatestFinishersParams struct {
+	Event *int
+}
+
+// ListLatestFinishers sends GET /api/live/latest: The latest finishers on the public site, newest first
+func (c *Client) ListLatestFinishers(ctx context.Context, params ListLatestFinishersParams) ([]LiveEntry, error) {
+	query := url.Values{}
+	if params.Event != nil {
+		query.Set("event", fmt.Sprint(*params.Event))
+	}
+	var out []LiveEntry
+	err := c.do(ctx, "GET", "/api/live/latest", query, nil, 200, &out)
+	return out, err
+}
+
+// SearchLiveParams holds the query parameters of SearchLive
+type SearchLiveParams struct {
+	Q *string
+}
+
+// SearchLive sends GET /api/live/search: Find athletes by bib number, name or club on the public site
+func (c *Client) SearchLive(ctx context.Context, params SearchLiveParams) ([]LiveEntry, error) {
+	query := url.Values{}
+	if params.Q != nil {
+		query.Set("q", fmt.Sprint(*params.Q))
+	}
+	var out []LiveEntry
+	err := c.do(ctx, "GET", "/api/live/search", query, nil, 200, &out)
+	return out, err
+}
+
+// Login sends POST /api/login: Log in and receive a session cookie
+func (c *Client) Login(ctx context.Context, body LoginRequest) (User, error) {
+	var out User
+	err := c.do(ctx, "POST", "/api/login", nil, body, 200, &out)
+	return out, err
+}
+
+// Logout sends POST /api/logout: End the session
+func (c *Client) Logout(ctx context.Context) error {
+	return c.do(ctx, "POST", "/api/logout", nil, nil, 204, nil)
+}
+
+// GetCurrentUser sends GET /api/me: Get the logged in user
+func (c *Client) GetCurrentUser(ctx context.Context) (User, error) {
+	var out User
+	err := c.do(ctx, "GET", "/api/me", nil, nil, 200, &out)
+	return out, err
+}
+
+// SearchParticipantsParams holds the query parameters of SearchParticipants
+type SearchParticipantsParams struct {
+	Q      *string
+	Event  *int
+	Limit  *int
+	Offset *int
+}
+
+// SearchParticipants sends GET /api/participants: Search participants by name, bib number or club
+func (c *Client) SearchParticipants(ctx context.Context, params SearchParticipantsParams) (ParticipantPage, error) {
+	query := url.Values{}
+	if params.Q != nil {
+		query.Set("q", fmt.Sprint(*params.Q))
+	}
+	if params.Event != nil {
+		query.Set("event", fmt.Sprint(*params.Event))
+	}
+	if params.Limit != nil {
+		query.Set("limit", fmt.Sprint(*params.Limit))
+	}
+	if params.Offset != nil {
+		query.Set("offset", fmt.Sprint(*params.Offset))
+	}
+	var out ParticipantPage
+	err := c.do(ctx, "GET", "/api/participants", query, nil, 200, &out)
+	return out, err
+}
+
+// CreateParticipant sends POST /api/participants: Register a participant
+func (c *Client) CreateParticipant(ctx context.Context, body ParticipantRequest) (Participant, error) {
+	var out Participant
+	err := c.do(ctx, "POST", "/api/participants", nil, body, 201, &out)
+	return out, err
+}
+
+// GetParticipant sends GET /api/participants/{id}: Get a participant
+func (c *Client) GetParticipant(ctx context.Context, id int) (Participant, error) {
+	var out Participant
+	err := c.do(ctx, "GET", fmt.Sprintf("/api/participants/%v", url.PathEscape(fmt.Sprint(id))), nil, nil, 200, &out)
+	return out, err
+}
+
+// UpdateParticipant sends PUT /api/participants/{id}: Update a participant, a new bib number or event moves its reads along
+func (c *Client) UpdateParticipant(ctx context.Context, id int, body ParticipantRequest) (Participant, error) {
+	var out Participant
+	err := c.do(ctx, "PUT", fmt.Sprintf("/api/participants/%v", url.PathEscape(fmt.Sprint(id))), nil, body, 200, &out)
+	return out, err
+}
+
+// DeleteParticipant sends DELETE /api/participants/{id}: Delete a participant, its reads are kept as unknown bibs
+func (c *Client) DeleteParticipant(ctx context.Context, id int) error {
+	return c.do(ctx, "DELETE", fmt.Sprintf("/api/participants/%v", url.PathEscape(fmt.Sprint(id))), nil, nil, 204, nil)
+}
+
+// ListParticipantNotifications sends GET /api/participants/{id}/notifications: List the finish notifications of a participant, newest first, operators only
+func (c *Client) ListParticipantNotifications(ctx context.Context, id int) ([]Notification, error) {
+	var out []Notification
+	err := c.do(ctx, "GET", fmt.Sprintf("/api/participants/%v/notifications", url.PathEscape(fmt.Sprint(id))), nil, nil, 200, &out)
+	return out, err
+}
+
+// ListResultsParams holds the query parameters of ListResults
+type ListResultsParams struct {
+	Event  *int
+	Limit  *int
+	Offset *int
+}
+
+// ListResults sends GET /api/results: List ranked results
+func (c *Client) ListResults(ctx context.Context, params ListResultsParams) ([]ResultRow, error) {
+	query := url.Values{}
+	if params.Event != nil {
+		query.Set("event", fmt.Sprint(*params.Event))
+	}
+	if params.Limit != nil {
+		query.Set("limit", fmt.Sprint(*params.Limit))
+	}
+	if params.Offset != nil {
+		query.Set("offset", fmt.Sprint(*params.Offset))
+	}
+	var out []ResultRow
+	err := c.do(ctx, "GET", "/api/results", query, nil, 200, &out)
+	return out, err
+}
+
+// GetSpeakerBoardParams holds the query parameters of GetSpeakerBoard
+type GetSpeakerBoardParams struct {
+	Minutes *int
+	EventID *int
+	Limit   *int
+}
+
+// GetSpeakerBoard sends GET /api/speaker: Runners approaching the finish and the latest finishers
+func (c *Client) GetSpeakerBoard(ctx context.Context, params GetSpeakerBoardParams) (SpeakerBoard, error) {
+	query := url.Values{}
+	if params.Minutes != nil {
+		query.Set("minutes", fmt.Sprint(*params.Minutes))
+	}
+	if params.EventID != nil {
+		query.Set("eventID", fmt.Sprint(*params.EventID))
+	}
+	if params.Limit != nil {
+		query.Set("limit", fmt.Sprint(*params.Limit))
+	}
+	var out SpeakerBoard
+	err := c.do(ctx, "GET", "/api/speaker", query, nil, 200, &out)
+	return out, err
+}
+
+// ListTies sends GET /api/ties: List runners who share a position overall, by race time when every result has one and by finish time otherwise
+func (c *Client) ListTies(ctx context.Context) ([]Tie, error) {
+	var out []Tie
+	err := c.do(ctx, "GET", "/api/ties", nil, nil, 200, &out)
+	return out, err
+}
+
+// ResolveTie sends PUT /api/ties: Decide the order of a tie from a photo finish, operators only
+func (c *Client) ResolveTie(ctx context.Context, body TieRequest) (Tie, error) {
+	var out Tie
+	err := c.do(ctx, "PUT", "/api/ties", nil, body, 200, &out)
+	return out, err
+}
+
+// ClearTieParams holds the query parameters of ClearTie
+type ClearTieParams struct {
+	Timestamp string
+}
+
+// ClearTie sends DELETE /api/ties: Remove the decided order of a tie so its runners share a position again, operators only
+func (c *Client) ClearTie(ctx context.Context, params ClearTieParams) error {
+	query := url.Values{}
+	query.Set("timestamp", fmt.Sprint(params.Timestamp))
+	return c.do(ctx, "DELETE", "/api/ties", query, nil, 204, nil)
+}
+
+// ListAPITokens sends GET /api/tokens: List API tokens, admin only
+func (c *Client) ListAPITokens(ctx context.Context) ([]APIToken, error) {
+	var out []APIToken
+	err := c.do(ctx, "GET", "/api/tokens", nil, nil, 200, &out)
+	return out, err
+}
+
+// CreateAPIToken sends POST /api/tokens: Create an API token acting as a user, admin only
+func (c *Client) CreateAPIToken(ctx context.Context, body TokenRequest) (NewAPIToken, error) {
+	var out NewAPIToken
+	err := c.do(ctx, "POST", "/api/tokens", nil, body, 201, &out)
+	return out, err
+}
+
+// DeleteAPIToken sends DELETE /api/tokens/{id}: Revoke an API token, admin only
+func (c *Client) DeleteAPIToken(ctx context.Context, id int) error {
+	return c.do(ctx, "DELETE", fmt.Sprintf("/api/tokens/%v", url.PathEscape(fmt.Sprint(id))), nil, nil, 204, nil)
+}
+
+// ListUsers sends GET /api/users: List users, admin only
+func (c *Client) ListUsers(ctx context.Context) ([]User, error) {
+	var out []User
+	err := c.do(ctx, "GET", "/api/users", nil, nil, 200, &out)
+	return out, err
+}
+
+// CreateUser sends POST /api/users: Create a user, admin only
+func (c *Client) CreateUser(ctx context.Context, body UserRequest) (User, error) {
+	var out User
+	err := c.do(ctx, "POST", "/api/users", nil, body, 201, &out)
+	return out, err
+}
+
+// UpdateUser sends PUT /api/users/{id}: Update a user, an empty password keeps the current one, admin only
+func (c *Client) UpdateUser(ctx context.Context, id int, body UserRequest) (User, error) {
+	var out User
+	err := c.do(ctx, "PUT", fmt.Sprintf("/api/users/%v", url.PathEscape(fmt.Sprint(id))), nil, body, 200, &out)
+	return out, err
+}
+
+// DeleteUser sends DELETE /api/users/{id}: Delete a user with its sessions and API tokens, admin only
+func (c *Client) DeleteUser(ctx context.Context, id int) error {
+	return c.do(ctx, "DELETE", fmt.Sprintf("/api/users/%v", url.PathEscape(fmt.Sprint(id))), nil, nil, 204, nil)
+}
+
+// ListWebhooks sends GET /api/webhooks: List webhooks, admin only
+func (c *Client) ListWebhooks(ctx context.Context) ([]Webhook, error) {
+	var out []Webhook
+	err := c.do(ctx, "GET", "/api/webhooks", nil, nil, 200, &out)
+	return out, err
+}
+
+// CreateWebhook sends POST /api/webhooks: Create a webhook, with a random secret unless one is given, admin only
+func (c *Client) CreateWebhook(ctx context.Context, body WebhookRequest) (NewWebhook, error) {
+	var out NewWebhook
+	err := c.do(ctx, "POST", "/api/webhooks", nil, body, 201, &out)
+	return out, err
+}
+
+// GetWebhook sends GET /api/webhooks/{id}: Get a webhook, admin only
+func (c *Client) GetWebhook(ctx context.Context, id int) (Webhook, error) {
+	var out Webhook
+	err := c.do(ctx, "GET", fmt.Sprintf("/api/webhooks/%v", url.PathEscape(fmt.Sprint(id))), nil, nil, 200, &out)
+	return out, err
+}
+
+// UpdateWebhook sends PUT /api/webhooks/{id}: Update a webhook, keeping its secret unless a new one is given, admin only
+func (c *Client) UpdateWebhook(ctx context.Context, id int, body WebhookRequest) (Webhook, error) {
+	var out Webhook
+	err := c.do(ctx, "PUT", fmt.Sprintf("/api/webhooks/%v", url.PathEscape(fmt.Sprint(id))), nil, body, 200, &out)
+	return out, err
+}
+
+// DeleteWebhook sends DELETE /api/webhooks/{id}: Delete a webhook and its delivery log, admin only
+func (c *Client) DeleteWebhook(ctx context.Context, id int) error {
+	return c.do(ctx, "DELETE", fmt.Sprintf("/api/webhooks/%v", url.PathEscape(fmt.Sprint(id))), nil, nil, 204, nil)
+}
+
+// ListWebhookDeliveriesParams holds the query parameters of ListWebhookDeliveries
+type ListWebhookDeliveriesParams struct {
+	Limit *int
+}
+
+// ListWebhookDeliveries sends GET /api/webhooks/{id}/deliveries: List the latest deliveries of a webhook, newest first, admin only
+func (c *Client) ListWebhookDeliveries(ctx context.Context, id int, params ListWebhookDeliveriesParams) ([]WebhookDelivery, error) {
+	query := url.Values{}
+	if params.Limit != nil {
+		query.Set("limit", fmt.Sprint(*params.Limit))
+	}
+	var out []WebhookDelivery
+	err := c.do(ctx, "GET", fmt.Sprintf("/api/webhooks/%v/deliveries", url.PathEscape(fmt.Sprint(id))), query, nil, 200, &out)
+	return out, err
+}
+
+// TestWebhook sends POST /api/webhooks/{id}/test: Send a test notification to a webhook, admin only
+func (c *Client) TestWebhook(ctx context.Context, id int) (WebhookTest, error) {
+	var out WebhookTest
+	err := c.do(ctx, "POST", fmt.Sprintf("/api/webhooks/%v/test", url.PathEscape(fmt.Sprint(id))), nil, nil, 202, &out)
+	return out, err
+}
+
+// SetGoogleSheet sends POST /google-sheets: Select the spreadsheet and tab results are published to
+func (c *Client) SetGoogleSheet(ctx context.Context, body GoogleSheetRequest) (string, error) {
+	var out string
+	err := c.do(ctx, "POST", "/google-sheets", nil, body, 200, &out)
+	return out, err
+}
+
+// ListAllParticipants sends GET /list-participants: List every participant, grouped by event name
+func (c *Client) ListAllParticipants(ctx context.Context) (map[string][]Participant, error) {
+	var out map[string][]Participant
+	err := c.do(ctx, "GET", "/list-participants", nil, nil, 200, &out)
+	return out, err
+}
+
+// GetOAuthStatusParams holds the query parameters of GetOAuthStatus
+type GetOAuthStatusParams struct {
+	Race *string
+}
+
+// GetOAuthStatus sends GET /oauth/status: Tell whether a race is connected to a Google account
+func (c *Client) GetOAuthStatus(ctx context.Context, params GetOAuthStatusParams) (OAuthStatus, error) {
+	query := url.Values{}
+	if params.Race != nil {
+		query.Set("race", fmt.Sprint(*params.Race))
+	}
+	var out OAuthStatus
+	err := c.do(ctx, "GET", "/oauth/status", query, nil, 200, &out)
+	return out, err
+}
+
+// GetPublishStatus sends GET /publish-status: Show the state of every publisher
+func (c *Client) GetPublishStatus(ctx context.Context) ([]PublisherStatus, error) {
+	var out []PublisherStatus
+	err := c.do(ctx, "GET", "/publish-status", nil, nil, 200, &out)
+	return out, err
+}
+
+// ListPublishers sends GET /publishers: List the names of the configured publishers
+func (c *Client) ListPublishers(ctx context.Context) ([]string, error) {
+	var out []string
+	err := c.do(ctx, "GET", "/publishers", nil, nil, 200, &out)
+	return out, err
+}
+
+// AddPublisher sends POST /publishers: Add a publisher
+func (c *Client) AddPublisher(ctx context.Context, body PublisherRequest) (string, error) {
+	var out string
+	err := c.do(ctx, "POST", "/publishers", nil, body, 200, &out)
+	return out, err
+}
+
+// ImportStartList sends POST /read-startlista: Import the start list from the selected spreadsheet
+func (c *Client) ImportStartList(ctx context.Context, body StartListRequest) ([][]interface{}, error) {
+	var out [][]interface{}
+	err := c.do(ctx, "POST", "/read-startlista", nil, body, 200, &out)
+	return out, err
+}
+
+// StartWatch sends POST /start-watch: Start watching a timing file
+func (c *Client) StartWatch(ctx context.Context, body WatchRequest) (string, error) {
+	var out string
+	err := c.do(ctx, "POST", "/start-watch", nil, body, 200, &out)
+	return out, err
+}
+
+// ListWatchers sends GET /watchers: List watched timing files
+func (c *Client) ListWatchers(ctx context.Context) ([]WatcherStatus, error) {
+	var out []WatcherStatus
+	err := c.do(ctx, "GET", "/watchers", nil, nil, 200, &out)
+	return out, err
+}
+
+// RestartWatch sends POST /watchers/restart: Restart watching a timing file
+func (c *Client) RestartWatch(ctx context.Context, body WatchRequest) (string, error) {
+	var out string
+	err := c.do(ctx, "POST", "/watchers/restart", nil, body, 200, &out)
+	return out, err
+}
+
+// StopWatch sends POST /watchers/stop: Stop watching a timing file
+func (c *Client) StopWatch(ctx context.Context, body WatchRequest) (string, error) {
+	var out string
+	err := c.do(ctx, "POST", "/watchers/stop", nil, body, 200, &out)
+	return out, err
+}
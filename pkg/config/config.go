@@ -0,0 +1,339 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the application settings. Values are read from, in increasing
+// order of precedence: built-in defaults, a JSON config file, LSR_* environment
+// variables and command line flags.
+type Config struct {
+	DBPath          string            `json:"dbPath"`
+	ListenAddr      string            `json:"listenAddr"`
+	CredentialsPath string            `json:"credentialsPath"`
+	OAuthClientPath string            `json:"oauthClientPath"`
+	TokenDir        string            `json:"tokenDir"`
+	SpreadsheetID   string            `json:"spreadsheetID"`
+	SheetName       string            `json:"sheetName"`
+	WatchFiles      []string          `json:"watchFiles"`
+	Publish         PublishConfig     `json:"publish"`
+	Publishers      []PublisherConfig `json:"publishers"`
+	AdminPassword   string            `json:"adminPassword"`
+	FinishAntenna   int               `json:"finishAntenna"`
+	OverlayDir      string            `json:"overlayDir"`
+	MQTT            MQTTConfig        `json:"mqtt"`
+	Notifications   NotifyConfig      `json:"notifications"`
+}
+
+// PublishConfig holds the settings shared by all result publishers
+type PublishConfig struct {
+	Interval Duration `json:"interval"`
+}
+
+// PublisherConfig describes an additional publisher, see publisher.New
+type PublisherConfig struct {
+	Type   string `json:"type"`
+	Target string `json:"target"`
+}
+
+// MQTTConfig holds the settings of the MQTT publisher, which is off without a
+// broker. Topics may contain {event}, the ID of the race or class, and an empty
+// topic turns off those messages.
+type MQTTConfig struct {
+	Broker   string     `json:"broker"`
+	ClientID string     `json:"clientID"`
+	Username string     `json:"username"`
+	Password string     `json:"password"`
+	QoS      int        `json:"qos"`
+	Topics   MQTTTopics `json:"topics"`
+}
+
+// MQTTTopics are the topics MQTT messages are published to
+type MQTTTopics struct {
+	Reads       string `json:"reads"`
+	Split       string `json:"split"`
+	Finish      string `json:"finish"`
+	Leaderboard string `json:"leaderboard"`
+}
+
+// NotifyConfig holds the settings of finish notifications to participants.
+// SMS is off without a gateway URL and email without an SMTP address, and Stub
+// sends both to the log instead. Templates are Go templates, see notify.Finish.
+type NotifyConfig struct {
+	Stub          bool             `json:"stub"`
+	RatePerMinute int              `json:"ratePerMinute"`
+	SMSTemplate   string           `json:"smsTemplate"`
+	EmailSubject  string           `json:"emailSubject"`
+	EmailTemplate string           `json:"emailTemplate"`
+	SMSGateway    SMSGatewayConfig `json:"smsGateway"`
+	SMTP          SMTPConfig       `json:"smtp"`
+}
+
+// SMSGatewayConfig is an HTTP gateway that SMS are posted to as JSON
+type SMSGatewayConfig struct {
+	URL   string `json:"url"`
+	Token string `json:"token"`
+	From  string `json:"from"`
+}
+
+// SMTPConfig is the server email is sent through
+type SMTPConfig struct {
+	Addr     string `json:"addr"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	From     string `json:"from"`
+}
+
+// Duration is a time.Duration written as a string such as "5s" in the config file
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"5s\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// defaultConfigPath is read when it exists and no other config file is given
+const defaultConfigPath = "config.json"
+
+// Default returns the built-in settings
+func Default() Config {
+	return Config{
+		DBPath:          "./race_timing.db",
+		ListenAddr:      ":8080",
+		CredentialsPath: "credentials.json",
+		OAuthClientPath: "oauth_client.json",
+		TokenDir:        "tokens",
+		Publish: PublishConfig{
+			Interval: Duration{5 * time.Second},
+		},
+		MQTT: MQTTConfig{
+			ClientID: "livestream-results",
+			QoS:      1,
+			Topics: MQTTTopics{
+				Reads:       "race/{event}/reads",
+				Split:       "race/{event}/split",
+				Finish:      "race/{event}/finish",
+				Leaderboard: "race/{event}/leaderboard",
+			},
+		},
+		Notifications: NotifyConfig{
+			RatePerMinute: 60,
+			SMSTemplate:   "Grattis {{.FirstName}}! Du gick i mål i {{.EventName}} på {{.Time}}{{if .Position}} och kom på plats {{.Position}}{{end}}.",
+			EmailSubject:  "Ditt resultat i {{.EventName}}",
+			EmailTemplate: "Hej {{.FirstName}}!\n\nDu gick i mål i {{.EventName}} med nummer {{.BibNumber}} på {{.Time}}{{if .Position}} och kom på plats {{.Position}}{{end}}.\n\nGrattis!",
+		},
+	}
+}
+
+// Load builds the configuration from the config file, the environment and args,
+// which are the command line arguments without the program name
+func Load(args []string) (Config, error) {
+	return LoadFlags(flag.NewFlagSet("livestream-results", flag.ContinueOnError), args)
+}
+
+// LoadFlags is Load with the settings' flags added to fs, so commands can have
+// flags and arguments of their own next to them
+func LoadFlags(fs *flag.FlagSet, args []string) (Config, error) {
+	cfg := Default()
+
+	configPath := fs.String("config", "", "path to a JSON config file (default config.json if it exists)")
+	dbPath := fs.String("db", "", "path to the SQLite database")
+	listenAddr := fs.String("listen", "", "address the HTTP server listens on")
+	credentialsPath := fs.String("credentials", "", "path to the Google service account credentials")
+	oauthClientPath := fs.String("oauth-client", "", "path to the Google OAuth client for connecting user accounts")
+	tokenDir := fs.String("token-dir", "", "directory where OAuth tokens are stored")
+	spreadsheetID := fs.String("spreadsheet", "", "ID of the Google Sheets spreadsheet")
+	sheetName := fs.String("sheet", "", "name of the overall results tab")
+	watchFiles := fs.String("watch", "", "comma separated timing files to watch on startup")
+	publishInterval := fs.Duration("publish-interval", 0, "shortest time between two pushes to a publisher")
+	overlayDir := fs.String("overlay-dir", "", "directory with overlay templates replacing the built-in ones")
+	finishAntenna := fs.Int("finish-antenna", 0, "antenna at the finish line, reads on other antennas are splits")
+	mqttBroker := fs.String("mqtt-broker", "", "MQTT broker to publish reads and results to, e.g. tcp://localhost:1883")
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+
+	path := *configPath
+	if path == "" {
+		path = os.Getenv("LSR_CONFIG")
+	}
+	if path == "" {
+		if _, err := os.Stat(defaultConfigPath); err == nil {
+			path = defaultConfigPath
+		}
+	}
+	if path != "" {
+		if err := loadFile(path, &cfg); err != nil {
+			return cfg, err
+		}
+	}
+
+	if err := loadEnv(&cfg); err != nil {
+		return cfg, err
+	}
+
+	// Only flags that were given override the file and environment
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "db":
+			cfg.DBPath = *dbPath
+		case "listen":
+			cfg.ListenAddr = *listenAddr
+		case "credentials":
+			cfg.CredentialsPath = *credentialsPath
+		case "oauth-client":
+			cfg.OAuthClientPath = *oauthClientPath
+		case "token-dir":
+			cfg.TokenDir = *tokenDir
+		case "spreadsheet":
+			cfg.SpreadsheetID = *spreadsheetID
+		case "sheet":
+			cfg.SheetName = *sheetName
+		case "watch":
+			cfg.WatchFiles = splitList(*watchFiles)
+		case "publish-interval":
+			cfg.Publish.Interval = Duration{*publishInterval}
+		case "finish-antenna":
+			cfg.FinishAntenna = *finishAntenna
+		case "overlay-dir":
+			cfg.OverlayDir = *overlayDir
+		case "mqtt-broker":
+			cfg.MQTT.Broker = *mqttBroker
+		}
+	})
+
+	return cfg, nil
+}
+
+// loadFile reads settings from a JSON file on top of cfg
+func loadFile(path string, cfg *Config) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading config file: %w", err)
+	}
+	if err := json.Unmarshal(b, cfg); err != nil {
+		return fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// loadEnv reads settings from LSR_* environment variables on top of cfg
+func loadEnv(cfg *Config) error {
+	if v, ok := os.LookupEnv("LSR_DB_PATH"); ok {
+		cfg.DBPath = v
+	}
+	if v, ok := os.LookupEnv("LSR_LISTEN_ADDR"); ok {
+		cfg.ListenAddr = v
+	}
+	if v, ok := os.LookupEnv("LSR_CREDENTIALS"); ok {
+		cfg.CredentialsPath = v
+	}
+	if v, ok := os.LookupEnv("LSR_OAUTH_CLIENT"); ok {
+		cfg.OAuthClientPath = v
+	}
+	if v, ok := os.LookupEnv("LSR_TOKEN_DIR"); ok {
+		cfg.TokenDir = v
+	}
+	if v, ok := os.LookupEnv("LSR_SPREADSHEET_ID"); ok {
+		cfg.SpreadsheetID = v
+	}
+	if v, ok := os.LookupEnv("LSR_SHEET_NAME"); ok {
+		cfg.SheetName = v
+	}
+	if v, ok := os.LookupEnv("LSR_WATCH_FILES"); ok {
+		cfg.WatchFiles = splitList(v)
+	}
+	if v, ok := os.LookupEnv("LSR_PUBLISH_INTERVAL"); ok {
+		interval, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("error parsing LSR_PUBLISH_INTERVAL: %w", err)
+		}
+		cfg.Publish.Interval = Duration{interval}
+	}
+	if v, ok := os.LookupEnv("LSR_ADMIN_PASSWORD"); ok {
+		cfg.AdminPassword = v
+	}
+	if v, ok := os.LookupEnv("LSR_FINISH_ANTENNA"); ok {
+		antenna, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("error parsing LSR_FINISH_ANTENNA: %w", err)
+		}
+		cfg.FinishAntenna = antenna
+	}
+	if v, ok := os.LookupEnv("LSR_OVERLAY_DIR"); ok {
+		cfg.OverlayDir = v
+	}
+	if v, ok := os.LookupEnv("LSR_MQTT_BROKER"); ok {
+		cfg.MQTT.Broker = v
+	}
+	if v, ok := os.LookupEnv("LSR_MQTT_USERNAME"); ok {
+		cfg.MQTT.Username = v
+	}
+	if v, ok := os.LookupEnv("LSR_MQTT_PASSWORD"); ok {
+		cfg.MQTT.Password = v
+	}
+	if v, ok := os.LookupEnv("LSR_MQTT_QOS"); ok {
+		qos, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("error parsing LSR_MQTT_QOS: %w", err)
+		}
+		cfg.MQTT.QoS = qos
+	}
+	if v, ok := os.LookupEnv("LSR_SMS_GATEWAY_TOKEN"); ok {
+		cfg.Notifications.SMSGateway.Token = v
+	}
+	if v, ok := os.LookupEnv("LSR_SMTP_PASSWORD"); ok {
+		cfg.Notifications.SMTP.Password = v
+	}
+	return nil
+}
+
+// splitList splits a comma separated list, dropping empty entries
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// HasCredentials reports whether the Google service account credentials file exists
+func (c Config) HasCredentials() bool {
+	return fileExists(c.CredentialsPath)
+}
+
+// HasOAuthClient reports whether the Google OAuth client file exists
+func (c Config) HasOAuthClient() bool {
+	return fileExists(c.OAuthClientPath)
+}
+
+func fileExists(path string) bool {
+	if path == "" {
+		return false
+	}
+	_, err := os.Stat(path)
+	return !errors.Is(err, os.ErrNotExist)
+}
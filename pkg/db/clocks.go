@@ -0,0 +1,222 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TimestampLayout is the format timestamps of reads and clocks are stored in,
+// the local wall clock time without a zone
+const TimestampLayout = "2006-01-02 15:04:05.000"
+
+// StartTimeLayout is the format of an event's start time
+const StartTimeLayout = "2006-01-02 15:04:05"
+
+// RaceClock is the clock of a race or class. StoppedAt is empty while it runs.
+type RaceClock struct {
+	EventID   int
+	StartedAt string
+	StoppedAt string
+}
+
+// WallClock returns t as it is stored: the local wall clock time read as UTC,
+// the same way timestamps of reads are parsed
+func WallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+// Elapsed is the time on the clock at now, which is a wall clock time
+func (c RaceClock) Elapsed(now time.Time) time.Duration {
+	started, err := time.Parse(TimestampLayout, c.StartedAt)
+	if err != nil {
+		return 0
+	}
+	if stopped, err := time.Parse(TimestampLayout, c.StoppedAt); err == nil {
+		now = stopped
+	}
+	if now.Before(started) {
+		return 0
+	}
+	return now.Sub(started)
+}
+
+// ListRaceClocks retrieves the clocks of all events that have one
+func ListRaceClocks(db *sql.DB) ([]RaceClock, error) {
+	rows, err := db.Query("SELECT event_id, started_at, COALESCE(stopped_at, '') FROM race_clocks ORDER BY event_id")
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving race clocks: %w", err)
+	}
+	defer rows.Close()
+
+	clocks := []RaceClock{}
+	for rows.Next() {
+		var clock RaceClock
+		if err := rows.Scan(&clock.EventID, &clock.StartedAt, &clock.StoppedAt); err != nil {
+			return nil, fmt.Errorf("error scanning race clock: %w", err)
+		}
+		clocks = append(clocks, clock)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error with rows: %w", err)
+	}
+
+	return clocks, nil
+}
+
+// GetRaceClock retrieves the clock of an event
+func GetRaceClock(db *sql.DB, eventID int) (RaceClock, error) {
+	clock := RaceClock{EventID: eventID}
+	err := db.QueryRow("SELECT started_at, COALESCE(stopped_at, '') FROM race_clocks WHERE event_id = ?", eventID).Scan(&clock.StartedAt, &clock.StoppedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return RaceClock{}, fmt.Errorf("clock of event %d: %w", eventID, ErrNotFound)
+	}
+	if err != nil {
+		return RaceClock{}, fmt.Errorf("error retrieving race clock: %w", err)
+	}
+	return clock, nil
+}
+
+// StartRaceClock starts the clock of an event at the wall clock time at,
+// restarting it if it already ran, and recomputes the race times of the reads
+func StartRaceClock(db *sql.DB, eventID int, at time.Time) error {
+	query := `INSERT INTO race_clocks (event_id, started_at, stopped_at) VALUES (?, ?, NULL)
+              ON CONFLICT (event_id) DO UPDATE SET started_at = excluded.started_at, stopped_at = NULL`
+	if _, err := db.Exec(query, eventID, at.Format(TimestampLayout)); err != nil {
+		return fmt.Errorf("error starting race clock: %w", err)
+	}
+	return RecomputeRaceTimes(db)
+}
+
+// StopRaceClock stops the clock of an event at the wall clock time at. The race
+// times of reads are not affected.
+func StopRaceClock(db *sql.DB, eventID int, at time.Time) error {
+	result, err := db.Exec("UPDATE race_clocks SET stopped_at = ? WHERE event_id = ?", at.Format(TimestampLayout), eventID)
+	if err != nil {
+		return fmt.Errorf("error stopping race clock: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("clock of event %d: %w", eventID, ErrNotFound)
+	}
+	return nil
+}
+
+// AdjustRaceClock adds by to the time on the clock of an event by moving its
+// start, and recomputes the race times of the reads
+func AdjustRaceClock(db *sql.DB, eventID int, by time.Duration) error {
+	clock, err := GetRaceClock(db, eventID)
+	if err != nil {
+		return err
+	}
+	started, err := time.Parse(TimestampLayout, clock.StartedAt)
+	if err != nil {
+		return fmt.Errorf("error parsing clock start: %w", err)
+	}
+
+	if _, err := db.Exec("UPDATE race_clocks SET started_at = ? WHERE event_id = ?", started.Add(-by).Format(TimestampLayout), eventID); err != nil {
+		return fmt.Errorf("error adjusting race clock: %w", err)
+	}
+	return RecomputeRaceTimes(db)
+}
+
+// StartTimes maps events to the zero of their race times: the start of the
+// event's clock, otherwise its start time. Classes without either start with
+// their race.
+func StartTimes(db *sql.DB) (map[int]time.Time, error) {
+	events, err := ListEvents(db)
+	if err != nil {
+		return nil, err
+	}
+	clocks, err := ListRaceClocks(db)
+	if err != nil {
+		return nil, err
+	}
+
+	starts := make(map[int]time.Time)
+	for _, event := range events {
+		if start, err := time.ParseInLocation(StartTimeLayout, event.StartTime, time.UTC); err == nil {
+			starts[event.EventID] = start
+		}
+	}
+	for _, clock := range clocks {
+		if start, err := time.Parse(TimestampLayout, clock.StartedAt); err == nil {
+			starts[clock.EventID] = start
+		}
+	}
+	for _, event := range events {
+		if _, ok := starts[event.EventID]; !ok && event.ParentEventID != 0 {
+			if start, ok := starts[event.ParentEventID]; ok {
+				starts[event.EventID] = start
+			}
+		}
+	}
+
+	return starts, nil
+}
+
+// RecomputeRaceTimes sets the race time of every read from the current start
+// times, e.g. after a clock was started or adjusted
+func RecomputeRaceTimes(db *sql.DB) error {
+	starts, err := StartTimes(db)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := recomputeRaceTimes(tx, starts); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing race times: %w", err)
+	}
+	return nil
+}
+
+// recomputeRaceTimes sets the race time of the reads of the given bib numbers,
+// or of every read when none are given, e.g. after they moved to another event
+func recomputeRaceTimes(tx *sql.Tx, starts map[int]time.Time, bibNumbers ...int) error {
+	clear := "UPDATE timing_results SET race_time_ms = NULL"
+	compute := `UPDATE timing_results
+                SET race_time_ms = CAST(ROUND((julianday(timestamp) - julianday(?)) * 86400000) AS INTEGER)
+                WHERE event_id = ? AND timestamp >= ?`
+	var bibs []interface{}
+	if len(bibNumbers) > 0 {
+		only := "bib_number IN (?" + strings.Repeat(",?", len(bibNumbers)-1) + ")"
+		clear += " WHERE " + only
+		compute += " AND " + only
+		for _, bibNumber := range bibNumbers {
+			bibs = append(bibs, bibNumber)
+		}
+	}
+
+	if _, err := tx.Exec(clear, bibs...); err != nil {
+		return fmt.Errorf("error clearing race times: %w", err)
+	}
+	for eventID, start := range starts {
+		args := append([]interface{}{start.Format(TimestampLayout), eventID, start.Format(TimestampLayout)}, bibs...)
+		if _, err := tx.Exec(compute, args...); err != nil {
+			return fmt.Errorf("error computing race times: %w", err)
+		}
+	}
+	return nil
+}
+
+// raceTime is the race time of a read at timestamp, nil before the start or
+// when the start is unknown
+func raceTime(starts map[int]time.Time, eventID int, timestamp time.Time) *int64 {
+	start, ok := starts[eventID]
+	if !ok || timestamp.Before(start) {
+		return nil
+	}
+	ms := timestamp.Sub(start).Milliseconds()
+	return &ms
+}
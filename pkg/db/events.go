@@ -0,0 +1,182 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNotFound is returned when a requested row does not exist
+var ErrNotFound = errors.New("not found")
+
+// ErrHasDependents is returned when deleting a row that other rows still refer to
+var ErrHasDependents = errors.New("has dependent rows")
+
+// Event is a race or one of its classes. Classes have the race as parent.
+type Event struct {
+	EventID        int
+	EventName      string
+	ParentEventID  int
+	Classification string
+	StartTime      string
+	Distance       int
+	Classes        []Event `json:",omitempty"`
+}
+
+const eventColumns = `event_id, event_name, COALESCE(parent_event_id, 0), COALESCE(classification, ''), COALESCE(start_time, ''), COALESCE(distance, 0)`
+
+func scanEvent(row interface{ Scan(...interface{}) error }) (Event, error) {
+	var event Event
+	err := row.Scan(&event.EventID, &event.EventName, &event.ParentEventID, &event.Classification, &event.StartTime, &event.Distance)
+	return event, err
+}
+
+// ListEvents retrieves all events, races before their classes
+func ListEvents(db *sql.DB) ([]Event, error) {
+	return queryEvents(db, "SELECT "+eventColumns+" FROM events ORDER BY COALESCE(parent_event_id, 0), event_id")
+}
+
+// GetEvent retrieves an event together with its classes
+func GetEvent(db *sql.DB, eventID int) (Event, error) {
+	event, err := scanEvent(db.QueryRow("SELECT "+eventColumns+" FROM events WHERE event_id = ?", eventID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Event{}, fmt.Errorf("event %d: %w", eventID, ErrNotFound)
+	}
+	if err != nil {
+		return Event{}, fmt.Errorf("error retrieving event: %w", err)
+	}
+
+	event.Classes, err = queryEvents(db, "SELECT "+eventColumns+" FROM events WHERE parent_event_id = ? ORDER BY event_id", eventID)
+	if err != nil {
+		return Event{}, err
+	}
+
+	return event, nil
+}
+
+func queryEvents(db *sql.DB, query string, args ...interface{}) ([]Event, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning event: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error with rows: %w", err)
+	}
+
+	return events, nil
+}
+
+// InsertEvent creates an event with all its details and returns its ID
+func InsertEvent(db *sql.DB, event Event) (int, error) {
+	query := `INSERT INTO events (event_name, parent_event_id, classification, start_time, distance) VALUES (?, ?, ?, ?, ?)`
+	result, err := db.Exec(query, event.EventName, event.ParentEventID, event.Classification, nullString(event.StartTime), event.Distance)
+	if err != nil {
+		return 0, fmt.Errorf("error creating event: %w", err)
+	}
+
+	eventID, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error getting last insert ID: %w", err)
+	}
+
+	return int(eventID), nil
+}
+
+// UpdateEvent stores the name, classification, start time and distance of an
+// event. Race times of reads follow a changed start time.
+func UpdateEvent(db *sql.DB, event Event) error {
+	query := `UPDATE events SET event_name = ?, classification = ?, start_time = ?, distance = ? WHERE event_id = ?`
+	result, err := db.Exec(query, event.EventName, event.Classification, nullString(event.StartTime), event.Distance, event.EventID)
+	if err != nil {
+		return fmt.Errorf("error updating event: %w", err)
+	}
+
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("event %d: %w", event.EventID, ErrNotFound)
+	}
+	return RecomputeRaceTimes(db)
+}
+
+// DeleteEvent deletes an event and its clock. An event with classes, participants,
+// timing results or webhooks is only deleted when cascade is set, and then they
+// are deleted with it, together with photo finish orders and notifications.
+func DeleteEvent(db *sql.DB, eventID int, cascade bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM events WHERE event_id = ?", eventID).Scan(&exists); err != nil {
+		return fmt.Errorf("error retrieving event: %w", err)
+	}
+	if exists == 0 {
+		return fmt.Errorf("event %d: %w", eventID, ErrNotFound)
+	}
+
+	// The event and its classes
+	eventIDs := []interface{}{eventID}
+	rows, err := tx.Query("SELECT event_id FROM events WHERE parent_event_id = ?", eventID)
+	if err != nil {
+		return fmt.Errorf("error retrieving classes: %w", err)
+	}
+	for rows.Next() {
+		var classID int
+		if err := rows.Scan(&classID); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning class: %w", err)
+		}
+		eventIDs = append(eventIDs, classID)
+	}
+	rows.Close()
+
+	placeholders := "?" + strings.Repeat(",?", len(eventIDs)-1)
+
+	if !cascade {
+		var dependents int
+		query := `SELECT (SELECT COUNT(*) FROM participants WHERE event_id IN (` + placeholders + `))
+                       + (SELECT COUNT(*) FROM timing_results WHERE event_id IN (` + placeholders + `))
+                       + (SELECT COUNT(*) FROM webhooks WHERE event_id IN (` + placeholders + `))`
+		if err := tx.QueryRow(query, append(append(eventIDs, eventIDs...), eventIDs...)...).Scan(&dependents); err != nil {
+			return fmt.Errorf("error counting dependents: %w", err)
+		}
+		if dependents > 0 || len(eventIDs) > 1 {
+			return fmt.Errorf("event %d: %w", eventID, ErrHasDependents)
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM webhook_deliveries WHERE webhook_id IN (SELECT webhook_id FROM webhooks WHERE event_id IN ("+placeholders+"))", eventIDs...); err != nil {
+		return fmt.Errorf("error deleting from webhook_deliveries: %w", err)
+	}
+	for _, table := range []string{"webhooks", "notifications", "tie_breaks", "timing_results", "participants", "race_clocks", "events"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE event_id IN ("+placeholders+")", eventIDs...); err != nil {
+			return fmt.Errorf("error deleting from %s: %w", table, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing delete: %w", err)
+	}
+	return nil
+}
+
+// nullString stores empty strings as NULL
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,89 @@
+package db_test
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"github.com/jimmitjoo/livestream-results/pkg/db"
+	"github.com/jimmitjoo/livestream-results/pkg/parser"
+	"github.com/jimmitjoo/livestream-results/pkg/replay"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// BenchmarkIngestReads stores a timing file of about 100 000 lines for a race
+// where every runner is on the start list
+func BenchmarkIngestReads(b *testing.B) {
+	const runners = 14000
+	start := time.Date(2024, 5, 4, 10, 0, 0, 0, time.UTC)
+	list := make([]replay.Runner, runners)
+	for i := range list {
+		list[i] = replay.Runner{BibNumber: i + 1, Start: start, Distance: 10000}
+	}
+
+	var file bytes.Buffer
+	lines, err := replay.Generate(&file, list, replay.GenerateOptions{
+		Splits:     4,
+		Pace:       4*time.Minute + 30*time.Second,
+		Spread:     0.15,
+		MissRate:   0.02,
+		Duplicates: 1,
+		DNFRate:    0.01,
+		Seed:       1,
+	})
+	if err != nil {
+		b.Fatalf("generating reads: %v", err)
+	}
+	timingPath := filepath.Join(b.TempDir(), "timing.txt")
+	if err := os.WriteFile(timingPath, file.Bytes(), 0644); err != nil {
+		b.Fatal(err)
+	}
+	results, err := parser.ParseTimingFile(timingPath)
+	if err != nil {
+		b.Fatalf("parsing reads: %v", err)
+	}
+	database := setupRace(b, filepath.Join(b.TempDir(), "race.db"), start, runners)
+	defer database.Close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		if _, err := database.Exec("DELETE FROM timing_results"); err != nil {
+			b.Fatalf("deleting reads: %v", err)
+		}
+		b.StartTimer()
+
+		reads, err := db.IngestReads(database, results)
+		if err != nil {
+			b.Fatalf("IngestReads: %v", err)
+		}
+		if len(reads) == 0 {
+			b.Fatal("no reads stored")
+		}
+	}
+	b.ReportMetric(float64(lines), "lines/op")
+}
+
+// setupRace creates a database with one race that starts at start and runners
+// numbered from 1
+func setupRace(b *testing.B, path string, start time.Time, runners int) *sql.DB {
+	b.Helper()
+	database, err := db.SetupDatabase(path)
+	if err != nil {
+		b.Fatalf("SetupDatabase: %v", err)
+	}
+
+	eventID, err := db.InsertEvent(database, db.Event{EventName: "Mila", StartTime: start.Format(db.StartTimeLayout), Distance: 10000})
+	if err != nil {
+		b.Fatalf("InsertEvent: %v", err)
+	}
+	for bibNumber := 1; bibNumber <= runners; bibNumber++ {
+		participant := db.Participant{BibNumber: bibNumber, FirstName: "Löpare", LastName: fmt.Sprint(bibNumber), Gender: "M", Birthdate: "1990"}
+		if err := db.InsertParticipant(database, participant, eventID); err != nil {
+			b.Fatalf("InsertParticipant: %v", err)
+		}
+	}
+	return database
+}
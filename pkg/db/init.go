@@ -4,12 +4,25 @@ import (
 	"database/sql"
 	"fmt"
 	_ "github.com/mattn/go-sqlite3"
+	"strings"
 )
 
+// connectionOptions puts the database in WAL mode, so readers never block the
+// ingestion, and syncs every commit to disk so accepted reads survive a crash.
+// Transactions take the write lock when they begin: one that reads before it
+// writes could otherwise fail at once with "database is locked" when another
+// connection wrote meanwhile, without waiting for the busy timeout.
+const connectionOptions = "_journal_mode=WAL&_synchronous=FULL&_busy_timeout=5000&_txlock=immediate"
+
 // SetupDatabase initializes the database and creates necessary tables
-func SetupDatabase() (*sql.DB, error) {
+func SetupDatabase(path string) (*sql.DB, error) {
+	dsn := path + "?" + connectionOptions
+	if strings.Contains(path, "?") {
+		dsn = path + "&" + connectionOptions
+	}
+
 	// Connect to the database (creates the database file if it doesn't exist)
-	db, err := sql.Open("sqlite3", "./race_timing.db")
+	db, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("error connecting to the database: %w", err)
 	}
@@ -23,6 +36,15 @@ func SetupDatabase() (*sql.DB, error) {
 	return db, nil
 }
 
+// Checkpoint writes the WAL file back into the database file, so the database
+// is self-contained after shutdown
+func Checkpoint(db *sql.DB) error {
+	if _, err := db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		return fmt.Errorf("error checkpointing database: %w", err)
+	}
+	return nil
+}
+
 // createTables creates the necessary tables in the database
 func createTables(db *sql.DB) error {
 	// Create events table
@@ -37,6 +59,14 @@ func createTables(db *sql.DB) error {
 		return fmt.Errorf("error creating events table: %w", err)
 	}
 
+	// Columns added after the first release
+	if err := addColumn(db, "events", "start_time", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumn(db, "events", "distance", "INTEGER"); err != nil {
+		return err
+	}
+
 	// Create participants table
 	participantsTable := `CREATE TABLE IF NOT EXISTS participants (
         participant_id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -71,5 +101,188 @@ func createTables(db *sql.DB) error {
 		return fmt.Errorf("error creating timing_results table: %w", err)
 	}
 
+	// Contact details for finish notifications, which participants opt in to
+	if err := addColumn(db, "participants", "phone", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumn(db, "participants", "email", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumn(db, "participants", "notify_finish", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// Milliseconds since the start of the event, see RecomputeRaceTimes
+	if err := addColumn(db, "timing_results", "race_time_ms", "INTEGER"); err != nil {
+		return err
+	}
+
+	// Create watch_sources table
+	watchSourcesTable := `CREATE TABLE IF NOT EXISTS watch_sources (
+        path TEXT PRIMARY KEY,
+        active INTEGER NOT NULL DEFAULT 1
+    );`
+	if _, err := db.Exec(watchSourcesTable); err != nil {
+		return fmt.Errorf("error creating watch_sources table: %w", err)
+	}
+
+	// Create users table
+	usersTable := `CREATE TABLE IF NOT EXISTS users (
+        user_id INTEGER PRIMARY KEY AUTOINCREMENT,
+        username TEXT NOT NULL UNIQUE,
+        password_hash TEXT NOT NULL,
+        role TEXT NOT NULL
+    );`
+	if _, err := db.Exec(usersTable); err != nil {
+		return fmt.Errorf("error creating users table: %w", err)
+	}
+
+	// Create sessions table, tokens are stored as SHA-256 hashes
+	sessionsTable := `CREATE TABLE IF NOT EXISTS sessions (
+        token_hash TEXT PRIMARY KEY,
+        user_id INTEGER NOT NULL,
+        expires_at TEXT NOT NULL,
+        FOREIGN KEY (user_id) REFERENCES users(user_id)
+    );`
+	if _, err := db.Exec(sessionsTable); err != nil {
+		return fmt.Errorf("error creating sessions table: %w", err)
+	}
+
+	// Create api_tokens table, tokens are stored as SHA-256 hashes
+	apiTokensTable := `CREATE TABLE IF NOT EXISTS api_tokens (
+        token_id INTEGER PRIMARY KEY AUTOINCREMENT,
+        name TEXT NOT NULL,
+        token_hash TEXT NOT NULL UNIQUE,
+        user_id INTEGER NOT NULL,
+        created_at TEXT NOT NULL,
+        last_used_at TEXT,
+        FOREIGN KEY (user_id) REFERENCES users(user_id)
+    );`
+	if _, err := db.Exec(apiTokensTable); err != nil {
+		return fmt.Errorf("error creating api_tokens table: %w", err)
+	}
+
+	// Create race_clocks table, times are local wall clock times like timestamps of reads
+	raceClocksTable := `CREATE TABLE IF NOT EXISTS race_clocks (
+        event_id INTEGER PRIMARY KEY,
+        started_at TEXT NOT NULL,
+        stopped_at TEXT,
+        FOREIGN KEY (event_id) REFERENCES events(event_id)
+    );`
+	if _, err := db.Exec(raceClocksTable); err != nil {
+		return fmt.Errorf("error creating race_clocks table: %w", err)
+	}
+
+	// Create webhooks table, types is a comma separated list, empty for all
+	webhooksTable := `CREATE TABLE IF NOT EXISTS webhooks (
+        webhook_id INTEGER PRIMARY KEY AUTOINCREMENT,
+        event_id INTEGER,
+        url TEXT NOT NULL,
+        secret TEXT NOT NULL,
+        types TEXT NOT NULL DEFAULT '',
+        active INTEGER NOT NULL DEFAULT 1,
+        created_at TEXT NOT NULL
+    );`
+	if _, err := db.Exec(webhooksTable); err != nil {
+		return fmt.Errorf("error creating webhooks table: %w", err)
+	}
+
+	// Create webhook_deliveries table, the delivery log and the queue of pending deliveries
+	webhookDeliveriesTable := `CREATE TABLE IF NOT EXISTS webhook_deliveries (
+        delivery_id INTEGER PRIMARY KEY AUTOINCREMENT,
+        webhook_id INTEGER NOT NULL,
+        type TEXT NOT NULL,
+        payload TEXT NOT NULL,
+        status TEXT NOT NULL,
+        attempts INTEGER NOT NULL DEFAULT 0,
+        next_attempt_at TEXT,
+        response_status INTEGER,
+        error TEXT,
+        created_at TEXT NOT NULL,
+        delivered_at TEXT,
+        FOREIGN KEY (webhook_id) REFERENCES webhooks(webhook_id)
+    );`
+	if _, err := db.Exec(webhookDeliveriesTable); err != nil {
+		return fmt.Errorf("error creating webhook_deliveries table: %w", err)
+	}
+	// Due deliveries are found by comparing next_attempt_at as text, which only
+	// follows time order in one zone. Times stored with a local offset move to UTC.
+	if _, err := db.Exec(`UPDATE webhook_deliveries SET next_attempt_at = strftime('%Y-%m-%dT%H:%M:%fZ', next_attempt_at)
+                          WHERE next_attempt_at IS NOT NULL AND next_attempt_at NOT LIKE '%Z'`); err != nil {
+		return fmt.Errorf("error moving webhook delivery times to UTC: %w", err)
+	}
+
+	// Create notifications table, the log and queue of messages to participants.
+	// A participant gets one finish message per event and channel.
+	notificationsTable := `CREATE TABLE IF NOT EXISTS notifications (
+        notification_id INTEGER PRIMARY KEY AUTOINCREMENT,
+        participant_id INTEGER NOT NULL,
+        event_id INTEGER NOT NULL,
+        channel TEXT NOT NULL,
+        recipient TEXT NOT NULL,
+        subject TEXT NOT NULL DEFAULT '',
+        body TEXT NOT NULL,
+        status TEXT NOT NULL,
+        error TEXT,
+        created_at TEXT NOT NULL,
+        sent_at TEXT,
+        UNIQUE (participant_id, event_id, channel)
+    );`
+	if _, err := db.Exec(notificationsTable); err != nil {
+		return fmt.Errorf("error creating notifications table: %w", err)
+	}
+
+	// Create tie_breaks table, the order of runners who share a finish time or
+	// race time as decided from a photo finish. It holds while the runner's
+	// first read is timestamp.
+	tieBreaksTable := `CREATE TABLE IF NOT EXISTS tie_breaks (
+        bib_number INTEGER NOT NULL,
+        event_id INTEGER NOT NULL,
+        timestamp TEXT NOT NULL,
+        tie_order INTEGER NOT NULL,
+        photo_path TEXT,
+        created_at TEXT NOT NULL,
+        PRIMARY KEY (bib_number, event_id)
+    );`
+	if _, err := db.Exec(tieBreaksTable); err != nil {
+		return fmt.Errorf("error creating tie_breaks table: %w", err)
+	}
+
+	// The tie a decision belongs to, see Tie. Ties used to be of one finish
+	// time, so older decisions belong to the tie at their timestamp.
+	if err := addColumn(db, "tie_breaks", "tie_timestamp", "TEXT"); err != nil {
+		return err
+	}
+	if _, err := db.Exec("UPDATE tie_breaks SET tie_timestamp = timestamp WHERE tie_timestamp IS NULL"); err != nil {
+		return fmt.Errorf("error migrating tie_breaks: %w", err)
+	}
+
+	return nil
+}
+
+// addColumn adds a column to an existing table unless it is already there
+func addColumn(db *sql.DB, table string, column string, definition string) error {
+	rows, err := db.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return fmt.Errorf("error reading columns of %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return fmt.Errorf("error scanning column of %s: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error with rows: %w", err)
+	}
+
+	if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("error adding %s to %s: %w", column, table, err)
+	}
 	return nil
 }
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Notification is a message to a participant and the outcome of sending it.
+// Channel is sms or email and Recipient the phone number or address.
+type Notification struct {
+	NotificationID int
+	ParticipantID  int
+	EventID        int
+	Channel        string
+	Recipient      string
+	Subject        string
+	Body           string
+	Status         string
+	Error          string
+	CreatedAt      string
+	SentAt         string
+}
+
+// Statuses of a notification
+const (
+	NotificationPending = "pending"
+	NotificationSent    = "sent"
+	NotificationFailed  = "failed"
+)
+
+const notificationColumns = `notification_id, participant_id, event_id, channel, recipient, subject, body, status,
+       COALESCE(error, ''), created_at, COALESCE(sent_at, '')`
+
+// CreateNotification queues a notification to be sent. A participant gets one
+// notification per event and channel, so false is returned without an error
+// when there already is one.
+func CreateNotification(db *sql.DB, n Notification) (int, bool, error) {
+	result, err := db.Exec(`INSERT OR IGNORE INTO notifications (participant_id, event_id, channel, recipient, subject, body, status, created_at)
+                            VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		n.ParticipantID, n.EventID, n.Channel, n.Recipient, n.Subject, n.Body, NotificationPending, time.Now().Format(timeLayout))
+	if err != nil {
+		return 0, false, fmt.Errorf("error creating notification: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, false, fmt.Errorf("error creating notification: %w", err)
+	}
+	if affected == 0 {
+		return 0, false, nil
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, false, fmt.Errorf("error retrieving notification ID: %w", err)
+	}
+	return int(id), true, nil
+}
+
+// ListNotifications retrieves the notifications of a participant, newest first
+func ListNotifications(db *sql.DB, participantID int) ([]Notification, error) {
+	return queryNotifications(db, "SELECT "+notificationColumns+" FROM notifications WHERE participant_id = ? ORDER BY notification_id DESC", participantID)
+}
+
+// PendingNotifications retrieves notifications that are still to be sent, oldest first
+func PendingNotifications(db *sql.DB, limit int) ([]Notification, error) {
+	return queryNotifications(db, "SELECT "+notificationColumns+" FROM notifications WHERE status = ? ORDER BY notification_id LIMIT ?", NotificationPending, limit)
+}
+
+// RecordNotification stores the outcome of sending a notification
+func RecordNotification(db *sql.DB, n Notification) error {
+	var sentAt interface{}
+	if n.Status == NotificationSent {
+		sentAt = time.Now().Format(timeLayout)
+	}
+	if _, err := db.Exec("UPDATE notifications SET status = ?, error = NULLIF(?, ''), sent_at = ? WHERE notification_id = ?",
+		n.Status, n.Error, sentAt, n.NotificationID); err != nil {
+		return fmt.Errorf("error updating notification: %w", err)
+	}
+	return nil
+}
+
+func queryNotifications(db *sql.DB, query string, args ...interface{}) ([]Notification, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving notifications: %w", err)
+	}
+	defer rows.Close()
+
+	notifications := []Notification{}
+	for rows.Next() {
+		var n Notification
+		if err := rows.Scan(&n.NotificationID, &n.ParticipantID, &n.EventID, &n.Channel, &n.Recipient, &n.Subject, &n.Body, &n.Status,
+			&n.Error, &n.CreatedAt, &n.SentAt); err != nil {
+			return nil, fmt.Errorf("error scanning notification: %w", err)
+		}
+		notifications = append(notifications, n)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error with rows: %w", err)
+	}
+
+	return notifications, nil
+}
@@ -0,0 +1,246 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/mattn/go-sqlite3"
+	"strconv"
+)
+
+// ErrDuplicate is returned when a row conflicts with a unique constraint
+var ErrDuplicate = errors.New("already exists")
+
+// ParticipantQuery selects participants. Search matches the bib number exactly
+// or is a substring of the name or club. A zero EventID matches all events and
+// a zero Limit returns all rows.
+type ParticipantQuery struct {
+	Search  string
+	EventID int
+	Limit   int
+	Offset  int
+}
+
+const participantColumns = `participants.participant_id, participants.bib_number, participants.first_name, participants.last_name,
+       participants.gender, participants.birthdate, COALESCE(participants.club, ''), COALESCE(participants.classification, ''),
+       participants.event_id, COALESCE(events.event_name, ''), COALESCE(participants.phone, ''), COALESCE(participants.email, ''),
+       participants.notify_finish`
+
+func scanParticipant(row interface{ Scan(...interface{}) error }) (Participant, error) {
+	var p Participant
+	err := row.Scan(&p.ParticipantID, &p.BibNumber, &p.FirstName, &p.LastName, &p.Gender, &p.Birthdate, &p.Club, &p.Classification, &p.EventID, &p.EventName, &p.Phone, &p.Email, &p.NotifyFinish)
+	return p, err
+}
+
+// SearchParticipants retrieves a page of participants matching q, ordered by bib
+// number, together with the total number of matches
+func SearchParticipants(db *sql.DB, q ParticipantQuery) ([]Participant, int, error) {
+	where := "WHERE (? = 0 OR participants.event_id = ?)"
+	args := []interface{}{q.EventID, q.EventID}
+	if q.Search != "" {
+		like := "%" + q.Search + "%"
+		bibNumber, err := strconv.Atoi(q.Search)
+		if err != nil {
+			bibNumber = -1
+		}
+		where += ` AND (participants.bib_number = ?
+                   OR participants.first_name || ' ' || participants.last_name LIKE ?
+                   OR participants.club LIKE ?)`
+		args = append(args, bibNumber, like, like)
+	}
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM participants "+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("error counting participants: %w", err)
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = -1
+	}
+	query := "SELECT " + participantColumns + ` FROM participants
+    LEFT JOIN events ON events.event_id = participants.event_id ` + where + `
+    ORDER BY participants.bib_number, participants.participant_id
+    LIMIT ? OFFSET ?`
+
+	rows, err := db.Query(query, append(args, limit, q.Offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error retrieving participants: %w", err)
+	}
+	defer rows.Close()
+
+	participants := []Participant{}
+	for rows.Next() {
+		participant, err := scanParticipant(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("error scanning participant: %w", err)
+		}
+		participants = append(participants, participant)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error with rows: %w", err)
+	}
+
+	return participants, total, nil
+}
+
+// GetParticipant retrieves a participant by ID
+func GetParticipant(db *sql.DB, participantID int) (Participant, error) {
+	query := "SELECT " + participantColumns + ` FROM participants
+    LEFT JOIN events ON events.event_id = participants.event_id
+    WHERE participants.participant_id = ?`
+
+	participant, err := scanParticipant(db.QueryRow(query, participantID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Participant{}, fmt.Errorf("participant %d: %w", participantID, ErrNotFound)
+	}
+	if err != nil {
+		return Participant{}, fmt.Errorf("error retrieving participant: %w", err)
+	}
+	return participant, nil
+}
+
+// CreateParticipant registers a participant in participant.EventID and links
+// any reads already stored for the bib number to that event, with race times
+// from its start
+func CreateParticipant(db *sql.DB, participant Participant) (int, error) {
+	starts, err := StartTimes(db)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO participants (event_id, bib_number, first_name, last_name, gender, birthdate, club, classification, phone, email, notify_finish)
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := tx.Exec(query, participant.EventID, participant.BibNumber, participant.FirstName, participant.LastName, participant.Gender, participant.Birthdate, participant.Club, participant.Classification,
+		participant.Phone, participant.Email, participant.NotifyFinish)
+	if err != nil {
+		return 0, participantError(err, participant)
+	}
+
+	participantID, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error getting last insert ID: %w", err)
+	}
+
+	// Reads of a late registration may already be in, stored without event
+	if _, err := tx.Exec("UPDATE timing_results SET event_id = ? WHERE bib_number = ? AND event_id = 0", participant.EventID, participant.BibNumber); err != nil {
+		return 0, fmt.Errorf("error linking timing results: %w", err)
+	}
+	if err := recomputeRaceTimes(tx, starts, participant.BibNumber); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing participant: %w", err)
+	}
+	return int(participantID), nil
+}
+
+// UpdateParticipant stores changes to a participant. When the bib number or
+// event changes, the participant's reads follow to the new event, with race
+// times from its start, and reads of the old bib number are no longer
+// attributed to anyone.
+func UpdateParticipant(db *sql.DB, participant Participant) error {
+	starts, err := StartTimes(db)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var oldBibNumber, oldEventID int
+	err = tx.QueryRow("SELECT bib_number, event_id FROM participants WHERE participant_id = ?", participant.ParticipantID).Scan(&oldBibNumber, &oldEventID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("participant %d: %w", participant.ParticipantID, ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("error retrieving participant: %w", err)
+	}
+
+	query := `UPDATE participants SET event_id = ?, bib_number = ?, first_name = ?, last_name = ?, gender = ?, birthdate = ?, club = ?, classification = ?,
+              phone = ?, email = ?, notify_finish = ?
+              WHERE participant_id = ?`
+	_, err = tx.Exec(query, participant.EventID, participant.BibNumber, participant.FirstName, participant.LastName, participant.Gender, participant.Birthdate, participant.Club, participant.Classification,
+		participant.Phone, participant.Email, participant.NotifyFinish, participant.ParticipantID)
+	if err != nil {
+		return participantError(err, participant)
+	}
+
+	if oldBibNumber != participant.BibNumber || oldEventID != participant.EventID {
+		if oldBibNumber != participant.BibNumber {
+			if _, err := tx.Exec("UPDATE OR IGNORE timing_results SET event_id = 0 WHERE bib_number = ? AND event_id = ?", oldBibNumber, oldEventID); err != nil {
+				return fmt.Errorf("error unlinking timing results: %w", err)
+			}
+		}
+		if _, err := tx.Exec("UPDATE OR IGNORE timing_results SET event_id = ? WHERE bib_number = ? AND event_id IN (0, ?)", participant.EventID, participant.BibNumber, oldEventID); err != nil {
+			return fmt.Errorf("error moving timing results: %w", err)
+		}
+		if err := recomputeRaceTimes(tx, starts, oldBibNumber, participant.BibNumber); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing participant: %w", err)
+	}
+	return nil
+}
+
+// DeleteParticipant removes a participant. Their reads are kept without event
+// and without race time.
+func DeleteParticipant(db *sql.DB, participantID int) error {
+	starts, err := StartTimes(db)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var bibNumber, eventID int
+	err = tx.QueryRow("SELECT bib_number, event_id FROM participants WHERE participant_id = ?", participantID).Scan(&bibNumber, &eventID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("participant %d: %w", participantID, ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("error retrieving participant: %w", err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM participants WHERE participant_id = ?", participantID); err != nil {
+		return fmt.Errorf("error deleting participant: %w", err)
+	}
+	if _, err := tx.Exec("UPDATE OR IGNORE timing_results SET event_id = 0 WHERE bib_number = ? AND event_id = ?", bibNumber, eventID); err != nil {
+		return fmt.Errorf("error unlinking timing results: %w", err)
+	}
+	if err := recomputeRaceTimes(tx, starts, bibNumber); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing delete: %w", err)
+	}
+	return nil
+}
+
+// participantError turns a UNIQUE constraint violation into ErrDuplicate
+func participantError(err error, participant Participant) error {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrConstraint {
+		return fmt.Errorf("bib number %d in event %d: %w", participant.BibNumber, participant.EventID, ErrDuplicate)
+	}
+	return fmt.Errorf("error saving participant: %w", err)
+}
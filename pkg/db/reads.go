@@ -0,0 +1,122 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Read is one stored chip read, a passage of a bib at an antenna
+type Read struct {
+	BibNumber  int
+	EventID    int
+	Timestamp  string
+	AntennaRow *int
+	Antenna    *int
+	RaceTimeMs *int64
+}
+
+// IsFinish reports whether a read is at the finish antenna. Zero means every
+// read is a finish, and reads without an antenna cannot be told apart and
+// count as finishes. resultsQuery selects finishes the same way.
+func IsFinish(read Read, finishAntenna int) bool {
+	return finishAntenna == 0 || read.Antenna == nil || *read.Antenna == finishAntenna
+}
+
+// EachRead calls fn for every read, ordered by bib number and time
+func EachRead(db *sql.DB, fn func(Read) error) error {
+	rows, err := db.Query(`SELECT bib_number, event_id, timestamp, antenna_row, antenna, race_time_ms
+                           FROM timing_results
+                           ORDER BY bib_number, event_id, timestamp`)
+	if err != nil {
+		return fmt.Errorf("error retrieving reads: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var read Read
+		if err := rows.Scan(&read.BibNumber, &read.EventID, &read.Timestamp, &read.AntennaRow, &read.Antenna, &read.RaceTimeMs); err != nil {
+			return fmt.Errorf("error scanning read: %w", err)
+		}
+		if err := fn(read); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error with rows: %w", err)
+	}
+
+	return nil
+}
+
+// passageChunk is how many bib numbers Passages looks up per query, well below
+// SQLite's limit on parameters
+const passageChunk = 500
+
+// passageKey is a bib at an antenna in an event. Antenna -1 stands for reads
+// without an antenna.
+type passageKey struct {
+	bibNumber int
+	eventID   int
+	antenna   int
+}
+
+func passageKeyOf(read Read) passageKey {
+	key := passageKey{bibNumber: read.BibNumber, eventID: read.EventID, antenna: -1}
+	if read.Antenna != nil {
+		key.antenna = *read.Antenna
+	}
+	return key
+}
+
+// Passages returns the reads that are the first of their bib at their antenna
+// in their event. Later reads of the same passage, which readers send several
+// of, are left out. The first reads are looked up a chunk of bib numbers at a
+// time rather than per read, as batches can hold a whole timing file.
+func Passages(db *sql.DB, reads []Read) ([]Read, error) {
+	var bibNumbers []interface{}
+	seen := make(map[int]bool)
+	for _, read := range reads {
+		if !seen[read.BibNumber] {
+			seen[read.BibNumber] = true
+			bibNumbers = append(bibNumbers, read.BibNumber)
+		}
+	}
+
+	first := make(map[passageKey]string)
+	for start := 0; start < len(bibNumbers); start += passageChunk {
+		end := start + passageChunk
+		if end > len(bibNumbers) {
+			end = len(bibNumbers)
+		}
+		chunk := bibNumbers[start:end]
+		rows, err := db.Query(`SELECT bib_number, event_id, antenna, MIN(timestamp) FROM timing_results
+                               WHERE bib_number IN (?`+strings.Repeat(",?", len(chunk)-1)+`)
+                               GROUP BY bib_number, event_id, antenna`, chunk...)
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving first reads: %w", err)
+		}
+		for rows.Next() {
+			var read Read
+			if err := rows.Scan(&read.BibNumber, &read.EventID, &read.Antenna, &read.Timestamp); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("error scanning first read: %w", err)
+			}
+			first[passageKeyOf(read)] = read.Timestamp
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error with rows: %w", err)
+		}
+	}
+
+	var passages []Read
+	for _, read := range reads {
+		if first[passageKeyOf(read)] == read.Timestamp {
+			passages = append(passages, read)
+		}
+	}
+	return passages, nil
+}
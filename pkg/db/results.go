@@ -0,0 +1,131 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// ResultRow is a participant's result: their first finish read in their event,
+// ranked within the event and overall
+type ResultRow struct {
+	Position        int
+	OverallPosition int
+	BibNumber       int
+	FirstName       string
+	LastName        string
+	Club            string
+	Birthdate       string
+	EventID         int
+	EventName       string
+	Classification  string
+	Timestamp       string
+	RaceTimeMs      *int64
+	Placement       *int
+	// TieOrder is the order within a photo finish when one was decided, see ResolveTie
+	TieOrder *int
+}
+
+// ResultQuery selects which results to return. A zero EventID returns all
+// events and a zero Limit returns all rows.
+type ResultQuery struct {
+	EventID int
+	Limit   int
+	Offset  int
+	// FinishAntenna is the antenna at the finish line, see IsFinish
+	FinishAntenna int
+}
+
+// resultsQuery ranks the first finish read of every bib within its event and overall.
+// Classes may start at different times, so the overall ranking is by race time
+// when every result has one and by time of day otherwise. Ties share the same
+// position unless a photo finish decided their order, see Ties, and a runner
+// who joins a decided tie later comes after those in it. The order counts in
+// both rankings, but only while the first read is still the one it was
+// decided for.
+const resultsQuery = `
+WITH finishes AS (
+    SELECT bib_number, event_id, MIN(timestamp) AS timestamp, MIN(race_time_ms) AS race_time_ms, MIN(placement) AS placement
+    FROM timing_results
+    WHERE ? = 0 OR antenna IS NULL OR antenna = ?
+    GROUP BY bib_number, event_id
+),
+decided AS (
+    SELECT finishes.*, tie_breaks.tie_order
+    FROM finishes
+    LEFT JOIN tie_breaks ON tie_breaks.bib_number = finishes.bib_number AND tie_breaks.event_id = finishes.event_id
+                        AND tie_breaks.timestamp = finishes.timestamp
+),
+timed AS (
+    SELECT COUNT(*) = COUNT(race_time_ms) AS all_timed FROM decided
+),
+ranked AS (
+    SELECT decided.*,
+           RANK() OVER (PARTITION BY event_id ORDER BY timestamp, tie_order IS NULL, tie_order) AS position,
+           RANK() OVER (ORDER BY CASE WHEN timed.all_timed THEN race_time_ms ELSE timestamp END, tie_order IS NULL, tie_order) AS overall_position
+    FROM decided, timed
+)
+SELECT ranked.position,
+       ranked.overall_position,
+       ranked.bib_number,
+       COALESCE(participants.first_name, ''),
+       COALESCE(participants.last_name, ''),
+       COALESCE(participants.club, ''),
+       COALESCE(participants.birthdate, ''),
+       ranked.event_id,
+       COALESCE(events.event_name, ''),
+       COALESCE(events.classification, ''),
+       ranked.timestamp,
+       ranked.race_time_ms,
+       ranked.placement,
+       ranked.tie_order
+FROM ranked
+LEFT JOIN participants ON participants.bib_number = ranked.bib_number AND participants.event_id = ranked.event_id
+LEFT JOIN events ON events.event_id = ranked.event_id
+WHERE ? = 0 OR ranked.event_id = ?
+ORDER BY ranked.timestamp, ranked.tie_order IS NULL, ranked.tie_order, ranked.bib_number
+LIMIT ? OFFSET ?
+`
+
+// EachResult streams the results selected by q to fn, in order of finish time.
+// It stops at the first error returned by fn.
+func EachResult(db *sql.DB, q ResultQuery, fn func(ResultRow) error) error {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = -1
+	}
+
+	rows, err := db.Query(resultsQuery, q.FinishAntenna, q.FinishAntenna, q.EventID, q.EventID, limit, q.Offset)
+	if err != nil {
+		return fmt.Errorf("error retrieving results: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var result ResultRow
+		if err := rows.Scan(&result.Position, &result.OverallPosition, &result.BibNumber, &result.FirstName, &result.LastName, &result.Club, &result.Birthdate, &result.EventID, &result.EventName, &result.Classification, &result.Timestamp, &result.RaceTimeMs, &result.Placement, &result.TieOrder); err != nil {
+			return fmt.Errorf("error scanning result: %w", err)
+		}
+		if err := fn(result); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error with rows: %w", err)
+	}
+
+	return nil
+}
+
+// GetResults retrieves the results selected by q, in order of finish time
+func GetResults(db *sql.DB, q ResultQuery) ([]ResultRow, error) {
+	var results []ResultRow
+	err := EachResult(db, q, func(result ResultRow) error {
+		results = append(results, result)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,157 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Tie is a group of results that share a position overall: the same race time,
+// down to the millisecond, when every result has one and the same finish time
+// otherwise, see GetResults. It is known by the earliest finish time among its
+// runners, is resolved once a photo finish decided the order, and Results are
+// in that order.
+type Tie struct {
+	Timestamp string
+	Resolved  bool
+	PhotoPath string
+	Results   []ResultRow
+}
+
+// TieEntry is a runner in a tie, by bib number and event
+type TieEntry struct {
+	BibNumber int
+	EventID   int
+}
+
+// Ties finds all groups of results that share a position overall, in order of
+// the overall ranking. finishAntenna selects the finish reads, see IsFinish.
+func Ties(db *sql.DB, finishAntenna int) ([]Tie, error) {
+	results, err := GetResults(db, ResultQuery{FinishAntenna: finishAntenna})
+	if err != nil {
+		return nil, err
+	}
+
+	// The overall ranking is by race time only when every result has one
+	timed := true
+	for _, result := range results {
+		timed = timed && result.RaceTimeMs != nil
+	}
+	shared := func(a, b ResultRow) bool {
+		if timed {
+			return *a.RaceTimeMs == *b.RaceTimeMs
+		}
+		return a.Timestamp == b.Timestamp
+	}
+
+	// In overall order a tie is a run of results that share the time ranked by
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].OverallPosition < results[j].OverallPosition
+	})
+	ties := []Tie{}
+	for start := 0; start < len(results); {
+		end := start + 1
+		for end < len(results) && shared(results[end], results[start]) {
+			end++
+		}
+		if end-start > 1 {
+			tie := Tie{Timestamp: results[start].Timestamp, Resolved: true, Results: results[start:end]}
+			for _, result := range tie.Results {
+				if result.Timestamp < tie.Timestamp {
+					tie.Timestamp = result.Timestamp
+				}
+				tie.Resolved = tie.Resolved && result.TieOrder != nil
+			}
+			ties = append(ties, tie)
+		}
+		start = end
+	}
+	if len(ties) == 0 {
+		return ties, nil
+	}
+
+	photos, err := tiePhotos(db)
+	if err != nil {
+		return nil, err
+	}
+	for i := range ties {
+		ties[i].PhotoPath = photos[ties[i].Timestamp]
+	}
+	return ties, nil
+}
+
+// tiePhotos returns the photo finish image of every decided tie by timestamp
+func tiePhotos(db *sql.DB) (map[string]string, error) {
+	rows, err := db.Query("SELECT tie_timestamp, MAX(COALESCE(photo_path, '')) FROM tie_breaks GROUP BY tie_timestamp")
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving photo finishes: %w", err)
+	}
+	defer rows.Close()
+
+	photos := make(map[string]string)
+	for rows.Next() {
+		var timestamp, photoPath string
+		if err := rows.Scan(&timestamp, &photoPath); err != nil {
+			return nil, fmt.Errorf("error scanning photo finish: %w", err)
+		}
+		photos[timestamp] = photoPath
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error with rows: %w", err)
+	}
+
+	return photos, nil
+}
+
+// ResolveTie stores the order of the runners in tie, first to last, with an
+// optional path to the photo finish image. It replaces an earlier decision for
+// the same tie.
+func ResolveTie(db *sql.DB, tie Tie, order []TieEntry, photoPath string) error {
+	// Each order holds while the runner's first read is the one in the tie
+	finished := make(map[TieEntry]string)
+	for _, result := range tie.Results {
+		finished[TieEntry{BibNumber: result.BibNumber, EventID: result.EventID}] = result.Timestamp
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM tie_breaks WHERE tie_timestamp = ?", tie.Timestamp); err != nil {
+		return fmt.Errorf("error clearing photo finish: %w", err)
+	}
+	now := time.Now().Format(timeLayout)
+	for i, entry := range order {
+		timestamp, ok := finished[entry]
+		if !ok {
+			return fmt.Errorf("bib number %d in event %d is not in the tie at %s: %w", entry.BibNumber, entry.EventID, tie.Timestamp, ErrNotFound)
+		}
+		// A runner's order in an older tie no longer applies
+		if _, err := tx.Exec(`INSERT OR REPLACE INTO tie_breaks (bib_number, event_id, timestamp, tie_timestamp, tie_order, photo_path, created_at)
+                              VALUES (?, ?, ?, ?, ?, NULLIF(?, ''), ?)`, entry.BibNumber, entry.EventID, timestamp, tie.Timestamp, i+1, photoPath, now); err != nil {
+			return fmt.Errorf("error storing photo finish: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing photo finish: %w", err)
+	}
+	return nil
+}
+
+// ClearTie removes the decided order of the tie at timestamp, so its runners
+// share a position again
+func ClearTie(db *sql.DB, timestamp string) error {
+	result, err := db.Exec("DELETE FROM tie_breaks WHERE tie_timestamp = ?", timestamp)
+	if err != nil {
+		return fmt.Errorf("error clearing photo finish: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("photo finish at %s: %w", timestamp, ErrNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package db_test
+
+import (
+	"database/sql"
+	"github.com/jimmitjoo/livestream-results/pkg/db"
+	"github.com/jimmitjoo/livestream-results/pkg/parser"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// positions returns the class and overall position of every bib number
+func positions(t *testing.T, database *sql.DB) map[int][2]int {
+	t.Helper()
+	results, err := db.GetResults(database, db.ResultQuery{})
+	if err != nil {
+		t.Fatalf("GetResults: %v", err)
+	}
+	positions := make(map[int][2]int)
+	for _, result := range results {
+		positions[result.BibNumber] = [2]int{result.Position, result.OverallPosition}
+	}
+	return positions
+}
+
+func TestTiesOnRaceTimeAcrossClasses(t *testing.T) {
+	database := setupDatabase(t, filepath.Join(t.TempDir(), "race.db"))
+
+	// H21 starts at 10:00 and D21 five minutes later
+	start := time.Date(2024, 5, 4, 10, 0, 0, 0, time.UTC)
+	classes := []struct {
+		name    string
+		start   time.Time
+		runners []int
+	}{
+		{"Mila H21", start, []int{1, 3}},
+		{"Mila D21", start.Add(5 * time.Minute), []int{2}},
+	}
+	for _, class := range classes {
+		eventID, err := db.InsertEvent(database, db.Event{EventName: class.name, StartTime: class.start.Format(db.StartTimeLayout)})
+		if err != nil {
+			t.Fatalf("InsertEvent: %v", err)
+		}
+		for _, bibNumber := range class.runners {
+			if err := db.InsertParticipant(database, db.Participant{BibNumber: bibNumber}, eventID); err != nil {
+				t.Fatalf("InsertParticipant: %v", err)
+			}
+		}
+	}
+
+	// Bibs 1 and 2 both run 35:00, bib 3 finishes with bib 2 in 40:00
+	reads := []parser.TimingResult{
+		{BibNumber: 1, Timestamp: start.Add(35 * time.Minute)},
+		{BibNumber: 2, Timestamp: start.Add(40 * time.Minute)},
+		{BibNumber: 3, Timestamp: start.Add(40 * time.Minute)},
+	}
+	if _, err := db.IngestReads(database, reads); err != nil {
+		t.Fatalf("IngestReads: %v", err)
+	}
+
+	ties, err := db.Ties(database, 0)
+	if err != nil {
+		t.Fatalf("Ties: %v", err)
+	}
+	if len(ties) != 1 || len(ties[0].Results) != 2 || ties[0].Resolved {
+		t.Fatalf("ties = %+v, want bibs 1 and 2 undecided", ties)
+	}
+	tie := ties[0]
+	if tie.Timestamp != tie.Results[0].Timestamp || tie.Results[0].BibNumber != 1 {
+		t.Errorf("tie at %s, want at the finish of bib 1", tie.Timestamp)
+	}
+	if got := positions(t, database); got[1] != [2]int{1, 1} || got[2] != [2]int{1, 1} || got[3] != [2]int{2, 3} {
+		t.Errorf("positions = %v, want bibs 1 and 2 sharing first overall", got)
+	}
+
+	// The photo finish puts bib 2 first overall, without moving anyone in H21
+	order := []db.TieEntry{
+		{BibNumber: 2, EventID: tie.Results[1].EventID},
+		{BibNumber: 1, EventID: tie.Results[0].EventID},
+	}
+	if err := db.ResolveTie(database, tie, order, "photo.jpg"); err != nil {
+		t.Fatalf("ResolveTie: %v", err)
+	}
+	if got := positions(t, database); got[1] != [2]int{1, 2} || got[2] != [2]int{1, 1} || got[3] != [2]int{2, 3} {
+		t.Errorf("positions = %v, want bib 2 before bib 1 overall", got)
+	}
+	ties, err = db.Ties(database, 0)
+	if err != nil {
+		t.Fatalf("Ties: %v", err)
+	}
+	if len(ties) != 1 || !ties[0].Resolved || ties[0].Timestamp != tie.Timestamp || ties[0].PhotoPath != "photo.jpg" || ties[0].Results[0].BibNumber != 2 {
+		t.Errorf("ties = %+v, want the tie decided with bib 2 first", ties)
+	}
+
+	if err := db.ClearTie(database, tie.Timestamp); err != nil {
+		t.Fatalf("ClearTie: %v", err)
+	}
+	if got := positions(t, database); got[1] != [2]int{1, 1} || got[2] != [2]int{1, 1} {
+		t.Errorf("positions = %v, want bibs 1 and 2 sharing first overall again", got)
+	}
+}
@@ -9,6 +9,7 @@ import (
 )
 
 type Participant struct {
+	ParticipantID  int
 	BibNumber      int
 	FirstName      string
 	LastName       string
@@ -18,6 +19,10 @@ type Participant struct {
 	Classification string
 	EventID        int
 	EventName      string
+	// Phone and Email are where finish notifications go when NotifyFinish is set
+	Phone        string
+	Email        string
+	NotifyFinish bool
 }
 
 func GetEvents(db *sql.DB) ([]string, error) {
@@ -64,18 +69,16 @@ func CreateEvent(db *sql.DB, eventName string, parentEventID int, classification
 	return int(eventID), nil
 }
 
+// InsertParticipant stores participant in eventID. It returns ErrDuplicate when
+// the bib number is already registered in the event.
 func InsertParticipant(db *sql.DB, participant Participant, eventID int) error {
-	query := `INSERT INTO participants (event_id, bib_number, first_name, last_name, gender, birthdate, club, classification)
-    		  VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	query := `INSERT INTO participants (event_id, bib_number, first_name, last_name, gender, birthdate, club, classification, phone, email, notify_finish)
+    		  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
-	_, err := db.Exec(query, eventID, participant.BibNumber, participant.FirstName, participant.LastName, participant.Gender, participant.Birthdate, participant.Club, participant.Classification)
+	participant.EventID = eventID
+	_, err := db.Exec(query, eventID, participant.BibNumber, participant.FirstName, participant.LastName, participant.Gender, participant.Birthdate, participant.Club, participant.Classification, participant.Phone, participant.Email, participant.NotifyFinish)
 	if err != nil {
-		// Check if the error is a UNIQUE constraint violation
-		var sqliteErr sqlite3.Error
-		if errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrConstraint {
-			return nil // Suppress the error as it is expected
-		}
-		return fmt.Errorf("error inserting participant: %w", err)
+		return participantError(err, participant)
 	}
 
 	return nil
@@ -141,7 +144,7 @@ func InsertTimingResult(db *sql.DB, result parser.TimingResult, participant Part
 	query := `INSERT INTO timing_results (bib_number, event_id, timestamp, antenna_row, antenna, placement)
               VALUES (?, ?, ?, ?, ?, NULL)`
 
-	_, err := db.Exec(query, result.BibNumber, participant.EventID, result.Timestamp.Format("2006-01-02 15:04:05.000"), result.AntennaRow, result.Antenna)
+	_, err := db.Exec(query, result.BibNumber, participant.EventID, result.Timestamp.Format(TimestampLayout), result.AntennaRow, result.Antenna)
 	if err != nil {
 		// Check if the error is a UNIQUE constraint violation
 		var sqliteErr sqlite3.Error
@@ -152,3 +155,91 @@ func InsertTimingResult(db *sql.DB, result parser.TimingResult, participant Part
 	}
 	return nil
 }
+
+// IngestTimingResults inserts a batch of timing results in a single transaction.
+// Participants are resolved with one query and reads that are already stored are
+// skipped. It returns the number of new reads.
+func IngestTimingResults(db *sql.DB, results []parser.TimingResult) (int, error) {
+	reads, err := IngestReads(db, results)
+	return len(reads), err
+}
+
+// IngestReads works like IngestTimingResults but returns the new reads
+func IngestReads(db *sql.DB, results []parser.TimingResult) ([]Read, error) {
+	if len(results) == 0 {
+		return nil, nil
+	}
+
+	eventIDs, err := getEventIDsByBibNumber(db)
+	if err != nil {
+		return nil, err
+	}
+	starts, err := StartTimes(db)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT OR IGNORE INTO timing_results (bib_number, event_id, timestamp, antenna_row, antenna, placement, race_time_ms)
+              VALUES (?, ?, ?, ?, ?, NULL, ?)`)
+	if err != nil {
+		return nil, fmt.Errorf("error preparing timing result insert: %w", err)
+	}
+	defer stmt.Close()
+
+	var inserted []Read
+	for _, result := range results {
+		eventID := eventIDs[result.BibNumber]
+		read := Read{
+			BibNumber:  result.BibNumber,
+			EventID:    eventID,
+			Timestamp:  result.Timestamp.Format(TimestampLayout),
+			AntennaRow: result.AntennaRow,
+			Antenna:    result.Antenna,
+			RaceTimeMs: raceTime(starts, eventID, result.Timestamp),
+		}
+		res, err := stmt.Exec(read.BibNumber, read.EventID, read.Timestamp, read.AntennaRow, read.Antenna, read.RaceTimeMs)
+		if err != nil {
+			return nil, fmt.Errorf("error inserting timing result for bib number %d: %w", result.BibNumber, err)
+		}
+		if n, err := res.RowsAffected(); err == nil && n > 0 {
+			inserted = append(inserted, read)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing timing results: %w", err)
+	}
+
+	return inserted, nil
+}
+
+// getEventIDsByBibNumber maps every bib number to the event of its participant.
+// Reads for unknown bib numbers are stored with event 0, like InsertTimingResult does.
+func getEventIDsByBibNumber(db *sql.DB) (map[int]int, error) {
+	rows, err := db.Query("SELECT bib_number, MIN(event_id) FROM participants GROUP BY bib_number")
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving participants: %w", err)
+	}
+	defer rows.Close()
+
+	eventIDs := make(map[int]int)
+	for rows.Next() {
+		var bibNumber, eventID int
+		if err := rows.Scan(&bibNumber, &eventID); err != nil {
+			return nil, fmt.Errorf("error scanning participant: %w", err)
+		}
+		eventIDs[bibNumber] = eventID
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error with rows: %w", err)
+	}
+
+	return eventIDs, nil
+}
@@ -0,0 +1,275 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/mattn/go-sqlite3"
+	"time"
+)
+
+// timeLayout is the format of times stored by the users, sessions and api_tokens tables
+const timeLayout = time.RFC3339
+
+// User is an account that can log in to the admin UI. PasswordHash is never sent to clients.
+type User struct {
+	UserID       int
+	Username     string
+	Role         string
+	PasswordHash string `json:"-"`
+}
+
+// APIToken is a token an integration uses instead of logging in. It acts as its user.
+type APIToken struct {
+	TokenID    int
+	Name       string
+	UserID     int
+	Username   string
+	Role       string
+	CreatedAt  string
+	LastUsedAt string
+}
+
+// CountUsers returns the number of user accounts
+func CountUsers(db *sql.DB) (int, error) {
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count); err != nil {
+		return 0, fmt.Errorf("error counting users: %w", err)
+	}
+	return count, nil
+}
+
+// ListUsers retrieves all users sorted by username
+func ListUsers(db *sql.DB) ([]User, error) {
+	rows, err := db.Query("SELECT user_id, username, role FROM users ORDER BY username")
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.UserID, &user.Username, &user.Role); err != nil {
+			return nil, fmt.Errorf("error scanning user: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error with rows: %w", err)
+	}
+
+	return users, nil
+}
+
+// GetUser retrieves a user by ID
+func GetUser(db *sql.DB, userID int) (User, error) {
+	return getUser(db, "user_id = ?", userID)
+}
+
+// GetUserByUsername retrieves a user with its password hash for checking a login
+func GetUserByUsername(db *sql.DB, username string) (User, error) {
+	return getUser(db, "username = ?", username)
+}
+
+func getUser(db *sql.DB, where string, arg interface{}) (User, error) {
+	var user User
+	err := db.QueryRow("SELECT user_id, username, role, password_hash FROM users WHERE "+where, arg).
+		Scan(&user.UserID, &user.Username, &user.Role, &user.PasswordHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, fmt.Errorf("user: %w", ErrNotFound)
+	}
+	if err != nil {
+		return User{}, fmt.Errorf("error retrieving user: %w", err)
+	}
+	return user, nil
+}
+
+// CreateUser stores a new user and returns its ID
+func CreateUser(db *sql.DB, user User) (int, error) {
+	result, err := db.Exec("INSERT INTO users (username, password_hash, role) VALUES (?, ?, ?)",
+		user.Username, user.PasswordHash, user.Role)
+	if err != nil {
+		return 0, userError(err, user)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error retrieving user ID: %w", err)
+	}
+	return int(id), nil
+}
+
+// UpdateUser changes the username and role of a user, and its password hash unless it is empty
+func UpdateUser(db *sql.DB, user User) error {
+	query := "UPDATE users SET username = ?, role = ?, password_hash = COALESCE(NULLIF(?, ''), password_hash) WHERE user_id = ?"
+	result, err := db.Exec(query, user.Username, user.Role, user.PasswordHash, user.UserID)
+	if err != nil {
+		return userError(err, user)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("user %d: %w", user.UserID, ErrNotFound)
+	}
+	return nil
+}
+
+// DeleteUser removes a user together with its sessions and API tokens
+func DeleteUser(db *sql.DB, userID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		"DELETE FROM sessions WHERE user_id = ?",
+		"DELETE FROM api_tokens WHERE user_id = ?",
+	} {
+		if _, err := tx.Exec(query, userID); err != nil {
+			return fmt.Errorf("error deleting user: %w", err)
+		}
+	}
+
+	result, err := tx.Exec("DELETE FROM users WHERE user_id = ?", userID)
+	if err != nil {
+		return fmt.Errorf("error deleting user: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("user %d: %w", userID, ErrNotFound)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// CreateSession stores a session for a user until expiresAt
+func CreateSession(db *sql.DB, tokenHash string, userID int, expiresAt time.Time) error {
+	_, err := db.Exec("INSERT INTO sessions (token_hash, user_id, expires_at) VALUES (?, ?, ?)",
+		tokenHash, userID, expiresAt.UTC().Format(timeLayout))
+	if err != nil {
+		return fmt.Errorf("error creating session: %w", err)
+	}
+	return nil
+}
+
+// GetSessionUser retrieves the user of a session that has not expired
+func GetSessionUser(db *sql.DB, tokenHash string) (User, error) {
+	query := `SELECT u.user_id, u.username, u.role FROM sessions s
+              JOIN users u ON u.user_id = s.user_id
+              WHERE s.token_hash = ? AND s.expires_at > ?`
+
+	var user User
+	err := db.QueryRow(query, tokenHash, time.Now().UTC().Format(timeLayout)).Scan(&user.UserID, &user.Username, &user.Role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, fmt.Errorf("session: %w", ErrNotFound)
+	}
+	if err != nil {
+		return User{}, fmt.Errorf("error retrieving session: %w", err)
+	}
+	return user, nil
+}
+
+// DeleteSession ends a session
+func DeleteSession(db *sql.DB, tokenHash string) error {
+	if _, err := db.Exec("DELETE FROM sessions WHERE token_hash = ?", tokenHash); err != nil {
+		return fmt.Errorf("error deleting session: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpiredSessions removes sessions that have expired
+func DeleteExpiredSessions(db *sql.DB) error {
+	if _, err := db.Exec("DELETE FROM sessions WHERE expires_at <= ?", time.Now().UTC().Format(timeLayout)); err != nil {
+		return fmt.Errorf("error deleting expired sessions: %w", err)
+	}
+	return nil
+}
+
+// CreateAPIToken stores a new API token for a user and returns its ID
+func CreateAPIToken(db *sql.DB, name string, tokenHash string, userID int) (int, error) {
+	result, err := db.Exec("INSERT INTO api_tokens (name, token_hash, user_id, created_at) VALUES (?, ?, ?, ?)",
+		name, tokenHash, userID, time.Now().UTC().Format(timeLayout))
+	if err != nil {
+		return 0, fmt.Errorf("error creating API token: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error retrieving API token ID: %w", err)
+	}
+	return int(id), nil
+}
+
+// ListAPITokens retrieves all API tokens, without the tokens themselves
+func ListAPITokens(db *sql.DB) ([]APIToken, error) {
+	query := `SELECT t.token_id, t.name, t.user_id, u.username, u.role, t.created_at, COALESCE(t.last_used_at, '')
+              FROM api_tokens t
+              JOIN users u ON u.user_id = t.user_id
+              ORDER BY t.token_id`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving API tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []APIToken
+	for rows.Next() {
+		var token APIToken
+		if err := rows.Scan(&token.TokenID, &token.Name, &token.UserID, &token.Username, &token.Role, &token.CreatedAt, &token.LastUsedAt); err != nil {
+			return nil, fmt.Errorf("error scanning API token: %w", err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error with rows: %w", err)
+	}
+
+	return tokens, nil
+}
+
+// GetAPITokenUser retrieves the user an API token acts as and records that the token was used
+func GetAPITokenUser(db *sql.DB, tokenHash string) (User, error) {
+	query := `SELECT u.user_id, u.username, u.role FROM api_tokens t
+              JOIN users u ON u.user_id = t.user_id
+              WHERE t.token_hash = ?`
+
+	var user User
+	err := db.QueryRow(query, tokenHash).Scan(&user.UserID, &user.Username, &user.Role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, fmt.Errorf("API token: %w", ErrNotFound)
+	}
+	if err != nil {
+		return User{}, fmt.Errorf("error retrieving API token: %w", err)
+	}
+
+	if _, err := db.Exec("UPDATE api_tokens SET last_used_at = ? WHERE token_hash = ?", time.Now().UTC().Format(timeLayout), tokenHash); err != nil {
+		return User{}, fmt.Errorf("error updating API token: %w", err)
+	}
+	return user, nil
+}
+
+// DeleteAPIToken revokes an API token
+func DeleteAPIToken(db *sql.DB, tokenID int) error {
+	result, err := db.Exec("DELETE FROM api_tokens WHERE token_id = ?", tokenID)
+	if err != nil {
+		return fmt.Errorf("error deleting API token: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("API token %d: %w", tokenID, ErrNotFound)
+	}
+	return nil
+}
+
+// userError turns a unique constraint violation into ErrDuplicate
+func userError(err error, user User) error {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrConstraint {
+		return fmt.Errorf("username %s: %w", user.Username, ErrDuplicate)
+	}
+	return fmt.Errorf("error saving user: %w", err)
+}
@@ -0,0 +1,41 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// SetWatchSource stores a watched timing file and whether it is active
+func SetWatchSource(db *sql.DB, path string, active bool) error {
+	query := `INSERT INTO watch_sources (path, active) VALUES (?, ?)
+              ON CONFLICT (path) DO UPDATE SET active = excluded.active`
+
+	if _, err := db.Exec(query, path, active); err != nil {
+		return fmt.Errorf("error saving watch source: %w", err)
+	}
+	return nil
+}
+
+// GetActiveWatchSources retrieves the paths of all active watched timing files
+func GetActiveWatchSources(db *sql.DB) ([]string, error) {
+	rows, err := db.Query("SELECT path FROM watch_sources WHERE active = 1 ORDER BY path")
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving watch sources: %w", err)
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, fmt.Errorf("error scanning watch source: %w", err)
+		}
+		paths = append(paths, path)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error with rows: %w", err)
+	}
+
+	return paths, nil
+}
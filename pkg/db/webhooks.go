@@ -0,0 +1,293 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Webhook is a URL that is sent signed notifications about a race. A zero
+// EventID means every race. Without Types every kind of notification is sent.
+// The secret is left out of JSON so the API shows it only when it is created.
+type Webhook struct {
+	WebhookID int      `json:"webhookID"`
+	EventID   int      `json:"eventID"`
+	URL       string   `json:"url"`
+	Secret    string   `json:"-"`
+	Types     []string `json:"types"`
+	Active    bool     `json:"active"`
+	CreatedAt string   `json:"createdAt"`
+}
+
+// WebhookDelivery is one notification to a webhook and the outcome of sending it.
+// Status is pending until it is delivered or has failed too many times.
+type WebhookDelivery struct {
+	DeliveryID     int
+	WebhookID      int
+	Type           string
+	Payload        string
+	Status         string
+	Attempts       int
+	NextAttemptAt  string
+	ResponseStatus int
+	Error          string
+	CreatedAt      string
+	DeliveredAt    string
+}
+
+// Statuses of a webhook delivery
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+const webhookColumns = `webhook_id, COALESCE(event_id, 0), url, secret, types, active, created_at`
+
+func scanWebhook(row interface{ Scan(...interface{}) error }) (Webhook, error) {
+	var webhook Webhook
+	var types string
+	err := row.Scan(&webhook.WebhookID, &webhook.EventID, &webhook.URL, &webhook.Secret, &types, &webhook.Active, &webhook.CreatedAt)
+	if types != "" {
+		webhook.Types = strings.Split(types, ",")
+	}
+	return webhook, err
+}
+
+// Wants reports whether the webhook is sent notifications of type t
+func (w Webhook) Wants(t string) bool {
+	if len(w.Types) == 0 {
+		return true
+	}
+	for _, wanted := range w.Types {
+		if wanted == t {
+			return true
+		}
+	}
+	return false
+}
+
+// ListWebhooks retrieves all webhooks
+func ListWebhooks(db *sql.DB) ([]Webhook, error) {
+	rows, err := db.Query("SELECT " + webhookColumns + " FROM webhooks ORDER BY webhook_id")
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	webhooks := []Webhook{}
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning webhook: %w", err)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error with rows: %w", err)
+	}
+
+	return webhooks, nil
+}
+
+// GetWebhook retrieves a webhook by ID
+func GetWebhook(db *sql.DB, webhookID int) (Webhook, error) {
+	webhook, err := scanWebhook(db.QueryRow("SELECT "+webhookColumns+" FROM webhooks WHERE webhook_id = ?", webhookID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Webhook{}, fmt.Errorf("webhook %d: %w", webhookID, ErrNotFound)
+	}
+	if err != nil {
+		return Webhook{}, fmt.Errorf("error retrieving webhook: %w", err)
+	}
+	return webhook, nil
+}
+
+// CreateWebhook stores a new webhook and returns its ID
+func CreateWebhook(db *sql.DB, webhook Webhook) (int, error) {
+	result, err := db.Exec("INSERT INTO webhooks (event_id, url, secret, types, active, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		webhook.EventID, webhook.URL, webhook.Secret, strings.Join(webhook.Types, ","), webhook.Active, time.Now().Format(timeLayout))
+	if err != nil {
+		return 0, fmt.Errorf("error creating webhook: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error retrieving webhook ID: %w", err)
+	}
+	return int(id), nil
+}
+
+// UpdateWebhook changes a webhook, keeping its secret when Secret is empty
+func UpdateWebhook(db *sql.DB, webhook Webhook) error {
+	query := `UPDATE webhooks SET event_id = ?, url = ?, secret = COALESCE(NULLIF(?, ''), secret), types = ?, active = ?
+              WHERE webhook_id = ?`
+	result, err := db.Exec(query, webhook.EventID, webhook.URL, webhook.Secret, strings.Join(webhook.Types, ","), webhook.Active, webhook.WebhookID)
+	if err != nil {
+		return fmt.Errorf("error updating webhook: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("webhook %d: %w", webhook.WebhookID, ErrNotFound)
+	}
+	return nil
+}
+
+// DeleteWebhook removes a webhook together with its deliveries
+func DeleteWebhook(db *sql.DB, webhookID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM webhook_deliveries WHERE webhook_id = ?", webhookID); err != nil {
+		return fmt.Errorf("error deleting webhook deliveries: %w", err)
+	}
+	result, err := tx.Exec("DELETE FROM webhooks WHERE webhook_id = ?", webhookID)
+	if err != nil {
+		return fmt.Errorf("error deleting webhook: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("webhook %d: %w", webhookID, ErrNotFound)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing webhook deletion: %w", err)
+	}
+	return nil
+}
+
+// deliveryTimeLayout keeps the milliseconds of delivery times, so a retry waits
+// its full backoff, with a fixed width so the times sort as text
+const deliveryTimeLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// deliveryTime formats a delivery time in UTC, since text order is only time
+// order within one zone and a local offset changes with daylight saving time
+func deliveryTime(t time.Time) string {
+	return t.UTC().Format(deliveryTimeLayout)
+}
+
+const deliveryColumns = `delivery_id, webhook_id, type, payload, status, attempts, COALESCE(next_attempt_at, ''),
+       COALESCE(response_status, 0), COALESCE(error, ''), created_at, COALESCE(delivered_at, '')`
+
+// CreateWebhookDelivery queues a payload for a webhook, to be sent at once
+func CreateWebhookDelivery(db *sql.DB, webhookID int, deliveryType string, payload string) (int, error) {
+	now := deliveryTime(time.Now())
+	result, err := db.Exec(`INSERT INTO webhook_deliveries (webhook_id, type, payload, status, attempts, next_attempt_at, created_at)
+                            VALUES (?, ?, ?, ?, 0, ?, ?)`, webhookID, deliveryType, payload, DeliveryPending, now, now)
+	if err != nil {
+		return 0, fmt.Errorf("error creating webhook delivery: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error retrieving webhook delivery ID: %w", err)
+	}
+	return int(id), nil
+}
+
+// CreateWebhookDeliveries queues many payloads in one transaction, to be sent
+// at once. Only WebhookID, Type and Payload of the deliveries are used.
+func CreateWebhookDeliveries(db *sql.DB, deliveries []WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO webhook_deliveries (webhook_id, type, payload, status, attempts, next_attempt_at, created_at)
+                             VALUES (?, ?, ?, ?, 0, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("error preparing webhook delivery insert: %w", err)
+	}
+	defer stmt.Close()
+
+	now := deliveryTime(time.Now())
+	for _, d := range deliveries {
+		if _, err := stmt.Exec(d.WebhookID, d.Type, d.Payload, DeliveryPending, now, now); err != nil {
+			return fmt.Errorf("error creating webhook delivery: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing webhook deliveries: %w", err)
+	}
+	return nil
+}
+
+// ListWebhookDeliveries retrieves the latest deliveries of a webhook, newest first
+func ListWebhookDeliveries(db *sql.DB, webhookID int, limit int) ([]WebhookDelivery, error) {
+	return queryDeliveries(db, "SELECT "+deliveryColumns+" FROM webhook_deliveries WHERE webhook_id = ? ORDER BY delivery_id DESC LIMIT ?", webhookID, limit)
+}
+
+// DueWebhookDeliveries retrieves pending deliveries whose next attempt is due at now, oldest first
+func DueWebhookDeliveries(db *sql.DB, now time.Time, limit int) ([]WebhookDelivery, error) {
+	return queryDeliveries(db, "SELECT "+deliveryColumns+" FROM webhook_deliveries WHERE status = ? AND next_attempt_at <= ? ORDER BY delivery_id LIMIT ?",
+		DeliveryPending, deliveryTime(now), limit)
+}
+
+// NextWebhookAttempt returns when the next pending delivery is due, and false when none is pending
+func NextWebhookAttempt(db *sql.DB) (time.Time, bool, error) {
+	var next sql.NullString
+	if err := db.QueryRow("SELECT MIN(next_attempt_at) FROM webhook_deliveries WHERE status = ?", DeliveryPending).Scan(&next); err != nil {
+		return time.Time{}, false, fmt.Errorf("error retrieving next webhook attempt: %w", err)
+	}
+	if !next.Valid {
+		return time.Time{}, false, nil
+	}
+	at, err := time.Parse(timeLayout, next.String)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("error parsing next webhook attempt: %w", err)
+	}
+	return at, true, nil
+}
+
+// RecordWebhookAttempt stores the outcome of sending a delivery. A pending
+// delivery is tried again at nextAttempt.
+func RecordWebhookAttempt(db *sql.DB, delivery WebhookDelivery, nextAttempt time.Time) error {
+	var next, deliveredAt interface{}
+	if delivery.Status == DeliveryPending {
+		next = deliveryTime(nextAttempt)
+	}
+	if delivery.Status == DeliveryDelivered {
+		deliveredAt = deliveryTime(time.Now())
+	}
+
+	query := `UPDATE webhook_deliveries SET status = ?, attempts = ?, next_attempt_at = ?, response_status = NULLIF(?, 0),
+                     error = NULLIF(?, ''), delivered_at = ?
+              WHERE delivery_id = ?`
+	if _, err := db.Exec(query, delivery.Status, delivery.Attempts, next, delivery.ResponseStatus, delivery.Error, deliveredAt, delivery.DeliveryID); err != nil {
+		return fmt.Errorf("error updating webhook delivery: %w", err)
+	}
+	return nil
+}
+
+func queryDeliveries(db *sql.DB, query string, args ...interface{}) ([]WebhookDelivery, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		if err := rows.Scan(&d.DeliveryID, &d.WebhookID, &d.Type, &d.Payload, &d.Status, &d.Attempts, &d.NextAttemptAt,
+			&d.ResponseStatus, &d.Error, &d.CreatedAt, &d.DeliveredAt); err != nil {
+			return nil, fmt.Errorf("error scanning webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error with rows: %w", err)
+	}
+
+	return deliveries, nil
+}
@@ -0,0 +1,92 @@
+package db_test
+
+import (
+	"database/sql"
+	"github.com/jimmitjoo/livestream-results/pkg/db"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func setupDatabase(t *testing.T, path string) *sql.DB {
+	t.Helper()
+	database, err := db.SetupDatabase(path)
+	if err != nil {
+		t.Fatalf("SetupDatabase: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database
+}
+
+// createDelivery queues a delivery to a new webhook
+func createDelivery(t *testing.T, database *sql.DB) db.WebhookDelivery {
+	t.Helper()
+	webhookID, err := db.CreateWebhook(database, db.Webhook{URL: "http://127.0.0.1:1/", Secret: "secret", Active: true})
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+	if _, err := db.CreateWebhookDelivery(database, webhookID, "test", `{"type":"test"}`); err != nil {
+		t.Fatalf("CreateWebhookDelivery: %v", err)
+	}
+	deliveries, err := db.ListWebhookDeliveries(database, webhookID, 1)
+	if err != nil {
+		t.Fatalf("ListWebhookDeliveries: %v", err)
+	}
+	return deliveries[0]
+}
+
+func TestDueWebhookDeliveriesAcrossZones(t *testing.T) {
+	database := setupDatabase(t, filepath.Join(t.TempDir(), "race.db"))
+	delivery := createDelivery(t, database)
+
+	// Retried at 08:30 UTC, written in summer time and asked for in another zone
+	summer := time.FixedZone("CEST", 2*60*60)
+	west := time.FixedZone("EST", -5*60*60)
+	next := time.Date(2024, 10, 27, 10, 30, 0, 0, summer)
+	delivery.Attempts = 1
+	if err := db.RecordWebhookAttempt(database, delivery, next); err != nil {
+		t.Fatalf("RecordWebhookAttempt: %v", err)
+	}
+
+	tests := []struct {
+		now  time.Time
+		want int
+	}{
+		{next.Add(-time.Millisecond).In(west), 0},
+		{next.In(west), 1},
+		{next.Add(30 * time.Minute).In(west), 1},
+	}
+	for _, test := range tests {
+		due, err := db.DueWebhookDeliveries(database, test.now, 10)
+		if err != nil {
+			t.Fatalf("DueWebhookDeliveries: %v", err)
+		}
+		if len(due) != test.want {
+			t.Errorf("%d deliveries due at %s, want %d", len(due), test.now.Format(time.RFC3339Nano), test.want)
+		}
+	}
+
+	at, ok, err := db.NextWebhookAttempt(database)
+	if err != nil || !ok || !at.Equal(next) {
+		t.Errorf("NextWebhookAttempt = %s, %v, %v, want %s", at, ok, err, next)
+	}
+}
+
+func TestSetupDatabaseMovesDeliveryTimesToUTC(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "race.db")
+	database := setupDatabase(t, path)
+	delivery := createDelivery(t, database)
+	if _, err := database.Exec("UPDATE webhook_deliveries SET next_attempt_at = ? WHERE delivery_id = ?", "2024-10-27T02:30:00.250+02:00", delivery.DeliveryID); err != nil {
+		t.Fatal(err)
+	}
+	database.Close()
+
+	database = setupDatabase(t, path)
+	var next string
+	if err := database.QueryRow("SELECT next_attempt_at FROM webhook_deliveries WHERE delivery_id = ?", delivery.DeliveryID).Scan(&next); err != nil {
+		t.Fatal(err)
+	}
+	if want := "2024-10-27T00:30:00.250Z"; next != want {
+		t.Errorf("next_attempt_at = %s, want %s", next, want)
+	}
+}
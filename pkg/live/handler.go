@@ -0,0 +1,134 @@
+package live
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxAge is how long browsers and proxies may reuse a response
+const maxAge = 5 * time.Second
+
+// heartbeatInterval keeps idle update streams open through proxies
+const heartbeatInterval = 30 * time.Second
+
+// ServeHTTP serves the public API under /api/live/:
+//
+//	GET /api/live/classes                  races and classes
+//	GET /api/live/classes/{event}          results of a class
+//	GET /api/live/athletes/{event}/{bib}   an athlete with splits
+//	GET /api/live/latest?event=            the latest finishers, newest first
+//	GET /api/live/search?q=                athletes by bib, name or club
+//	GET /api/live/updates                  server-sent events, one per new version
+func (s *Site) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/live/"), "/"), "/")
+	snap, changed := s.snapshot()
+
+	switch {
+	case len(parts) == 1 && parts[0] == "classes":
+		s.write(w, r, snap, snap.classes)
+
+	case len(parts) == 2 && parts[0] == "classes":
+		eventID, err := strconv.Atoi(parts[1])
+		body, ok := snap.results[eventID]
+		if err != nil || !ok {
+			http.NotFound(w, r)
+			return
+		}
+		s.write(w, r, snap, body)
+
+	case len(parts) == 3 && parts[0] == "athletes":
+		body, ok := snap.athletes[parts[1]+"/"+parts[2]]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		s.write(w, r, snap, body)
+
+	case len(parts) == 1 && parts[0] == "latest":
+		eventID := 0
+		if v := r.URL.Query().Get("event"); v != "" {
+			var err error
+			if eventID, err = strconv.Atoi(v); err != nil {
+				http.Error(w, "event must be an integer", http.StatusBadRequest)
+				return
+			}
+		}
+		body, ok := snap.latest[eventID]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		s.write(w, r, snap, body)
+
+	case len(parts) == 1 && parts[0] == "search":
+		body, err := json.Marshal(snap.search(r.URL.Query().Get("q")))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.write(w, r, snap, body)
+
+	case len(parts) == 1 && parts[0] == "updates":
+		s.streamUpdates(w, r, snap, changed)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// write sends a cacheable JSON response. The version is the ETag, so clients
+// that already have the current version get an empty 304. It includes the
+// instance, since versions start over when the server restarts.
+func (s *Site) write(w http.ResponseWriter, r *http.Request, snap *snapshot, body []byte) {
+	etag := fmt.Sprintf(`"%s-%d"`, s.instance, snap.version)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds())))
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// streamUpdates sends the version number every time the results change, until the client leaves
+func (s *Site) streamUpdates(w http.ResponseWriter, r *http.Request, snap *snapshot, changed <-chan struct{}) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	fmt.Fprintf(w, "data: %d\n\n", snap.version)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-changed:
+			snap, changed = s.snapshot()
+			fmt.Fprintf(w, "data: %d\n\n", snap.version)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,66 @@
+package live
+
+import (
+	"context"
+	"github.com/jimmitjoo/livestream-results/pkg/db"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// publishedSite returns a Site on database that published once
+func publishedSite(t *testing.T, path string) *Site {
+	t.Helper()
+	database, err := db.SetupDatabase(path)
+	if err != nil {
+		t.Fatalf("SetupDatabase: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	site := New(database, 0)
+	t.Cleanup(site.Close)
+	if err := site.Publish(context.Background(), nil); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	return site
+}
+
+func get(site *Site, etag string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/live/classes", nil)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	rec := httptest.NewRecorder()
+	site.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestETagChangesAcrossRestarts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "race.db")
+	site := publishedSite(t, path)
+
+	first := get(site, "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("GET answered %d with ETag %q", first.Code, etag)
+	}
+	if rec := get(site, etag); rec.Code != http.StatusNotModified {
+		t.Errorf("GET with the current ETag answered %d, want 304", rec.Code)
+	}
+
+	// A new version gets a new ETag
+	if err := site.Publish(context.Background(), nil); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if rec := get(site, etag); rec.Code != http.StatusOK {
+		t.Errorf("GET with the ETag of the last version answered %d, want 200", rec.Code)
+	}
+
+	// After a restart the versions count from 1 again, which must not match
+	// what clients kept from the earlier run
+	restarted := publishedSite(t, path)
+	if rec := get(restarted, etag); rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag {
+		t.Errorf("GET after a restart answered %d with ETag %s, want 200 with a new ETag", rec.Code, rec.Header().Get("ETag"))
+	}
+}
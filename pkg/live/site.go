@@ -0,0 +1,336 @@
+// Package live serves the public results site. Results are kept as ready-made
+// JSON in memory and rebuilt only when they change, so spectators never reach
+// the database.
+package live
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/jimmitjoo/livestream-results/pkg/db"
+	"github.com/jimmitjoo/livestream-results/pkg/publisher"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxSearchResults limits the answers to one search
+const maxSearchResults = 20
+
+// maxLatest is the number of finishers in the latest feed
+const maxLatest = 10
+
+// Class is a race or one of its classes with the number of starters and finishers
+type Class struct {
+	EventID        int    `json:"eventID"`
+	EventName      string `json:"eventName"`
+	ParentEventID  int    `json:"parentEventID"`
+	Classification string `json:"classification"`
+	Distance       int    `json:"distance"`
+	StartTime      string `json:"startTime,omitempty"`
+	Starters       int    `json:"starters"`
+	Finishers      int    `json:"finishers"`
+}
+
+// Entry is an athlete in a class, with a result once finished
+type Entry struct {
+	Position  int    `json:"position,omitempty"`
+	BibNumber int    `json:"bibNumber"`
+	Name      string `json:"name"`
+	Club      string `json:"club"`
+	EventID   int    `json:"eventID"`
+	EventName string `json:"eventName"`
+	Time      string `json:"time,omitempty"`
+	Behind    string `json:"behind,omitempty"`
+}
+
+// Split is one passage of an athlete at an antenna
+type Split struct {
+	Checkpoint string `json:"checkpoint"`
+	Timestamp  string `json:"timestamp"`
+	Time       string `json:"time"`
+	Lap        string `json:"lap"`
+}
+
+// Athlete is an athlete with all passages
+type Athlete struct {
+	Entry
+	Splits []Split `json:"splits"`
+}
+
+// snapshot is one version of the site, every response already encoded
+type snapshot struct {
+	version  int64
+	classes  []byte
+	results  map[int][]byte
+	latest   map[int][]byte
+	athletes map[string][]byte
+	entries  []Entry
+}
+
+// Site is a publisher that keeps the public site up to date
+type Site struct {
+	database *sql.DB
+	// finishAntenna tells finishes from splits, see db.IsFinish
+	finishAntenna int
+	// instance tells this process's versions from those of an earlier run,
+	// which count from the same numbers
+	instance string
+
+	mu      sync.RWMutex
+	current *snapshot
+	changed chan struct{}
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// New creates a Site reading from database. It is empty until the first Publish.
+func New(database *sql.DB, finishAntenna int) *Site {
+	return &Site{
+		database:      database,
+		finishAntenna: finishAntenna,
+		instance:      newInstance(),
+		current:       &snapshot{classes: []byte("[]"), results: map[int][]byte{}, latest: map[int][]byte{0: []byte("[]")}, athletes: map[string][]byte{}},
+		changed:       make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+}
+
+// newInstance returns a random name for this run of the site
+func newInstance() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Close ends all update streams so the server can shut down
+func (s *Site) Close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+}
+
+func (s *Site) Name() string {
+	return "live-site"
+}
+
+// Publish rebuilds the site from rows and the stored reads, then tells waiting clients
+func (s *Site) Publish(ctx context.Context, rows []db.ResultRow) error {
+	snap, err := s.build(rows)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	snap.version = s.current.version + 1
+	s.current = snap
+	close(s.changed)
+	s.changed = make(chan struct{})
+	s.mu.Unlock()
+	return nil
+}
+
+// snapshot returns the current version and a channel closed when it is replaced
+func (s *Site) snapshot() (*snapshot, <-chan struct{}) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.current, s.changed
+}
+
+func (s *Site) build(rows []db.ResultRow) (*snapshot, error) {
+	events, err := db.ListEvents(s.database)
+	if err != nil {
+		return nil, err
+	}
+	participants, _, err := db.SearchParticipants(s.database, db.ParticipantQuery{})
+	if err != nil {
+		return nil, err
+	}
+
+	snap := &snapshot{results: make(map[int][]byte), latest: make(map[int][]byte), athletes: make(map[string][]byte)}
+	entries := make(map[string]*Athlete)
+	var order []string
+
+	for _, p := range participants {
+		key := athleteKey(p.EventID, p.BibNumber)
+		entries[key] = &Athlete{Entry: Entry{
+			BibNumber: p.BibNumber,
+			Name:      strings.TrimSpace(p.FirstName + " " + p.LastName),
+			Club:      p.Club,
+			EventID:   p.EventID,
+			EventName: p.EventName,
+		}}
+		order = append(order, key)
+	}
+
+	byEvent := make(map[int][]Entry)
+	var finishOrder []Entry
+	winners := make(map[int]time.Time)
+	for _, row := range rows {
+		if row.EventID == 0 {
+			continue
+		}
+		key := athleteKey(row.EventID, row.BibNumber)
+		athlete, ok := entries[key]
+		if !ok {
+			athlete = &Athlete{Entry: Entry{BibNumber: row.BibNumber, EventID: row.EventID, EventName: row.EventName}}
+			entries[key] = athlete
+			order = append(order, key)
+		}
+
+		finish, err := time.Parse(db.TimestampLayout, row.Timestamp)
+		if err != nil {
+			continue
+		}
+		if _, ok := winners[row.EventID]; !ok {
+			winners[row.EventID] = finish
+		}
+
+		athlete.Position = row.Position
+		athlete.Time = publisher.DisplayTime(row)
+		if behind := finish.Sub(winners[row.EventID]); behind > 0 {
+			athlete.Behind = "+" + publisher.FormatDuration(behind)
+		}
+		byEvent[row.EventID] = append(byEvent[row.EventID], athlete.Entry)
+		finishOrder = append(finishOrder, athlete.Entry)
+	}
+
+	err = db.EachRead(s.database, func(read db.Read) error {
+		athlete, ok := entries[athleteKey(read.EventID, read.BibNumber)]
+		if !ok {
+			return nil
+		}
+		timestamp, err := time.Parse(db.TimestampLayout, read.Timestamp)
+		if err != nil {
+			return nil
+		}
+
+		split := Split{Checkpoint: publisher.Checkpoint(read, s.finishAntenna), Timestamp: read.Timestamp, Time: publisher.ReadTime(read)}
+		if n := len(athlete.Splits); n > 0 {
+			previous, _ := time.Parse(db.TimestampLayout, athlete.Splits[n-1].Timestamp)
+			split.Lap = publisher.FormatDuration(timestamp.Sub(previous))
+		}
+		athlete.Splits = append(athlete.Splits, split)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	starters := make(map[int]int)
+	for _, key := range order {
+		athlete := entries[key]
+		if athlete.Splits == nil {
+			athlete.Splits = []Split{}
+		}
+		if snap.athletes[key], err = json.Marshal(athlete); err != nil {
+			return nil, fmt.Errorf("error encoding athlete: %w", err)
+		}
+		snap.entries = append(snap.entries, athlete.Entry)
+		starters[athlete.EventID]++
+	}
+
+	classes := make([]Class, 0, len(events))
+	for _, event := range events {
+		classes = append(classes, Class{
+			EventID:        event.EventID,
+			EventName:      event.EventName,
+			ParentEventID:  event.ParentEventID,
+			Classification: event.Classification,
+			Distance:       event.Distance,
+			StartTime:      event.StartTime,
+			Starters:       starters[event.EventID],
+			Finishers:      len(byEvent[event.EventID]),
+		})
+
+		results := byEvent[event.EventID]
+		if results == nil {
+			results = []Entry{}
+		}
+		if snap.results[event.EventID], err = json.Marshal(results); err != nil {
+			return nil, fmt.Errorf("error encoding results: %w", err)
+		}
+	}
+	if err := snap.encodeLatest(events, finishOrder); err != nil {
+		return nil, err
+	}
+	if snap.classes, err = json.Marshal(classes); err != nil {
+		return nil, fmt.Errorf("error encoding classes: %w", err)
+	}
+
+	sort.SliceStable(snap.entries, func(i, j int) bool {
+		return snap.entries[i].BibNumber < snap.entries[j].BibNumber
+	})
+	return snap, nil
+}
+
+// encodeLatest stores the latest finishers, newest first, for all races and
+// for every race and class. A race includes the finishers of its classes.
+func (snap *snapshot) encodeLatest(events []db.Event, finishOrder []Entry) error {
+	parents := make(map[int]int)
+	for _, event := range events {
+		parents[event.EventID] = event.ParentEventID
+	}
+
+	latest := map[int][]Entry{0: {}}
+	for _, event := range events {
+		latest[event.EventID] = []Entry{}
+	}
+	for i := len(finishOrder) - 1; i >= 0; i-- {
+		entry := finishOrder[i]
+		feeds := []int{0, entry.EventID}
+		if parent := parents[entry.EventID]; parent != 0 {
+			feeds = append(feeds, parent)
+		}
+		for _, eventID := range feeds {
+			if entries, ok := latest[eventID]; ok && len(entries) < maxLatest {
+				latest[eventID] = append(entries, entry)
+			}
+		}
+	}
+
+	for eventID, entries := range latest {
+		body, err := json.Marshal(entries)
+		if err != nil {
+			return fmt.Errorf("error encoding latest finishers: %w", err)
+		}
+		snap.latest[eventID] = body
+	}
+	return nil
+}
+
+// search finds athletes by bib number or by part of their name or club
+func (snap *snapshot) search(q string) []Entry {
+	q = strings.ToLower(strings.TrimSpace(q))
+	matches := []Entry{}
+	if q == "" {
+		return matches
+	}
+
+	bibNumber, err := strconv.Atoi(q)
+	for _, entry := range snap.entries {
+		if err == nil && entry.BibNumber != bibNumber {
+			continue
+		}
+		if err != nil && !strings.Contains(strings.ToLower(entry.Name), q) && !strings.Contains(strings.ToLower(entry.Club), q) {
+			continue
+		}
+		matches = append(matches, entry)
+		if len(matches) == maxSearchResults {
+			break
+		}
+	}
+	return matches
+}
+
+func athleteKey(eventID, bibNumber int) string {
+	return fmt.Sprintf("%d/%d", eventID, bibNumber)
+}
@@ -0,0 +1,265 @@
+package mqtt
+
+import (
+	"errors"
+	"fmt"
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Broker is a small MQTT 3.1.1 broker for trying the publisher locally and in
+// integration tests. It keeps retained messages and delivers at QoS 0 or 1,
+// without persistent sessions, wills or authentication.
+type Broker struct {
+	// OnPublish, when set, is called with every message published to the broker
+	OnPublish func(topic string, payload []byte, qos byte, retained bool)
+
+	mu       sync.Mutex
+	listener net.Listener
+	clients  map[*brokerClient]struct{}
+	retained map[string]*packets.PublishPacket
+}
+
+type brokerClient struct {
+	conn   net.Conn
+	mu     sync.Mutex
+	subs   map[string]byte
+	nextID uint16
+}
+
+// ListenAndServe accepts clients on addr until Close is called
+func (b *Broker) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("error listening on %s: %w", addr, err)
+	}
+	return b.Serve(listener)
+}
+
+// Serve accepts clients on listener until Close is called
+func (b *Broker) Serve(listener net.Listener) error {
+	b.mu.Lock()
+	b.listener = listener
+	if b.clients == nil {
+		b.clients = make(map[*brokerClient]struct{})
+		b.retained = make(map[string]*packets.PublishPacket)
+	}
+	b.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error accepting MQTT client: %w", err)
+		}
+		go b.serveClient(conn)
+	}
+}
+
+// Close stops accepting clients and disconnects the connected ones
+func (b *Broker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for c := range b.clients {
+		c.conn.Close()
+	}
+	if b.listener == nil {
+		return nil
+	}
+	return b.listener.Close()
+}
+
+func (b *Broker) serveClient(conn net.Conn) {
+	defer conn.Close()
+	c := &brokerClient{conn: conn, subs: make(map[string]byte)}
+
+	packet, err := packets.ReadPacket(conn)
+	if err != nil {
+		return
+	}
+	connect, ok := packet.(*packets.ConnectPacket)
+	if !ok {
+		return
+	}
+	connack := packets.NewControlPacket(packets.Connack).(*packets.ConnackPacket)
+	connack.ReturnCode = connect.Validate()
+	if err := c.write(connack); err != nil || connack.ReturnCode != packets.Accepted {
+		return
+	}
+	keepalive := time.Duration(connect.Keepalive) * time.Second * 3 / 2
+
+	b.mu.Lock()
+	b.clients[c] = struct{}{}
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.clients, c)
+		b.mu.Unlock()
+	}()
+
+	for {
+		if keepalive > 0 {
+			conn.SetReadDeadline(time.Now().Add(keepalive))
+		}
+		packet, err := packets.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+
+		switch p := packet.(type) {
+		case *packets.PublishPacket:
+			switch p.Qos {
+			case 1:
+				ack := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				ack.MessageID = p.MessageID
+				c.write(ack)
+			case 2:
+				rec := packets.NewControlPacket(packets.Pubrec).(*packets.PubrecPacket)
+				rec.MessageID = p.MessageID
+				c.write(rec)
+			}
+			b.route(p)
+
+		case *packets.PubrelPacket:
+			comp := packets.NewControlPacket(packets.Pubcomp).(*packets.PubcompPacket)
+			comp.MessageID = p.MessageID
+			c.write(comp)
+
+		case *packets.SubscribePacket:
+			ack := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+			ack.MessageID = p.MessageID
+			type delivery struct {
+				message *packets.PublishPacket
+				qos     byte
+			}
+			var retained []delivery
+			b.mu.Lock()
+			for i, filter := range p.Topics {
+				qos := p.Qoss[i]
+				if qos > 1 {
+					qos = 1
+				}
+				c.subs[filter] = qos
+				ack.ReturnCodes = append(ack.ReturnCodes, qos)
+				for topic, message := range b.retained {
+					if matches(filter, topic) {
+						retained = append(retained, delivery{message, qos})
+					}
+				}
+			}
+			b.mu.Unlock()
+			c.write(ack)
+			for _, d := range retained {
+				c.deliver(d.message, d.qos, true)
+			}
+
+		case *packets.UnsubscribePacket:
+			b.mu.Lock()
+			for _, filter := range p.Topics {
+				delete(c.subs, filter)
+			}
+			b.mu.Unlock()
+			ack := packets.NewControlPacket(packets.Unsuback).(*packets.UnsubackPacket)
+			ack.MessageID = p.MessageID
+			c.write(ack)
+
+		case *packets.PingreqPacket:
+			c.write(packets.NewControlPacket(packets.Pingresp))
+
+		case *packets.DisconnectPacket:
+			return
+		}
+	}
+}
+
+// route keeps a retained message and delivers a message to every subscriber
+func (b *Broker) route(p *packets.PublishPacket) {
+	if b.OnPublish != nil {
+		b.OnPublish(p.TopicName, p.Payload, p.Qos, p.Retain)
+	}
+
+	type delivery struct {
+		client *brokerClient
+		qos    byte
+	}
+	var deliveries []delivery
+
+	b.mu.Lock()
+	if p.Retain {
+		if len(p.Payload) == 0 {
+			delete(b.retained, p.TopicName)
+		} else {
+			message := p.Copy()
+			message.Qos = p.Qos
+			b.retained[p.TopicName] = message
+		}
+	}
+	for c := range b.clients {
+		granted, subscribed := byte(0), false
+		for filter, qos := range c.subs {
+			if matches(filter, p.TopicName) {
+				subscribed = true
+				if qos > granted {
+					granted = qos
+				}
+			}
+		}
+		if subscribed {
+			deliveries = append(deliveries, delivery{c, granted})
+		}
+	}
+	b.mu.Unlock()
+
+	for _, d := range deliveries {
+		d.client.deliver(p, d.qos, false)
+	}
+}
+
+// deliver sends a message to the client at no more than qos
+func (c *brokerClient) deliver(p *packets.PublishPacket, qos byte, retained bool) {
+	out := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+	out.TopicName = p.TopicName
+	out.Payload = p.Payload
+	out.Qos = p.Qos
+	if qos < out.Qos {
+		out.Qos = qos
+	}
+	out.Retain = retained
+
+	c.mu.Lock()
+	if out.Qos > 0 {
+		c.nextID++
+		if c.nextID == 0 {
+			c.nextID = 1
+		}
+		out.MessageID = c.nextID
+	}
+	out.Write(c.conn)
+	c.mu.Unlock()
+}
+
+func (c *brokerClient) write(p packets.ControlPacket) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return p.Write(c.conn)
+}
+
+// matches reports whether topic matches a subscription filter with + and # wildcards
+func matches(filter, topic string) bool {
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+	for i, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if i >= len(topicLevels) || (level != "+" && level != topicLevels[i]) {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
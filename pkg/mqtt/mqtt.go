@@ -0,0 +1,261 @@
+// Package mqtt publishes reads, passages and leaderboards to an MQTT broker for
+// venue screens and LED boards, and has a small broker to try it with.
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/jimmitjoo/livestream-results/pkg/db"
+	"github.com/jimmitjoo/livestream-results/pkg/publisher"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// publishTimeout limits how long a message without a context may wait for the broker
+const publishTimeout = 10 * time.Second
+
+// Options configures a Sink. Topics may contain {event}, which is replaced by
+// the ID of the race or class, and an empty topic turns off those messages.
+type Options struct {
+	Broker   string
+	ClientID string
+	Username string
+	Password string
+	QoS      byte
+	Topics   Topics
+}
+
+// Topics are the topics messages are published to
+type Topics struct {
+	// Reads gets every stored read
+	Reads string
+	// Split and Finish get a runner's first read at a split antenna or the finish
+	Split  string
+	Finish string
+	// Leaderboard gets the current results of every class, retained so new
+	// subscribers get them at once
+	Leaderboard string
+}
+
+// Read is the message published for every stored read
+type Read struct {
+	BibNumber  int    `json:"bibNumber"`
+	EventID    int    `json:"eventID"`
+	Timestamp  string `json:"timestamp"`
+	AntennaRow *int   `json:"antennaRow"`
+	Antenna    *int   `json:"antenna"`
+	RaceTimeMs *int64 `json:"raceTimeMs"`
+}
+
+// Passage is a runner's first read at an antenna, sent to the finish or split
+// topic of EventID. Data is sent as is.
+type Passage struct {
+	Finish  bool
+	EventID int
+	Data    interface{}
+}
+
+// Leaderboard is the retained message with the results of a class
+type Leaderboard struct {
+	EventID   int     `json:"eventID"`
+	EventName string  `json:"eventName"`
+	UpdatedAt string  `json:"updatedAt"`
+	Results   []Entry `json:"results"`
+}
+
+// Entry is one runner on a leaderboard
+type Entry struct {
+	Position   int    `json:"position"`
+	BibNumber  int    `json:"bibNumber"`
+	Name       string `json:"name"`
+	Club       string `json:"club"`
+	Time       string `json:"time"`
+	RaceTimeMs *int64 `json:"raceTimeMs"`
+}
+
+// Sink publishes to an MQTT broker. It connects in the background and keeps
+// reconnecting, so the server runs while the broker is away. Leaderboards are
+// published as a publisher.Publisher, reads and passages as they are stored.
+type Sink struct {
+	opts   Options
+	client paho.Client
+}
+
+// New creates a Sink and starts connecting to the broker
+func New(opts Options) (*Sink, error) {
+	if opts.QoS > 2 {
+		return nil, fmt.Errorf("MQTT QoS must be 0, 1 or 2")
+	}
+
+	clientOpts := paho.NewClientOptions().
+		AddBroker(opts.Broker).
+		SetClientID(opts.ClientID).
+		SetUsername(opts.Username).
+		SetPassword(opts.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetOnConnectHandler(func(paho.Client) {
+			log.Printf("Connected to MQTT broker %s", opts.Broker)
+		}).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			log.Printf("Lost connection to MQTT broker %s: %v", opts.Broker, err)
+		})
+
+	s := &Sink{opts: opts, client: paho.NewClient(clientOpts)}
+	s.client.Connect()
+	return s, nil
+}
+
+func (s *Sink) Name() string {
+	return "mqtt:" + s.opts.Broker
+}
+
+// Publish sends the leaderboard of every class as a retained message
+func (s *Sink) Publish(ctx context.Context, rows []db.ResultRow) error {
+	if s.opts.Topics.Leaderboard == "" {
+		return nil
+	}
+	if !s.client.IsConnectionOpen() {
+		return fmt.Errorf("%w: not connected to MQTT broker %s", publisher.ErrRetryable, s.opts.Broker)
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	boards := make(map[int]*Leaderboard)
+	var order []int
+	for _, row := range rows {
+		// Reads of unknown bibs have no event
+		if row.EventID == 0 {
+			continue
+		}
+		board, ok := boards[row.EventID]
+		if !ok {
+			board = &Leaderboard{EventID: row.EventID, EventName: row.EventName, UpdatedAt: now, Results: []Entry{}}
+			boards[row.EventID] = board
+			order = append(order, row.EventID)
+		}
+		board.Results = append(board.Results, Entry{
+			Position:   row.Position,
+			BibNumber:  row.BibNumber,
+			Name:       strings.TrimSpace(row.FirstName + " " + row.LastName),
+			Club:       row.Club,
+			Time:       publisher.DisplayTime(row),
+			RaceTimeMs: row.RaceTimeMs,
+		})
+	}
+
+	var tokens []paho.Token
+	for _, eventID := range order {
+		token, err := s.send(s.opts.Topics.Leaderboard, eventID, boards[eventID], true)
+		if err != nil {
+			return err
+		}
+		tokens = append(tokens, token)
+	}
+	for _, token := range tokens {
+		if err := wait(ctx, token); err != nil {
+			return fmt.Errorf("%w: error publishing leaderboard: %v", publisher.ErrRetryable, err)
+		}
+	}
+	return nil
+}
+
+// PublishReads sends every read to the reads topic of its event
+func (s *Sink) PublishReads(reads []db.Read) {
+	if s.opts.Topics.Reads == "" {
+		return
+	}
+	var tokens []paho.Token
+	for _, read := range reads {
+		message := Read{
+			BibNumber:  read.BibNumber,
+			EventID:    read.EventID,
+			Timestamp:  read.Timestamp,
+			AntennaRow: read.AntennaRow,
+			Antenna:    read.Antenna,
+			RaceTimeMs: read.RaceTimeMs,
+		}
+		token, err := s.send(s.opts.Topics.Reads, read.EventID, message, false)
+		if err != nil {
+			log.Printf("Error publishing read to MQTT: %v", err)
+			continue
+		}
+		tokens = append(tokens, token)
+	}
+	go report("reads", tokens)
+}
+
+// PublishPassages sends runners' first reads at an antenna to the finish or
+// split topic of their event
+func (s *Sink) PublishPassages(passages []Passage) {
+	var tokens []paho.Token
+	for _, passage := range passages {
+		topic := s.opts.Topics.Split
+		if passage.Finish {
+			topic = s.opts.Topics.Finish
+		}
+		if topic == "" {
+			continue
+		}
+		token, err := s.send(topic, passage.EventID, passage.Data, false)
+		if err != nil {
+			log.Printf("Error publishing passage to MQTT: %v", err)
+			continue
+		}
+		tokens = append(tokens, token)
+	}
+	go report("passages", tokens)
+}
+
+// Close disconnects from the broker, giving messages in flight a moment to go out
+func (s *Sink) Close() {
+	s.client.Disconnect(250)
+}
+
+// send publishes v as JSON to topic for an event. Messages are queued by the
+// client, so send does not wait for the broker.
+func (s *Sink) send(topic string, eventID int, v interface{}, retained bool) (paho.Token, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding MQTT message: %w", err)
+	}
+	topic = strings.ReplaceAll(topic, "{event}", strconv.Itoa(eventID))
+	return s.client.Publish(topic, s.opts.QoS, retained, payload), nil
+}
+
+// report waits for the tokens of a batch of messages, up to publishTimeout in
+// all, and logs how many could not be published
+func report(what string, tokens []paho.Token) {
+	if len(tokens) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+
+	failed := 0
+	var first error
+	for _, token := range tokens {
+		if err := wait(ctx, token); err != nil {
+			failed++
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	if failed > 0 {
+		log.Printf("Error publishing %d of %d %s to MQTT: %v", failed, len(tokens), what, first)
+	}
+}
+
+// wait waits for a token until ctx is done
+func wait(ctx context.Context, token paho.Token) error {
+	select {
+	case <-token.Done():
+		return token.Error()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,265 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/jimmitjoo/livestream-results/pkg/db"
+	"github.com/jimmitjoo/livestream-results/pkg/publisher"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+var defaultTopics = Topics{
+	Reads:       "race/{event}/reads",
+	Split:       "race/{event}/split",
+	Finish:      "race/{event}/finish",
+	Leaderboard: "race/{event}/leaderboard",
+}
+
+// message is a message as the broker got it
+type message struct {
+	Topic    string
+	Payload  string
+	QoS      byte
+	Retained bool
+}
+
+// recorder keeps every message published to a broker
+type recorder struct {
+	mu       sync.Mutex
+	messages []message
+}
+
+func (r *recorder) record(topic string, payload []byte, qos byte, retained bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = append(r.messages, message{topic, string(payload), qos, retained})
+}
+
+// wait returns the messages once there are n, sorted by topic
+func (r *recorder) wait(t *testing.T, n int) []message {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		r.mu.Lock()
+		messages := append([]message(nil), r.messages...)
+		r.mu.Unlock()
+		if len(messages) >= n {
+			sort.SliceStable(messages, func(i, j int) bool { return messages[i].Topic < messages[j].Topic })
+			return messages
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d messages, want %d: %+v", len(messages), n, messages)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// startBroker serves a Broker on a free port and returns its URL
+func startBroker(t *testing.T) (*recorder, string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &recorder{}
+	broker := &Broker{OnPublish: r.record}
+	go broker.Serve(listener)
+	t.Cleanup(func() { broker.Close() })
+	return r, "tcp://" + listener.Addr().String()
+}
+
+// newSink connects a Sink to the broker at url
+func newSink(t *testing.T, url string, qos byte, topics Topics) *Sink {
+	t.Helper()
+	s, err := New(Options{Broker: url, ClientID: t.Name(), QoS: qos, Topics: topics})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(s.Close)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !s.client.IsConnectionOpen() {
+		if time.Now().After(deadline) {
+			t.Fatal("the sink did not connect")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return s
+}
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func TestNewRejectsQoS(t *testing.T) {
+	if _, err := New(Options{Broker: "tcp://127.0.0.1:1", QoS: 3}); err == nil {
+		t.Error("New accepted QoS 3")
+	}
+}
+
+func TestPublishReadsToEventTopics(t *testing.T) {
+	r, url := startBroker(t)
+	s := newSink(t, url, 1, defaultTopics)
+
+	raceTime := int64(2100000)
+	s.PublishReads([]db.Read{
+		{BibNumber: 5, EventID: 2, Timestamp: "2024-05-04 10:35:00.000", AntennaRow: intPtr(2), Antenna: intPtr(1), RaceTimeMs: &raceTime},
+		{BibNumber: 10, EventID: 3, Timestamp: "2024-05-04 10:36:00.000"},
+	})
+
+	messages := r.wait(t, 2)
+	if messages[0].Topic != "race/2/reads" || messages[1].Topic != "race/3/reads" {
+		t.Fatalf("topics = %s, %s, want race/2/reads and race/3/reads", messages[0].Topic, messages[1].Topic)
+	}
+	var read Read
+	if err := json.Unmarshal([]byte(messages[0].Payload), &read); err != nil {
+		t.Fatalf("payload %s: %v", messages[0].Payload, err)
+	}
+	if read.BibNumber != 5 || read.EventID != 2 || read.Antenna == nil || *read.Antenna != 1 || read.RaceTimeMs == nil || *read.RaceTimeMs != raceTime {
+		t.Errorf("read = %+v", read)
+	}
+	if messages[0].Retained {
+		t.Error("reads are retained")
+	}
+}
+
+func TestPublishPassagesToFinishAndSplitTopics(t *testing.T) {
+	r, url := startBroker(t)
+	topics := defaultTopics
+	topics.Finish = "arena/{event}/mal"
+	s := newSink(t, url, 1, topics)
+
+	s.PublishPassages([]Passage{
+		{Finish: true, EventID: 2, Data: map[string]int{"bibNumber": 5}},
+		{Finish: false, EventID: 3, Data: map[string]int{"bibNumber": 10}},
+	})
+
+	messages := r.wait(t, 2)
+	if messages[0].Topic != "arena/2/mal" || messages[0].Payload != `{"bibNumber":5}` {
+		t.Errorf("finish = %+v", messages[0])
+	}
+	if messages[1].Topic != "race/3/split" || messages[1].Payload != `{"bibNumber":10}` {
+		t.Errorf("split = %+v", messages[1])
+	}
+}
+
+func TestEmptyTopicTurnsMessagesOff(t *testing.T) {
+	r, url := startBroker(t)
+	topics := defaultTopics
+	topics.Reads = ""
+	topics.Split = ""
+	s := newSink(t, url, 1, topics)
+
+	s.PublishReads([]db.Read{{BibNumber: 5, EventID: 2}})
+	s.PublishPassages([]Passage{{EventID: 2}, {Finish: true, EventID: 2}})
+
+	if messages := r.wait(t, 1); len(messages) != 1 || messages[0].Topic != "race/2/finish" {
+		t.Errorf("messages = %+v, want only the finish", messages)
+	}
+}
+
+func TestPublishWithQoS(t *testing.T) {
+	for _, qos := range []byte{0, 1, 2} {
+		t.Run(fmt.Sprint(qos), func(t *testing.T) {
+			r, url := startBroker(t)
+			s := newSink(t, url, qos, defaultTopics)
+
+			s.PublishReads([]db.Read{{BibNumber: 5, EventID: 2}})
+			if err := s.Publish(context.Background(), []db.ResultRow{{Position: 1, BibNumber: 5, EventID: 2}}); err != nil {
+				t.Fatalf("Publish: %v", err)
+			}
+
+			for _, m := range r.wait(t, 2) {
+				if m.QoS != qos {
+					t.Errorf("%s was published with QoS %d, want %d", m.Topic, m.QoS, qos)
+				}
+			}
+		})
+	}
+}
+
+func TestLateSubscriberGetsRetainedLeaderboard(t *testing.T) {
+	_, url := startBroker(t)
+	s := newSink(t, url, 1, defaultTopics)
+
+	raceTime := int64(35 * time.Minute / time.Millisecond)
+	rows := []db.ResultRow{
+		{Position: 1, BibNumber: 5, FirstName: "Anna", LastName: "Berg", Club: "IFK", EventID: 3, EventName: "Mila D21", Timestamp: "2024-05-04 10:35:00.000", RaceTimeMs: &raceTime},
+		{Position: 1, BibNumber: 1, FirstName: "Per", LastName: "Lund", EventID: 2, EventName: "Mila H21", Timestamp: "2024-05-04 10:36:00.000"},
+		{Position: 2, BibNumber: 6, FirstName: "Eva", LastName: "Ek", EventID: 3, EventName: "Mila D21", Timestamp: "2024-05-04 10:37:00.000"},
+		// A read of an unknown bib has no leaderboard
+		{BibNumber: 99, Timestamp: "2024-05-04 10:38:00.000"},
+	}
+	if err := s.Publish(context.Background(), rows); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	// Subscribe only after the leaderboards were published
+	received := make(chan paho.Message, 10)
+	subscriber := paho.NewClient(paho.NewClientOptions().AddBroker(url).SetClientID("board"))
+	if token := subscriber.Connect(); !token.WaitTimeout(5*time.Second) || token.Error() != nil {
+		t.Fatalf("connecting subscriber: %v", token.Error())
+	}
+	defer subscriber.Disconnect(0)
+	token := subscriber.Subscribe("race/+/leaderboard", 0, func(_ paho.Client, m paho.Message) {
+		received <- m
+	})
+	if !token.WaitTimeout(5*time.Second) || token.Error() != nil {
+		t.Fatalf("subscribing: %v", token.Error())
+	}
+
+	boards := make(map[string]Leaderboard)
+	for len(boards) < 2 {
+		select {
+		case m := <-received:
+			if !m.Retained() || m.Qos() != 0 {
+				t.Errorf("%s: retained %v with QoS %d, want retained with the subscription's QoS 0", m.Topic(), m.Retained(), m.Qos())
+			}
+			var board Leaderboard
+			if err := json.Unmarshal(m.Payload(), &board); err != nil {
+				t.Fatalf("payload %s: %v", m.Payload(), err)
+			}
+			boards[m.Topic()] = board
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got %d retained leaderboards, want 2", len(boards))
+		}
+	}
+
+	women := boards["race/3/leaderboard"]
+	if women.EventID != 3 || women.EventName != "Mila D21" || len(women.Results) != 2 {
+		t.Fatalf("race/3/leaderboard = %+v", women)
+	}
+	if first := women.Results[0]; first.Position != 1 || first.BibNumber != 5 || first.Name != "Anna Berg" || first.Club != "IFK" || first.Time != "0:35:00" {
+		t.Errorf("first = %+v", first)
+	}
+	if men := boards["race/2/leaderboard"]; len(men.Results) != 1 || men.Results[0].Time != "10:36:00" {
+		t.Errorf("race/2/leaderboard = %+v", men)
+	}
+}
+
+func TestPublishWithoutBrokerIsRetryable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "tcp://" + listener.Addr().String()
+	listener.Close()
+
+	s, err := New(Options{Broker: url, ClientID: t.Name(), QoS: 1, Topics: defaultTopics})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer s.Close()
+
+	err = s.Publish(context.Background(), []db.ResultRow{{Position: 1, BibNumber: 5, EventID: 2}})
+	if !errors.Is(err, publisher.ErrRetryable) {
+		t.Errorf("Publish error = %v, want ErrRetryable", err)
+	}
+}
@@ -0,0 +1,289 @@
+// Package notify sends participants who opted in a message with their time and
+// placement when they finish, by SMS through an HTTP gateway or by email.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/jimmitjoo/livestream-results/pkg/db"
+	"log"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Channels a participant can be notified on
+const (
+	SMS   = "sms"
+	Email = "email"
+)
+
+const (
+	// sendTimeout limits how long a provider may take to accept a message
+	sendTimeout = 30 * time.Second
+	// idleCheck is how often the queue is checked when nothing is pending
+	idleCheck = time.Minute
+	batchSize = 20
+)
+
+// Message is a text to one recipient. Subject is only used for email.
+type Message struct {
+	Channel string
+	To      string
+	Subject string
+	Body    string
+}
+
+// Provider delivers messages of one channel
+type Provider interface {
+	Name() string
+	Send(ctx context.Context, m Message) error
+}
+
+// Finish is what the templates are filled with
+type Finish struct {
+	Name      string
+	FirstName string
+	LastName  string
+	BibNumber int
+	Club      string
+	EventName string
+	// Time is the race time, or the time of day without a start time
+	Time string
+	// Position is 0 when the runner is not ranked
+	Position int
+}
+
+// Options configures a Notifier. A channel without a provider is off.
+type Options struct {
+	SMS           Provider
+	Email         Provider
+	SMSTemplate   string
+	EmailSubject  string
+	EmailTemplate string
+	// RatePerMinute limits how many messages are sent a minute, 0 for no limit
+	RatePerMinute int
+}
+
+// Notifier queues finish messages for participants who opted in and sends
+// them in the background, no faster than the rate limit. Messages are stored
+// before they are sent, which is also the log of what every participant got,
+// so pending ones survive a restart.
+type Notifier struct {
+	database  *sql.DB
+	providers map[string]Provider
+	templates map[string][2]*template.Template
+	interval  time.Duration
+	wake      chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// New creates a Notifier and starts sending, beginning with messages left
+// pending by the last run
+func New(database *sql.DB, opts Options) (*Notifier, error) {
+	n := &Notifier{
+		database:  database,
+		providers: make(map[string]Provider),
+		templates: make(map[string][2]*template.Template),
+		wake:      make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	if opts.RatePerMinute > 0 {
+		n.interval = time.Minute / time.Duration(opts.RatePerMinute)
+	}
+
+	channels := []struct {
+		name     string
+		provider Provider
+		subject  string
+		body     string
+	}{
+		{SMS, opts.SMS, "", opts.SMSTemplate},
+		{Email, opts.Email, opts.EmailSubject, opts.EmailTemplate},
+	}
+	for _, c := range channels {
+		if c.provider == nil {
+			continue
+		}
+		subject, err := parse(c.name+" subject", c.subject)
+		if err != nil {
+			return nil, err
+		}
+		body, err := parse(c.name, c.body)
+		if err != nil {
+			return nil, err
+		}
+		n.providers[c.name] = c.provider
+		n.templates[c.name] = [2]*template.Template{subject, body}
+	}
+
+	go n.run()
+	return n, nil
+}
+
+// parse parses a template and tries it, so mistakes show at startup and not
+// when the first runner finishes
+func parse(name string, text string) (*template.Template, error) {
+	t, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s template: %w", name, err)
+	}
+	if err := t.Execute(&bytes.Buffer{}, Finish{}); err != nil {
+		return nil, fmt.Errorf("error in %s template: %w", name, err)
+	}
+	return t, nil
+}
+
+// Providers returns the names of the providers of each channel
+func (n *Notifier) Providers() map[string]string {
+	names := make(map[string]string)
+	for channel, provider := range n.providers {
+		names[channel] = provider.Name()
+	}
+	return names
+}
+
+// Finish queues messages about a finish for a participant who opted in, one per
+// channel they have an address for. A participant is only notified of their
+// first finish in an event, later calls are ignored.
+func (n *Notifier) Finish(participant db.Participant, finish Finish) error {
+	if !participant.NotifyFinish {
+		return nil
+	}
+
+	queued := false
+	for channel, recipient := range map[string]string{SMS: participant.Phone, Email: participant.Email} {
+		recipient = strings.TrimSpace(recipient)
+		if recipient == "" || n.providers[channel] == nil {
+			continue
+		}
+		subject, body, err := n.render(channel, finish)
+		if err != nil {
+			return err
+		}
+		_, created, err := db.CreateNotification(n.database, db.Notification{
+			ParticipantID: participant.ParticipantID,
+			EventID:       participant.EventID,
+			Channel:       channel,
+			Recipient:     recipient,
+			Subject:       subject,
+			Body:          body,
+		})
+		if err != nil {
+			return err
+		}
+		queued = queued || created
+	}
+	if queued {
+		n.Wake()
+	}
+	return nil
+}
+
+// render fills the subject and body templates of a channel
+func (n *Notifier) render(channel string, finish Finish) (string, string, error) {
+	var texts [2]string
+	for i, t := range n.templates[channel] {
+		var b strings.Builder
+		if err := t.Execute(&b, finish); err != nil {
+			return "", "", fmt.Errorf("error rendering %s: %w", t.Name(), err)
+		}
+		texts[i] = strings.TrimSpace(b.String())
+	}
+	return texts[0], texts[1], nil
+}
+
+// Wake makes the notifier look for pending messages at once
+func (n *Notifier) Wake() {
+	select {
+	case n.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops sending after the current message. Messages that are still
+// pending are sent after the next start.
+func (n *Notifier) Close() {
+	close(n.stop)
+	<-n.done
+}
+
+func (n *Notifier) run() {
+	defer close(n.done)
+
+	var last time.Time
+	for {
+		if !n.sendPending(&last) {
+			return
+		}
+
+		timer := time.NewTimer(idleCheck)
+		select {
+		case <-timer.C:
+		case <-n.wake:
+			timer.Stop()
+		case <-n.stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// sendPending sends every pending message, a batch at a time, keeping to the
+// rate limit. It returns false when the notifier is closed meanwhile.
+func (n *Notifier) sendPending(last *time.Time) bool {
+	for {
+		notifications, err := db.PendingNotifications(n.database, batchSize)
+		if err != nil {
+			log.Printf("Error reading notification queue: %v", err)
+			return true
+		}
+		if len(notifications) == 0 {
+			return true
+		}
+
+		for _, notification := range notifications {
+			timer := time.NewTimer(time.Until(last.Add(n.interval)))
+			select {
+			case <-timer.C:
+			case <-n.stop:
+				timer.Stop()
+				return false
+			}
+			*last = time.Now()
+			n.send(notification)
+		}
+	}
+}
+
+// send sends a message once and records the outcome
+func (n *Notifier) send(notification db.Notification) {
+	notification.Status = db.NotificationSent
+	provider := n.providers[notification.Channel]
+	if provider == nil {
+		notification.Status = db.NotificationFailed
+		notification.Error = fmt.Sprintf("no %s provider configured", notification.Channel)
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		err := provider.Send(ctx, Message{
+			Channel: notification.Channel,
+			To:      notification.Recipient,
+			Subject: notification.Subject,
+			Body:    notification.Body,
+		})
+		cancel()
+		if err != nil {
+			notification.Status = db.NotificationFailed
+			notification.Error = err.Error()
+			log.Printf("Error sending %s notification %d with %s: %v", notification.Channel, notification.NotificationID, provider.Name(), err)
+		}
+	}
+
+	if err := db.RecordNotification(n.database, notification); err != nil {
+		log.Printf("Error recording notification %d: %v", notification.NotificationID, err)
+	}
+}
@@ -0,0 +1,278 @@
+package notify
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/jimmitjoo/livestream-results/pkg/db"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	smsTemplate   = "{{.FirstName}}, you finished {{.EventName}} in {{.Time}}{{if .Position}}, number {{.Position}}{{end}}."
+	emailSubject  = "Your time in {{.EventName}}"
+	emailTemplate = `
+Hi {{.Name}} ({{.BibNumber}}{{with .Club}}, {{.}}{{end}}),
+
+your time is {{.Time}}.
+`
+)
+
+func setupDatabase(t *testing.T) *sql.DB {
+	t.Helper()
+	database, err := db.SetupDatabase(filepath.Join(t.TempDir(), "race.db"))
+	if err != nil {
+		t.Fatalf("SetupDatabase: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database
+}
+
+// createParticipant registers a participant in a new event
+func createParticipant(t *testing.T, database *sql.DB, participant db.Participant) db.Participant {
+	t.Helper()
+	eventID, err := db.InsertEvent(database, db.Event{EventName: fmt.Sprintf("Mila %d", participant.BibNumber)})
+	if err != nil {
+		t.Fatalf("InsertEvent: %v", err)
+	}
+	participant.EventID = eventID
+	participant.FirstName = "Anna"
+	participant.LastName = "Berg"
+	participantID, err := db.CreateParticipant(database, participant)
+	if err != nil {
+		t.Fatalf("CreateParticipant: %v", err)
+	}
+	participant, err = db.GetParticipant(database, participantID)
+	if err != nil {
+		t.Fatalf("GetParticipant: %v", err)
+	}
+	return participant
+}
+
+func newNotifier(t *testing.T, database *sql.DB, opts Options) *Notifier {
+	t.Helper()
+	if opts.SMSTemplate == "" {
+		opts.SMSTemplate = smsTemplate
+	}
+	if opts.EmailSubject == "" {
+		opts.EmailSubject = emailSubject
+	}
+	if opts.EmailTemplate == "" {
+		opts.EmailTemplate = emailTemplate
+	}
+	n, err := New(database, opts)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(n.Close)
+	return n
+}
+
+func finishOf(participant db.Participant) Finish {
+	return Finish{
+		Name:      participant.FirstName + " " + participant.LastName,
+		FirstName: participant.FirstName,
+		LastName:  participant.LastName,
+		BibNumber: participant.BibNumber,
+		Club:      participant.Club,
+		EventName: "Mila",
+		Time:      "0:35:12",
+		Position:  3,
+	}
+}
+
+// waitSent waits until the stub got n messages
+func waitSent(t *testing.T, stub *Stub, n int) []Message {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		sent := stub.Sent()
+		if len(sent) >= n {
+			return sent
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d messages sent, want %d", len(sent), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// waitStatus waits until every notification of a participant has left the queue
+func waitStatus(t *testing.T, database *sql.DB, participantID int) []db.Notification {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		notifications, err := db.ListNotifications(database, participantID)
+		if err != nil {
+			t.Fatalf("ListNotifications: %v", err)
+		}
+		pending := false
+		for _, notification := range notifications {
+			pending = pending || notification.Status == db.NotificationPending
+		}
+		if !pending {
+			return notifications
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("notifications still pending: %+v", notifications)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestNewRejectsBadTemplates(t *testing.T) {
+	database := setupDatabase(t)
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"syntax", Options{SMS: &Stub{}, SMSTemplate: "{{.Time"}},
+		{"unknown field", Options{SMS: &Stub{}, SMSTemplate: "{{.Pace}}"}},
+		{"subject", Options{Email: &Stub{}, EmailSubject: "{{.Time", EmailTemplate: "{{.Time}}"}},
+	}
+	for _, test := range tests {
+		if n, err := New(database, test.opts); err == nil {
+			n.Close()
+			t.Errorf("%s: New accepted the template", test.name)
+		}
+	}
+}
+
+func TestFinishRendersTemplates(t *testing.T) {
+	database := setupDatabase(t)
+	sms, email := &Stub{}, &Stub{}
+	n := newNotifier(t, database, Options{SMS: sms, Email: email})
+	participant := createParticipant(t, database, db.Participant{BibNumber: 5, Club: "IFK", Phone: " +46701234567 ", Email: "anna@example.com", NotifyFinish: true})
+
+	if err := n.Finish(participant, finishOf(participant)); err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+
+	text := waitSent(t, sms, 1)[0]
+	if text.To != "+46701234567" || text.Body != "Anna, you finished Mila in 0:35:12, number 3." || text.Subject != "" {
+		t.Errorf("SMS = %+v", text)
+	}
+	mail := waitSent(t, email, 1)[0]
+	if mail.To != "anna@example.com" || mail.Subject != "Your time in Mila" || mail.Body != "Hi Anna Berg (5, IFK),\n\nyour time is 0:35:12." {
+		t.Errorf("email = %+v", mail)
+	}
+
+	// Without a position the placement is left out
+	unranked := createParticipant(t, database, db.Participant{BibNumber: 6, Phone: "+46707654321", NotifyFinish: true})
+	finish := finishOf(unranked)
+	finish.Position = 0
+	if err := n.Finish(unranked, finish); err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+	if text := waitSent(t, sms, 2)[1]; text.Body != "Anna, you finished Mila in 0:35:12." {
+		t.Errorf("SMS without position = %q", text.Body)
+	}
+}
+
+func TestFinishOnlyNotifiesThoseWhoOptedIn(t *testing.T) {
+	database := setupDatabase(t)
+	sms := &Stub{}
+	// Email has no provider, so it is off
+	n := newNotifier(t, database, Options{SMS: sms})
+
+	tests := []struct {
+		name        string
+		participant db.Participant
+		want        int
+	}{
+		{"not opted in", db.Participant{BibNumber: 1, Phone: "+46701", Email: "a@example.com"}, 0},
+		{"no address", db.Participant{BibNumber: 2, Phone: "  ", NotifyFinish: true}, 0},
+		{"email only", db.Participant{BibNumber: 3, Email: "c@example.com", NotifyFinish: true}, 0},
+		{"phone", db.Participant{BibNumber: 4, Phone: "+46704", Email: "d@example.com", NotifyFinish: true}, 1},
+	}
+	for _, test := range tests {
+		participant := createParticipant(t, database, test.participant)
+		if err := n.Finish(participant, finishOf(participant)); err != nil {
+			t.Fatalf("%s: Finish: %v", test.name, err)
+		}
+		notifications, err := db.ListNotifications(database, participant.ParticipantID)
+		if err != nil {
+			t.Fatalf("ListNotifications: %v", err)
+		}
+		if len(notifications) != test.want {
+			t.Errorf("%s: %d notifications, want %d", test.name, len(notifications), test.want)
+		}
+	}
+
+	if sent := waitSent(t, sms, 1); len(sent) != 1 || sent[0].To != "+46704" {
+		t.Errorf("sent %+v, want only the SMS to +46704", sent)
+	}
+}
+
+func TestFinishNotifiesOncePerEvent(t *testing.T) {
+	database := setupDatabase(t)
+	sms, email := &Stub{}, &Stub{}
+	n := newNotifier(t, database, Options{SMS: sms, Email: email})
+	participant := createParticipant(t, database, db.Participant{BibNumber: 5, Phone: "+46701234567", Email: "anna@example.com", NotifyFinish: true})
+
+	if err := n.Finish(participant, finishOf(participant)); err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+	waitStatus(t, database, participant.ParticipantID)
+
+	// A later finish, e.g. from a duplicate read, is not sent
+	finish := finishOf(participant)
+	finish.Time = "0:36:00"
+	if err := n.Finish(participant, finish); err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+	n.Wake()
+	time.Sleep(50 * time.Millisecond)
+
+	if got := len(sms.Sent()) + len(email.Sent()); got != 2 {
+		t.Errorf("%d messages sent, want one SMS and one email", got)
+	}
+	notifications := waitStatus(t, database, participant.ParticipantID)
+	if len(notifications) != 2 {
+		t.Fatalf("%d notifications logged, want 2", len(notifications))
+	}
+	for _, notification := range notifications {
+		if notification.Status != db.NotificationSent || notification.SentAt == "" || notification.EventID != participant.EventID || strings.Contains(notification.Body, "0:36:00") {
+			t.Errorf("notification = %+v, want the first finish sent", notification)
+		}
+	}
+}
+
+func TestFailedSendIsLogged(t *testing.T) {
+	database := setupDatabase(t)
+	n := newNotifier(t, database, Options{SMS: &Stub{Fail: true}})
+	participant := createParticipant(t, database, db.Participant{BibNumber: 5, Phone: "+46701234567", NotifyFinish: true})
+
+	if err := n.Finish(participant, finishOf(participant)); err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+
+	notifications := waitStatus(t, database, participant.ParticipantID)
+	if len(notifications) != 1 || notifications[0].Status != db.NotificationFailed || !strings.Contains(notifications[0].Error, "refused") {
+		t.Errorf("notifications = %+v, want one failed", notifications)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	database := setupDatabase(t)
+	sms := &Stub{}
+	const messages = 4
+	// One message every 100 ms
+	n := newNotifier(t, database, Options{SMS: sms, RatePerMinute: 600})
+
+	started := time.Now()
+	for bibNumber := 1; bibNumber <= messages; bibNumber++ {
+		participant := createParticipant(t, database, db.Participant{BibNumber: bibNumber, Phone: fmt.Sprintf("+4670%d", bibNumber), NotifyFinish: true})
+		if err := n.Finish(participant, finishOf(participant)); err != nil {
+			t.Fatalf("Finish: %v", err)
+		}
+	}
+
+	waitSent(t, sms, messages)
+	// The first message goes at once and each one after waits its turn
+	if elapsed, want := time.Since(started), (messages-1)*100*time.Millisecond; elapsed < want {
+		t.Errorf("%d messages sent in %s, want at least %s", messages, elapsed, want)
+	}
+}
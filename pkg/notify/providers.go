@@ -0,0 +1,128 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SMTP sends email through an SMTP server, with STARTTLS when the server offers it
+type SMTP struct {
+	// Addr is the host and port of the server, e.g. smtp.example.com:587
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+func (p *SMTP) Name() string {
+	return "smtp:" + p.Addr
+}
+
+// Send sends an email. The SMTP client has no deadlines, so ctx is not used.
+func (p *SMTP) Send(ctx context.Context, m Message) error {
+	var auth smtp.Auth
+	if p.Username != "" {
+		host, _, err := net.SplitHostPort(p.Addr)
+		if err != nil {
+			return fmt.Errorf("invalid SMTP address %s: %w", p.Addr, err)
+		}
+		auth = smtp.PlainAuth("", p.Username, p.Password, host)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", p.From)
+	fmt.Fprintf(&b, "To: %s\r\n", m.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(m.Body, "\n", "\r\n"))
+	b.WriteString("\r\n")
+
+	if err := smtp.SendMail(p.Addr, auth, p.From, []string{m.To}, []byte(b.String())); err != nil {
+		return fmt.Errorf("error sending email: %w", err)
+	}
+	return nil
+}
+
+// HTTPGateway sends SMS through a gateway that takes a JSON POST of
+// {"from", "to", "message"}, with Token as a bearer token when set
+type HTTPGateway struct {
+	URL    string
+	Token  string
+	From   string
+	client http.Client
+}
+
+func (p *HTTPGateway) Name() string {
+	return "sms:" + p.URL
+}
+
+func (p *HTTPGateway) Send(ctx context.Context, m Message) error {
+	body, err := json.Marshal(map[string]string{"from": p.From, "to": m.To, "message": m.Body})
+	if err != nil {
+		return fmt.Errorf("error encoding SMS: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating SMS request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.Token)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error posting SMS: %w", err)
+	}
+	defer resp.Body.Close()
+	answer, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("SMS gateway responded with status %s: %s", resp.Status, strings.TrimSpace(string(answer)))
+	}
+	return nil
+}
+
+// Stub only logs messages and keeps them, to rehearse notifications and for
+// tests. Set Fail to make it refuse messages.
+type Stub struct {
+	Fail bool
+
+	mu   sync.Mutex
+	sent []Message
+}
+
+func (p *Stub) Name() string {
+	return "stub"
+}
+
+func (p *Stub) Send(ctx context.Context, m Message) error {
+	if p.Fail {
+		return fmt.Errorf("stub refused the message")
+	}
+	p.mu.Lock()
+	p.sent = append(p.sent, m)
+	p.mu.Unlock()
+	log.Printf("Stub %s to %s: %s", m.Channel, m.To, strings.Join(strings.Fields(m.Subject+" "+m.Body), " "))
+	return nil
+}
+
+// Sent returns the messages the stub got, oldest first
+func (p *Stub) Sent() []Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Message(nil), p.sent...)
+}
@@ -0,0 +1,120 @@
+// Package overlay serves HTML pages for use as browser sources in OBS and other
+// streaming software. The pages have a transparent background and follow the
+// public live results.
+package overlay
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+//go:embed templates/*.html
+var builtin embed.FS
+
+// Data is what a template is rendered with, taken from the query string
+type Data struct {
+	// Event is the race or class to follow, zero follows all
+	Event int
+	// Count is the number of rows in a leaderboard
+	Count int
+	// Seconds is how long a popup stays on screen
+	Seconds int
+}
+
+// Handler serves /overlay/{name}, rendering the template {name}.html
+type Handler struct {
+	templates map[string]*template.Template
+}
+
+// New loads the built-in templates. Templates in dir, when it is given, are
+// added and replace built-in templates with the same file name.
+func New(dir string) (*Handler, error) {
+	h := &Handler{templates: make(map[string]*template.Template)}
+
+	entries, err := builtin.ReadDir("templates")
+	if err != nil {
+		return nil, fmt.Errorf("error listing overlay templates: %w", err)
+	}
+	for _, entry := range entries {
+		b, err := builtin.ReadFile("templates/" + entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("error reading overlay template: %w", err)
+		}
+		if err := h.add(entry.Name(), b); err != nil {
+			return nil, err
+		}
+	}
+
+	if dir != "" {
+		paths, err := filepath.Glob(filepath.Join(dir, "*.html"))
+		if err != nil {
+			return nil, fmt.Errorf("error listing overlay templates: %w", err)
+		}
+		for _, path := range paths {
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("error reading overlay template: %w", err)
+			}
+			if err := h.add(filepath.Base(path), b); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return h, nil
+}
+
+func (h *Handler) add(file string, b []byte) error {
+	t, err := template.New(file).Parse(string(b))
+	if err != nil {
+		return fmt.Errorf("error parsing overlay template %s: %w", file, err)
+	}
+	h.templates[strings.TrimSuffix(file, ".html")] = t
+	return nil
+}
+
+// ServeHTTP renders an overlay. ?event= selects the race or class, ?count= the
+// leaderboard length and ?seconds= how long a popup is shown.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/overlay/"), "/")
+	t, ok := h.templates[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	data := Data{Count: 10, Seconds: 8}
+	for param, value := range map[string]*int{"event": &data.Event, "count": &data.Count, "seconds": &data.Seconds} {
+		v := r.URL.Query().Get(param)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, param+" must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		*value = n
+	}
+
+	// Render first, so a broken custom template gives an error instead of half a page
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		http.Error(w, fmt.Sprintf("error rendering overlay: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(buf.Bytes())
+}
@@ -29,7 +29,54 @@ func parseIntField(field string) (*int, error) {
 	return &value, nil
 }
 
-// ParseTimingFile parses the timing data file and returns a slice of TimingResult
+// MalformedError is returned together with the parsed results when lines of a
+// timing file could not be parsed. Those lines are skipped, so a half-written
+// last line is read again on the next change of the file.
+type MalformedError struct {
+	// Lines is the number of lines that were skipped
+	Lines int
+	// Line is the line number of the first of them
+	Line int
+	Err  error
+}
+
+func (e *MalformedError) Error() string {
+	return fmt.Sprintf("%d malformed lines skipped, first on line %d: %v", e.Lines, e.Line, e.Err)
+}
+
+func (e *MalformedError) Unwrap() error {
+	return e.Err
+}
+
+// parseLine parses one line of bib number, timestamp, antenna row and antenna,
+// separated by tabs. The antenna fields may be empty but not missing.
+func parseLine(line string) (TimingResult, error) {
+	parts := strings.Split(line, "\t")
+	if len(parts) < 4 {
+		return TimingResult{}, fmt.Errorf("expected 4 fields, got %d", len(parts))
+	}
+	bibNumber, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return TimingResult{}, fmt.Errorf("error parsing bib number: %w", err)
+	}
+	timestamp, err := time.Parse("2006-01-02 15:04:05.000", parts[1])
+	if err != nil {
+		return TimingResult{}, fmt.Errorf("error parsing timestamp: %w", err)
+	}
+	antennaRow, err := parseIntField(parts[2])
+	if err != nil {
+		return TimingResult{}, fmt.Errorf("error parsing antenna_row: %w", err)
+	}
+	antenna, err := parseIntField(parts[3])
+	if err != nil {
+		return TimingResult{}, fmt.Errorf("error parsing antenna: %w", err)
+	}
+	return TimingResult{BibNumber: bibNumber, Timestamp: timestamp, AntennaRow: antennaRow, Antenna: antenna}, nil
+}
+
+// ParseTimingFile parses the timing data file and returns a slice of TimingResult.
+// Blank lines are ignored. When other lines cannot be parsed the rest are still
+// returned, with a *MalformedError.
 func ParseTimingFile(filePath string) ([]TimingResult, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -39,38 +86,30 @@ func ParseTimingFile(filePath string) ([]TimingResult, error) {
 
 	scanner := bufio.NewScanner(file)
 	var results []TimingResult
+	var malformed *MalformedError
 
-	for scanner.Scan() {
+	for number := 1; scanner.Scan(); number++ {
 		line := scanner.Text()
-		parts := strings.Split(line, "\t")
-		if len(parts) >= 2 {
-			bibNumber, err := strconv.Atoi(parts[0])
-			if err != nil {
-				fmt.Println("error parsing bib number:", err)
-				continue
-			}
-			timestamp, err := time.Parse("2006-01-02 15:04:05.000", parts[1])
-			if err != nil {
-				fmt.Println("error parsing timestamp:", err)
-				continue
-			}
-			antennaRow, err := parseIntField(parts[2])
-			if err != nil {
-				fmt.Println("error parsing antenna_row:", err)
-				continue
-			}
-			antenna, err := parseIntField(parts[3])
-			if err != nil {
-				fmt.Println("error parsing antenna:", err)
-				continue
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		result, err := parseLine(line)
+		if err != nil {
+			if malformed == nil {
+				malformed = &MalformedError{Line: number, Err: err}
 			}
-			results = append(results, TimingResult{BibNumber: bibNumber, Timestamp: timestamp, AntennaRow: antennaRow, Antenna: antenna})
+			malformed.Lines++
+			continue
 		}
+		results = append(results, result)
 	}
 
 	if err := scanner.Err(); err != nil {
 		return nil, fmt.Errorf("error reading file: %w", err)
 	}
+	if malformed != nil {
+		return results, malformed
+	}
 
 	return results, nil
 }
@@ -0,0 +1,68 @@
+package publisher
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"github.com/jimmitjoo/livestream-results/pkg/db"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// CSVPublisher writes results to a local CSV file
+type CSVPublisher struct {
+	path string
+}
+
+// NewCSVPublisher creates a publisher that writes to the file at path
+func NewCSVPublisher(path string) *CSVPublisher {
+	return &CSVPublisher{path: path}
+}
+
+func (p *CSVPublisher) Name() string {
+	return "csv:" + p.path
+}
+
+func (p *CSVPublisher) Publish(ctx context.Context, rows []db.ResultRow) error {
+	return writeFileAtomic(p.path, func(f *os.File) error {
+		return WriteCSV(f, rows)
+	})
+}
+
+// WriteCSV writes results as CSV with a header row
+func WriteCSV(w io.Writer, rows []db.ResultRow) error {
+	records := [][]string{{"position", "overall_position", "bib_number", "first_name", "last_name", "club", "birthdate", "event", "timestamp"}}
+	for _, row := range rows {
+		records = append(records, []string{strconv.Itoa(row.Position), strconv.Itoa(row.OverallPosition), strconv.Itoa(row.BibNumber), row.FirstName, row.LastName, row.Club, row.Birthdate, row.EventName, row.Timestamp})
+	}
+
+	if err := csv.NewWriter(w).WriteAll(records); err != nil {
+		return fmt.Errorf("error writing csv: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomic writes to a temporary file next to path and renames it into place,
+// so readers never see a half-written file
+func writeFileAtomic(path string, write func(f *os.File) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("error creating temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error closing temporary file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error replacing %s: %w", path, err)
+	}
+	return nil
+}
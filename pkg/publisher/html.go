@@ -0,0 +1,69 @@
+package publisher
+
+import (
+	"context"
+	"fmt"
+	"github.com/jimmitjoo/livestream-results/pkg/db"
+	"html/template"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// htmlTemplate shows times like the Sheets publisher, see DisplayTime
+var htmlTemplate = template.Must(template.New("results").Funcs(template.FuncMap{"displayTime": DisplayTime}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <meta http-equiv="refresh" content="30">
+    <title>Resultat</title>
+</head>
+<body>
+<h1>Resultat</h1>
+<p>Uppdaterad {{.Updated}}</p>
+<table>
+    <thead>
+    <tr><th>Plac</th><th>Startnr</th><th>Förnamn</th><th>Efternamn</th><th>Förening/Ort</th><th>Född</th><th>Klass</th><th>Tid</th></tr>
+    </thead>
+    <tbody>
+    {{range .Rows}}<tr><td>{{.OverallPosition}}</td><td>{{.BibNumber}}</td><td>{{.FirstName}}</td><td>{{.LastName}}</td><td>{{.Club}}</td><td>{{.Birthdate}}</td><td>{{.Classification}}</td><td>{{displayTime .}}</td></tr>
+    {{end}}</tbody>
+</table>
+</body>
+</html>
+`))
+
+// HTMLPublisher writes a static results page to a directory, e.g. one served by a web server
+type HTMLPublisher struct {
+	dir string
+}
+
+// NewHTMLPublisher creates a publisher that writes index.html into dir
+func NewHTMLPublisher(dir string) *HTMLPublisher {
+	return &HTMLPublisher{dir: dir}
+}
+
+func (p *HTMLPublisher) Name() string {
+	return "html:" + p.dir
+}
+
+func (p *HTMLPublisher) Publish(ctx context.Context, rows []db.ResultRow) error {
+	if err := os.MkdirAll(p.dir, 0755); err != nil {
+		return fmt.Errorf("error creating html directory: %w", err)
+	}
+
+	data := struct {
+		Updated string
+		Rows    []db.ResultRow
+	}{
+		Updated: time.Now().Format("2006-01-02 15:04:05"),
+		Rows:    byOverallPosition(rows),
+	}
+
+	return writeFileAtomic(filepath.Join(p.dir, "index.html"), func(f *os.File) error {
+		if err := htmlTemplate.Execute(f, data); err != nil {
+			return fmt.Errorf("error rendering html: %w", err)
+		}
+		return nil
+	})
+}
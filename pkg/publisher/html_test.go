@@ -0,0 +1,41 @@
+package publisher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHTMLPublisherShowsRaceTimes(t *testing.T) {
+	dir := t.TempDir()
+	rows := results()
+	// Without a start time the time of day is shown
+	rows[1].RaceTimeMs = nil
+
+	if err := NewHTMLPublisher(dir).Publish(context.Background(), rows); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	page, err := os.ReadFile(filepath.Join(dir, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"<tr><td>1</td><td>1</td><td>Per</td><td>Lund</td><td>IK Stern</td><td>1985</td><td>H21</td><td>0:35:00</td></tr>",
+		"<tr><td>2</td><td>5</td><td>Anna</td><td>Berg</td><td>IFK</td><td>1990</td><td>D21</td><td>0:40:00</td></tr>",
+		"<tr><td>3</td><td>6</td><td>Eva</td><td>Ek</td><td>OK Ravinen</td><td>1988</td><td>D21</td><td>10:42:30</td></tr>",
+	}
+	last := -1
+	for _, row := range want {
+		i := strings.Index(string(page), row)
+		if i < 0 {
+			t.Fatalf("page has no row %s:\n%s", row, page)
+		}
+		if i < last {
+			t.Errorf("row %s is out of overall order", row)
+		}
+		last = i
+	}
+}
@@ -0,0 +1,277 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jimmitjoo/livestream-results/pkg/db"
+	"log"
+	"sync"
+	"time"
+)
+
+// Publisher pushes the current results to a destination such as Google Sheets or a local file
+type Publisher interface {
+	Name() string
+	Publish(ctx context.Context, rows []db.ResultRow) error
+}
+
+// LoadFunc retrieves the results that should be published
+type LoadFunc func() ([]db.ResultRow, error)
+
+// ErrRetryable marks a publish error as temporary, e.g. an exceeded API quota.
+// Publishers wrap it so the manager retries the push with backoff.
+var ErrRetryable = errors.New("temporary publish error")
+
+const (
+	// publishTimeout limits how long a single publisher may spend on one push
+	publishTimeout = 30 * time.Second
+
+	// Backoff between retries of a failed push
+	minBackoff = time.Second
+	maxBackoff = 2 * time.Minute
+)
+
+// Status describes the state of one publisher
+type Status struct {
+	Name        string    `json:"name"`
+	Pending     int       `json:"pending"`
+	Publishing  bool      `json:"publishing"`
+	LastSuccess time.Time `json:"lastSuccess"`
+	LastError   string    `json:"lastError,omitempty"`
+	LastErrorAt time.Time `json:"lastErrorAt"`
+	Failures    int       `json:"failures"`
+}
+
+// Manager fans out result changes to all registered publishers. Every publisher
+// runs in its own goroutine so a slow or failing sink never blocks ingestion.
+// Changes are coalesced so each publisher pushes at most once per interval.
+type Manager struct {
+	load     LoadFunc
+	interval time.Duration
+	mu       sync.Mutex
+	sinks    []*sink
+}
+
+type sink struct {
+	publisher Publisher
+	trigger   chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+
+	mu     sync.Mutex
+	status Status
+}
+
+// NewManager creates a Manager that uses load to fetch results before each push
+// and pushes to every publisher at most once per interval
+func NewManager(load LoadFunc, interval time.Duration) *Manager {
+	return &Manager{load: load, interval: interval}
+}
+
+// Add registers a publisher and starts its worker
+func (m *Manager) Add(p Publisher) {
+	s := &sink{
+		publisher: p,
+		trigger:   make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+		status:    Status{Name: p.Name()},
+	}
+
+	m.mu.Lock()
+	m.sinks = append(m.sinks, s)
+	m.mu.Unlock()
+
+	go m.run(s)
+}
+
+// Names returns the names of all registered publishers
+func (m *Manager) Names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.sinks))
+	for _, s := range m.sinks {
+		names = append(names, s.publisher.Name())
+	}
+	return names
+}
+
+// Status returns the current state of every publisher
+func (m *Manager) Status() []Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	statuses := make([]Status, 0, len(m.sinks))
+	for _, s := range m.sinks {
+		s.mu.Lock()
+		statuses = append(statuses, s.status)
+		s.mu.Unlock()
+	}
+	return statuses
+}
+
+// Notify tells every publisher that the results have changed. It never blocks;
+// if a publisher is still busy the notifications are coalesced into one push.
+func (m *Manager) Notify() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, s := range m.sinks {
+		s.mu.Lock()
+		s.status.Pending++
+		s.mu.Unlock()
+
+		select {
+		case s.trigger <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Close stops all publishers. Pending changes get one final push attempt
+// before Close returns.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	sinks := m.sinks
+	m.sinks = nil
+	m.mu.Unlock()
+
+	for _, s := range sinks {
+		close(s.stop)
+	}
+	for _, s := range sinks {
+		<-s.done
+	}
+}
+
+func (m *Manager) run(s *sink) {
+	defer close(s.done)
+
+	var last time.Time
+	for {
+		select {
+		case <-s.trigger:
+		case <-s.stop:
+			if s.pending() > 0 {
+				m.push(s)
+			}
+			return
+		}
+
+		// Wait out the rest of the interval so changes arriving meanwhile are pushed together
+		if wait := m.interval - time.Since(last); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-s.stop:
+			}
+		}
+
+		// Drop a trigger that arrived while waiting, it is covered by this push
+		select {
+		case <-s.trigger:
+		default:
+		}
+
+		backoff := minBackoff
+		for {
+			err := m.push(s)
+			last = time.Now()
+			if err == nil || !errors.Is(err, ErrRetryable) {
+				break
+			}
+
+			log.Printf("Retrying %s in %s", s.publisher.Name(), backoff)
+			select {
+			case <-time.After(backoff):
+			case <-s.stop:
+			}
+			if s.stopped() {
+				break
+			}
+
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+		}
+	}
+}
+
+// push loads the current results and publishes them once
+func (m *Manager) push(s *sink) error {
+	s.mu.Lock()
+	pending := s.status.Pending
+	s.status.Publishing = true
+	s.mu.Unlock()
+
+	err := m.publish(s)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.Publishing = false
+	if err != nil {
+		log.Printf("Error publishing to %s: %v", s.publisher.Name(), err)
+		s.status.LastError = err.Error()
+		s.status.LastErrorAt = time.Now()
+		s.status.Failures++
+		return err
+	}
+
+	s.status.Pending -= pending
+	s.status.LastSuccess = time.Now()
+	s.status.Failures = 0
+	return nil
+}
+
+func (m *Manager) publish(s *sink) error {
+	rows, err := m.load()
+	if err != nil {
+		return fmt.Errorf("error loading results: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+
+	if err := s.publisher.Publish(ctx, rows); err != nil {
+		return err
+	}
+
+	log.Printf("Published %d results to %s", len(rows), s.publisher.Name())
+	return nil
+}
+
+func (s *sink) pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status.Pending
+}
+
+func (s *sink) stopped() bool {
+	select {
+	case <-s.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// New creates a file or network publisher by kind: "csv" (target is a file path),
+// "html" (target is a directory) or "webhook" (target is a URL)
+func New(kind string, target string) (Publisher, error) {
+	if target == "" {
+		return nil, fmt.Errorf("no target given for %s publisher", kind)
+	}
+
+	switch kind {
+	case "csv":
+		return NewCSVPublisher(target), nil
+	case "html":
+		return NewHTMLPublisher(target), nil
+	case "webhook":
+		return NewWebhookPublisher(target), nil
+	default:
+		return nil, fmt.Errorf("unknown publisher type: %s", kind)
+	}
+}
@@ -0,0 +1,76 @@
+package publisher
+
+import (
+	"fmt"
+	"github.com/jimmitjoo/livestream-results/pkg/db"
+	"sort"
+	"time"
+)
+
+// groupByEvent splits results into one list per event, in order of each event's first finisher
+func groupByEvent(rows []db.ResultRow) (byEvent map[string][]db.ResultRow, events []string) {
+	byEvent = make(map[string][]db.ResultRow)
+	for _, row := range rows {
+		if row.EventName == "" {
+			continue
+		}
+		if byEvent[row.EventName] == nil {
+			events = append(events, row.EventName)
+		}
+		byEvent[row.EventName] = append(byEvent[row.EventName], row)
+	}
+	return byEvent, events
+}
+
+// byOverallPosition returns the results ordered by overall position, which
+// follows race times rather than finish times when classes start apart
+func byOverallPosition(rows []db.ResultRow) []db.ResultRow {
+	sorted := append([]db.ResultRow(nil), rows...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].OverallPosition < sorted[j].OverallPosition
+	})
+	return sorted
+}
+
+// DisplayTime is the race time of a result when the start is known, otherwise the time of day
+func DisplayTime(row db.ResultRow) string {
+	if row.RaceTimeMs != nil {
+		return FormatDuration(time.Duration(*row.RaceTimeMs) * time.Millisecond)
+	}
+	if len(row.Timestamp) >= 19 {
+		return row.Timestamp[11:19]
+	}
+	return row.Timestamp
+}
+
+// FormatDuration formats d as h:mm:ss
+func FormatDuration(d time.Duration) string {
+	d = d.Truncate(time.Second)
+	hours := d / time.Hour
+	minutes := (d % time.Hour) / time.Minute
+	seconds := (d % time.Minute) / time.Second
+	return fmt.Sprintf("%d:%02d:%02d", hours, minutes, seconds)
+}
+
+// ReadTime is DisplayTime of a single read, such as a split passage
+func ReadTime(read db.Read) string {
+	return DisplayTime(db.ResultRow{Timestamp: read.Timestamp, RaceTimeMs: read.RaceTimeMs})
+}
+
+// TimeSince shows a time that is not stored, such as a predicted finish, the
+// way DisplayTime shows a stored one
+func TimeSince(t time.Time, start time.Time) string {
+	if !start.IsZero() && !t.Before(start) {
+		return FormatDuration(t.Sub(start))
+	}
+	return t.Format("15:04:05")
+}
+
+// Checkpoint names the antenna a read came from, "Mål" when it is a finish
+// according to db.IsFinish
+func Checkpoint(read db.Read, finishAntenna int) string {
+	if db.IsFinish(read, finishAntenna) {
+		return "Mål"
+	}
+	return fmt.Sprintf("Antenn %d", *read.Antenna)
+}
@@ -0,0 +1,100 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jimmitjoo/livestream-results/pkg/db"
+	"github.com/jimmitjoo/livestream-results/pkg/sheets"
+	"google.golang.org/api/googleapi"
+	"net/http"
+	"sync"
+)
+
+// overallTabName is used for the tab with all classes when no sheet name is configured
+const overallTabName = "Overall"
+
+// SheetsPublisher writes results to a Google Sheets spreadsheet, with one tab
+// per event/class and one tab with the overall results
+type SheetsPublisher struct {
+	service   *sheets.SheetsService
+	mu        sync.Mutex
+	sheetName string
+}
+
+// NewSheetsPublisher creates a publisher using service. sheetName is the name
+// of the overall tab; "Overall" is used when it is empty.
+func NewSheetsPublisher(service *sheets.SheetsService, sheetName string) *SheetsPublisher {
+	return &SheetsPublisher{service: service, sheetName: sheetName}
+}
+
+// SetService changes the Sheets service results are written with
+func (p *SheetsPublisher) SetService(service *sheets.SheetsService) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.service = service
+}
+
+// SetSheetName changes the name of the overall tab
+func (p *SheetsPublisher) SetSheetName(sheetName string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sheetName = sheetName
+}
+
+func (p *SheetsPublisher) Name() string {
+	return "google-sheets"
+}
+
+func (p *SheetsPublisher) Publish(ctx context.Context, rows []db.ResultRow) error {
+	p.mu.Lock()
+	service := p.service
+	overallName := p.sheetName
+	p.mu.Unlock()
+
+	if overallName == "" {
+		overallName = overallTabName
+	}
+
+	byEvent, events := groupByEvent(rows)
+
+	tabs := make([]sheets.Tab, 0, len(events)+1)
+	overallValues := [][]interface{}{{"Plac", "Startnr", "Förnamn", "Efternamn", "Förening/Ort", "Född", "Klass", "Tid"}}
+	for _, row := range byOverallPosition(rows) {
+		overallValues = append(overallValues, []interface{}{row.OverallPosition, row.BibNumber, row.FirstName, row.LastName, row.Club, row.Birthdate, row.Classification, DisplayTime(row)})
+	}
+	tabs = append(tabs, sheets.Tab{Title: overallName, Values: overallValues})
+
+	for _, eventName := range events {
+		values := [][]interface{}{{"Plac", "Startnr", "Förnamn", "Efternamn", "Förening/Ort", "Född", "Tid"}}
+		for _, row := range byEvent[eventName] {
+			values = append(values, []interface{}{row.Position, row.BibNumber, row.FirstName, row.LastName, row.Club, row.Birthdate, DisplayTime(row)})
+		}
+		tabs = append(tabs, sheets.Tab{Title: eventName, Values: values})
+	}
+
+	if err := service.ReplaceTabs(tabs); err != nil {
+		if isQuotaError(err) {
+			return fmt.Errorf("%w: %v", ErrRetryable, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// isQuotaError reports whether err is a rate limit or server error from the Sheets API
+func isQuotaError(err error) bool {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	if apiErr.Code == http.StatusTooManyRequests || apiErr.Code >= 500 {
+		return true
+	}
+	for _, item := range apiErr.Errors {
+		if item.Reason == "rateLimitExceeded" || item.Reason == "userRateLimitExceeded" {
+			return true
+		}
+	}
+	return false
+}
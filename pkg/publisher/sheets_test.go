@@ -0,0 +1,192 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jimmitjoo/livestream-results/pkg/db"
+	"github.com/jimmitjoo/livestream-results/pkg/sheets/sheetstest"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const spreadsheetID = "results"
+
+func raceTime(d time.Duration) *int64 {
+	ms := d.Milliseconds()
+	return &ms
+}
+
+// results has two classes that started apart, so the overall order differs from the finish order
+func results() []db.ResultRow {
+	return []db.ResultRow{
+		{Position: 1, OverallPosition: 2, BibNumber: 5, FirstName: "Anna", LastName: "Berg", Club: "IFK", Birthdate: "1990", EventName: "Mila D21", Classification: "D21", Timestamp: "2024-05-04 10:40:00.000", RaceTimeMs: raceTime(40 * time.Minute)},
+		{Position: 2, OverallPosition: 3, BibNumber: 6, FirstName: "Eva", LastName: "Ek", Club: "OK Ravinen", Birthdate: "1988", EventName: "Mila D21", Classification: "D21", Timestamp: "2024-05-04 10:42:30.000", RaceTimeMs: raceTime(42*time.Minute + 30*time.Second)},
+		{Position: 1, OverallPosition: 1, BibNumber: 1, FirstName: "Per", LastName: "Lund", Club: "IK Stern", Birthdate: "1985", EventName: "Mila H21", Classification: "H21", Timestamp: "2024-05-04 10:50:00.000", RaceTimeMs: raceTime(35 * time.Minute)},
+	}
+}
+
+func newPublisher(t *testing.T, sheetName string, titles ...string) (*sheetstest.Server, *SheetsPublisher) {
+	t.Helper()
+	server := sheetstest.NewServer()
+	t.Cleanup(server.Close)
+	server.AddSpreadsheet(spreadsheetID, titles...)
+
+	service, err := server.NewService(spreadsheetID)
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	return server, NewSheetsPublisher(service, sheetName)
+}
+
+// text turns values as returned by the fake server into strings, numbers come back as float64
+func text(values [][]interface{}) [][]string {
+	rows := make([][]string, 0, len(values))
+	for _, row := range values {
+		cells := make([]string, 0, len(row))
+		for _, cell := range row {
+			cells = append(cells, fmt.Sprint(cell))
+		}
+		rows = append(rows, cells)
+	}
+	return rows
+}
+
+func TestSheetsPublisherWritesOverallAndClassTabs(t *testing.T) {
+	server, p := newPublisher(t, "", "Sheet1")
+
+	if err := p.Publish(context.Background(), results()); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	if got, want := server.Tabs(spreadsheetID), []string{"Sheet1", "Overall", "Mila D21", "Mila H21"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tabs = %v, want %v", got, want)
+	}
+
+	overall := [][]string{
+		{"Plac", "Startnr", "Förnamn", "Efternamn", "Förening/Ort", "Född", "Klass", "Tid"},
+		{"1", "1", "Per", "Lund", "IK Stern", "1985", "H21", "0:35:00"},
+		{"2", "5", "Anna", "Berg", "IFK", "1990", "D21", "0:40:00"},
+		{"3", "6", "Eva", "Ek", "OK Ravinen", "1988", "D21", "0:42:30"},
+	}
+	if got := text(server.Values(spreadsheetID, "Overall")); !reflect.DeepEqual(got, overall) {
+		t.Errorf("Overall = %v, want %v", got, overall)
+	}
+
+	class := [][]string{
+		{"Plac", "Startnr", "Förnamn", "Efternamn", "Förening/Ort", "Född", "Tid"},
+		{"1", "5", "Anna", "Berg", "IFK", "1990", "0:40:00"},
+		{"2", "6", "Eva", "Ek", "OK Ravinen", "1988", "0:42:30"},
+	}
+	if got := text(server.Values(spreadsheetID, "Mila D21")); !reflect.DeepEqual(got, class) {
+		t.Errorf("Mila D21 = %v, want %v", got, class)
+	}
+}
+
+func TestSheetsPublisherNamesOverallTab(t *testing.T) {
+	server, p := newPublisher(t, "Resultat")
+
+	if err := p.Publish(context.Background(), results()); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if got := server.Tabs(spreadsheetID); len(got) == 0 || got[0] != "Resultat" {
+		t.Errorf("tabs = %v, want Resultat first", got)
+	}
+}
+
+func TestSheetsPublisherShowsTimeOfDayWithoutStart(t *testing.T) {
+	server, p := newPublisher(t, "")
+	rows := results()[:1]
+	rows[0].RaceTimeMs = nil
+
+	if err := p.Publish(context.Background(), rows); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if got := text(server.Values(spreadsheetID, "Mila D21")); len(got) != 2 || got[1][6] != "10:40:00" {
+		t.Errorf("Mila D21 = %v, want the time of day", got)
+	}
+}
+
+func TestSheetsPublisherClearsStaleRows(t *testing.T) {
+	server, p := newPublisher(t, "")
+
+	if err := p.Publish(context.Background(), results()); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	// A runner moved to another class, the old rows must not stay behind
+	rows := results()
+	rows[1].EventName = "Mila H21"
+	rows[1].Position = 2
+	if err := p.Publish(context.Background(), rows); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	if got := server.Values(spreadsheetID, "Mila D21"); len(got) != 2 {
+		t.Errorf("Mila D21 has %d rows, want the header and one result: %v", len(got), got)
+	}
+	if got := server.Values(spreadsheetID, "Mila H21"); len(got) != 3 {
+		t.Errorf("Mila H21 has %d rows, want the header and two results: %v", len(got), got)
+	}
+}
+
+func TestSheetsPublisherDeletesTabsOfRemovedClasses(t *testing.T) {
+	server, p := newPublisher(t, "", "Sheet1")
+
+	if err := p.Publish(context.Background(), results()); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	// Mila D21 was removed, its tab must not stay behind
+	if err := p.Publish(context.Background(), results()[2:]); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	if got, want := server.Tabs(spreadsheetID), []string{"Sheet1", "Overall", "Mila H21"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tabs = %v, want %v", got, want)
+	}
+}
+
+func TestSheetsPublisherRetriesQuotaErrors(t *testing.T) {
+	server, p := newPublisher(t, "")
+	server.FailNext(http.StatusTooManyRequests)
+
+	if err := p.Publish(context.Background(), results()); !errors.Is(err, ErrRetryable) {
+		t.Fatalf("Publish error = %v, want ErrRetryable", err)
+	}
+
+	server.FailNext(http.StatusBadRequest)
+	if err := p.Publish(context.Background(), results()); err == nil || errors.Is(err, ErrRetryable) {
+		t.Fatalf("Publish error = %v, want a permanent error", err)
+	}
+}
+
+func TestManagerRetriesSheetsAfterQuotaError(t *testing.T) {
+	server, p := newPublisher(t, "")
+	server.FailNext(http.StatusTooManyRequests)
+
+	m := NewManager(func() ([]db.ResultRow, error) { return results(), nil }, 0)
+	defer m.Close()
+	m.Add(p)
+	m.Notify()
+
+	deadline := time.Now().Add(5 * minBackoff)
+	for {
+		status := m.Status()[0]
+		if !status.LastSuccess.IsZero() {
+			if status.Pending != 0 || status.Failures != 0 || !strings.Contains(status.LastError, "429") {
+				t.Errorf("status = %+v, want a success after one 429", status)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no successful push after a 429: %+v", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if got := server.Values(spreadsheetID, "Overall"); len(got) != 4 {
+		t.Errorf("Overall has %d rows, want 4", len(got))
+	}
+}
@@ -0,0 +1,52 @@
+package publisher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/jimmitjoo/livestream-results/pkg/db"
+	"net/http"
+)
+
+// WebhookPublisher posts the results as JSON to a URL
+type WebhookPublisher struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookPublisher creates a publisher that posts to url
+func NewWebhookPublisher(url string) *WebhookPublisher {
+	return &WebhookPublisher{url: url, client: http.DefaultClient}
+}
+
+func (p *WebhookPublisher) Name() string {
+	return "webhook:" + p.url
+}
+
+func (p *WebhookPublisher) Publish(ctx context.Context, rows []db.ResultRow) error {
+	body, err := json.Marshal(rows)
+	if err != nil {
+		return fmt.Errorf("error encoding results: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error posting webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return fmt.Errorf("%w: webhook responded with status %s", ErrRetryable, resp.Status)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+// Package replay plays timing files back in real or accelerated time, and
+// generates timing files for a start list, to rehearse and load test a race.
+package replay
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/jimmitjoo/livestream-results/pkg/db"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// dialTimeout limits how long connecting to a TCP target may take
+const dialTimeout = 5 * time.Second
+
+// Options controls a replay
+type Options struct {
+	// Target is a file that lines are appended to, or tcp://host:port
+	Target string
+	// Speed is how many times faster than real time to play. Zero or less plays
+	// every line at once.
+	Speed float64
+	// Rebase moves all timestamps so the first read happens when the replay starts
+	Rebase bool
+	// Truncate empties a target file before the replay
+	Truncate bool
+	// Progress, when set, is called after every line
+	Progress func(sent int, at time.Time)
+}
+
+// read is one line of a timing file, with its timestamp when it has one
+type read struct {
+	fields []string
+	at     time.Time
+}
+
+// Replay reads the timing file at path and writes its lines to the target in
+// order of time, keeping the time between reads. Lines without a timestamp are
+// sent first.
+func Replay(ctx context.Context, path string, opts Options) (int, error) {
+	reads, err := readFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	out, err := openTarget(opts.Target, opts.Truncate)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+
+	var first time.Time
+	for _, r := range reads {
+		if !r.at.IsZero() {
+			first = r.at
+			break
+		}
+	}
+	started := time.Now()
+
+	for sent, r := range reads {
+		if !r.at.IsZero() {
+			offset := r.at.Sub(first)
+			if opts.Speed > 0 {
+				wait := time.Until(started.Add(time.Duration(float64(offset) / opts.Speed)))
+				if err := sleep(ctx, wait); err != nil {
+					return sent, err
+				}
+			}
+			if opts.Rebase {
+				r.at = started.Add(offset)
+				r.fields[1] = r.at.Format(db.TimestampLayout)
+			}
+		}
+
+		if _, err := io.WriteString(out, strings.Join(r.fields, "\t")+"\n"); err != nil {
+			return sent, fmt.Errorf("error writing to %s: %w", opts.Target, err)
+		}
+		if opts.Progress != nil {
+			opts.Progress(sent+1, r.at)
+		}
+	}
+
+	return len(reads), nil
+}
+
+// readFile reads the lines of a timing file ordered by their timestamps
+func readFile(path string) ([]read, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening timing file: %w", err)
+	}
+	defer file.Close()
+
+	var reads []read
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		r := read{fields: strings.Split(scanner.Text(), "\t")}
+		if len(r.fields) >= 2 {
+			if at, err := time.Parse(db.TimestampLayout, r.fields[1]); err == nil {
+				r.at = at
+			}
+		}
+		reads = append(reads, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading timing file: %w", err)
+	}
+
+	sort.SliceStable(reads, func(i, j int) bool {
+		return reads[i].at.Before(reads[j].at)
+	})
+	return reads, nil
+}
+
+// openTarget opens a TCP connection for tcp://host:port, otherwise the file
+func openTarget(target string, truncate bool) (io.WriteCloser, error) {
+	if address, ok := strings.CutPrefix(target, "tcp://"); ok {
+		conn, err := net.DialTimeout("tcp", address, dialTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("error connecting to %s: %w", address, err)
+		}
+		return conn, nil
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if truncate {
+		flags |= os.O_TRUNC
+	}
+	file, err := os.OpenFile(target, flags, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening target file: %w", err)
+	}
+	return file, nil
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,187 @@
+package sheets
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/option"
+	"google.golang.org/api/sheets/v4"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// OAuthFlow lets a user connect their own Google account with the installed-app
+// OAuth flow, as an alternative to sharing the spreadsheet with a service account.
+// Tokens are stored on disk, one file per race, and refreshed automatically.
+type OAuthFlow struct {
+	config   *oauth2.Config
+	tokenDir string
+
+	mu     sync.Mutex
+	states map[string]string
+}
+
+// NewOAuthFlow creates a flow from an OAuth client secret file for an installed
+// application, storing tokens in tokenDir
+func NewOAuthFlow(clientSecretPath string, tokenDir string) (*OAuthFlow, error) {
+	b, err := os.ReadFile(clientSecretPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read OAuth client file: %v", err)
+	}
+
+	config, err := google.ConfigFromJSON(b, sheets.SpreadsheetsScope)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse OAuth client file to config: %v", err)
+	}
+
+	return &OAuthFlow{
+		config:   config,
+		tokenDir: tokenDir,
+		states:   make(map[string]string),
+	}, nil
+}
+
+// AuthURL returns the Google consent page URL for race. Google redirects back
+// to redirectURL with a code that is passed on to Exchange.
+func (f *OAuthFlow) AuthURL(race string, redirectURL string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("unable to create OAuth state: %v", err)
+	}
+	state := hex.EncodeToString(b)
+
+	f.mu.Lock()
+	f.states[state] = race
+	f.mu.Unlock()
+
+	config := *f.config
+	config.RedirectURL = redirectURL
+	return config.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.ApprovalForce), nil
+}
+
+// Exchange trades the code from the consent page for a token and stores it.
+// It returns the race the token belongs to.
+func (f *OAuthFlow) Exchange(ctx context.Context, state string, code string, redirectURL string) (string, error) {
+	f.mu.Lock()
+	race, ok := f.states[state]
+	delete(f.states, state)
+	f.mu.Unlock()
+	if !ok {
+		return "", fmt.Errorf("unknown or expired OAuth state")
+	}
+
+	config := *f.config
+	config.RedirectURL = redirectURL
+	token, err := config.Exchange(ctx, code)
+	if err != nil {
+		return "", fmt.Errorf("unable to exchange OAuth code: %v", err)
+	}
+
+	if err := f.saveToken(race, token); err != nil {
+		return "", err
+	}
+	return race, nil
+}
+
+// HasToken reports whether a Google account has been connected for race
+func (f *OAuthFlow) HasToken(race string) bool {
+	_, err := os.Stat(f.tokenPath(race))
+	return err == nil
+}
+
+// NewService creates a SheetsService acting as the Google account connected for race
+func (f *OAuthFlow) NewService(race string, sheetID string) (*SheetsService, error) {
+	token, err := f.loadToken(race)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	source := &savingTokenSource{
+		flow:   f,
+		race:   race,
+		source: f.config.TokenSource(ctx, token),
+		last:   token.AccessToken,
+	}
+	return NewSheetsServiceWithOptions(sheetID, option.WithTokenSource(source))
+}
+
+func (f *OAuthFlow) tokenPath(race string) string {
+	return filepath.Join(f.tokenDir, tokenFileName(race))
+}
+
+func (f *OAuthFlow) loadToken(race string) (*oauth2.Token, error) {
+	b, err := os.ReadFile(f.tokenPath(race))
+	if err != nil {
+		return nil, fmt.Errorf("no Google account connected for %s: %v", race, err)
+	}
+
+	var token oauth2.Token
+	if err := json.Unmarshal(b, &token); err != nil {
+		return nil, fmt.Errorf("unable to parse token file: %v", err)
+	}
+	return &token, nil
+}
+
+func (f *OAuthFlow) saveToken(race string, token *oauth2.Token) error {
+	if err := os.MkdirAll(f.tokenDir, 0700); err != nil {
+		return fmt.Errorf("unable to create token directory: %v", err)
+	}
+
+	b, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("unable to encode token: %v", err)
+	}
+	if err := os.WriteFile(f.tokenPath(race), b, 0600); err != nil {
+		return fmt.Errorf("unable to save token: %v", err)
+	}
+	return nil
+}
+
+// tokenFileName turns a race name into a safe file name. Characters that are
+// not safe are replaced, so a hash of the whole name keeps races like
+// "Vårruset" and "Värruset" apart.
+func tokenFileName(race string) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, race)
+	sum := sha256.Sum256([]byte(race))
+	return name + "-" + hex.EncodeToString(sum[:8]) + ".json"
+}
+
+// savingTokenSource writes refreshed tokens back to disk so they survive a restart
+type savingTokenSource struct {
+	flow   *OAuthFlow
+	race   string
+	source oauth2.TokenSource
+
+	mu   sync.Mutex
+	last string
+}
+
+func (s *savingTokenSource) Token() (*oauth2.Token, error) {
+	token, err := s.source.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if token.AccessToken != s.last {
+		s.last = token.AccessToken
+		if err := s.flow.saveToken(s.race, token); err != nil {
+			fmt.Println("Error saving refreshed token:", err)
+		}
+	}
+	return token, nil
+}
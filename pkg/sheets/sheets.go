@@ -7,6 +7,7 @@ import (
 	"google.golang.org/api/option"
 	"google.golang.org/api/sheets/v4"
 	"io/ioutil"
+	"strings"
 )
 
 type SheetsService struct {
@@ -27,9 +28,13 @@ func NewSheetsService(credentialsPath string, sheetID string) (*SheetsService, e
 		return nil, fmt.Errorf("unable to parse client secret file to config: %v", err)
 	}
 
-	client := config.Client(ctx)
+	return NewSheetsServiceWithOptions(sheetID, option.WithHTTPClient(config.Client(ctx)))
+}
 
-	srv, err := sheets.NewService(ctx, option.WithHTTPClient(client))
+// NewSheetsServiceWithOptions creates a SheetsService with custom client options,
+// e.g. to talk to a fake Sheets server from the sheetstest package
+func NewSheetsServiceWithOptions(sheetID string, opts ...option.ClientOption) (*SheetsService, error) {
+	srv, err := sheets.NewService(context.Background(), opts...)
 	if err != nil {
 		return nil, fmt.Errorf("unable to retrieve Sheets client: %v", err)
 	}
@@ -41,55 +46,190 @@ func NewSheetsService(credentialsPath string, sheetID string) (*SheetsService, e
 }
 
 func (s *SheetsService) ReadSheet(sheetName string) ([][]interface{}, error) {
-	rangeData := fmt.Sprintf("%s!A1:Z1000", sheetName)
+	rangeData := fmt.Sprintf("%s!A1:Z1000", quoteSheetName(sheetName))
 
 	fmt.Println("Reading sheet:", sheetName)
 	fmt.Println("Sheet ID:", s.SheetID)
 
 	resp, err := s.Service.Spreadsheets.Values.Get(s.SheetID, rangeData).Do()
 	if err != nil {
-		return nil, fmt.Errorf("unable to retrieve data from sheet: %v", err)
+		return nil, fmt.Errorf("unable to retrieve data from sheet: %w", err)
 	}
 	return resp.Values, nil
 }
 
+// UpdateSheet replaces the content of the tab sheetName with data, creating the tab if needed.
+// Unlike ReplaceTabs it leaves all other tabs alone.
 func (s *SheetsService) UpdateSheet(sheetName string, data [][]interface{}) error {
-	rangeData := fmt.Sprintf("%s!A1", sheetName)
-	valueRange := &sheets.ValueRange{
-		Values: data,
+	return s.replaceTabs([]Tab{{Title: sheetName, Values: data}}, false)
+}
+
+// Tab is the full content of one tab in a spreadsheet
+type Tab struct {
+	Title  string
+	Values [][]interface{}
+}
+
+// createdTabKey is the developer metadata key on the tabs ReplaceTabs created
+const createdTabKey = "livestream-results-tab"
+
+// ReplaceTabs overwrites the given tabs with new content. Missing tabs are created
+// and old content is cleared, using one batch request for each step. Tabs that
+// ReplaceTabs created earlier and that are not in tabs are deleted, so classes
+// that no longer exist disappear; other tabs are left alone.
+func (s *SheetsService) ReplaceTabs(tabs []Tab) error {
+	return s.replaceTabs(tabs, true)
+}
+
+// replaceTabs writes tabs. With managed the tabs are the full set ReplaceTabs
+// keeps in the spreadsheet, see syncTabs.
+func (s *SheetsService) replaceTabs(tabs []Tab, managed bool) error {
+	titles := make([]string, 0, len(tabs))
+	for _, tab := range tabs {
+		titles = append(titles, tab.Title)
 	}
 
-	_, err := s.Service.Spreadsheets.Get(s.SheetID).Do()
-	if err != nil {
-		return fmt.Errorf("unable to retrieve spreadsheet: %v", err)
+	if err := s.syncTabs(titles, managed); err != nil {
+		return err
 	}
+	if err := s.ClearTabs(titles...); err != nil {
+		return err
+	}
+	return s.WriteTabs(tabs...)
+}
+
+// EnsureTabs creates the tabs among titles that do not exist in the spreadsheet yet
+func (s *SheetsService) EnsureTabs(titles ...string) error {
+	return s.syncTabs(titles, false)
+}
 
-	// Check that the sheetName exists in the spreadsheet
-	_, err = s.Service.Spreadsheets.Values.Get(s.SheetID, rangeData).Do()
+// syncTabs creates the tabs among titles that do not exist yet. With managed it
+// marks the new tabs as created by ReplaceTabs and deletes the marked tabs that
+// are not in titles.
+func (s *SheetsService) syncTabs(titles []string, managed bool) error {
+	spreadsheet, err := s.Service.Spreadsheets.Get(s.SheetID).Fields("sheets(properties(sheetId,title),developerMetadata(metadataKey))").Do()
 	if err != nil {
-		// Try to create the sheetName if it doesn't exist
-		_, err = s.Service.Spreadsheets.BatchUpdate(s.SheetID, &sheets.BatchUpdateSpreadsheetRequest{
-			Requests: []*sheets.Request{
-				&sheets.Request{
-					AddSheet: &sheets.AddSheetRequest{
-						Properties: &sheets.SheetProperties{
-							Title: sheetName,
-						},
-					},
+		return fmt.Errorf("unable to retrieve spreadsheet: %w", err)
+	}
+
+	existing := make(map[string]bool)
+	var lastID int64
+	for _, sheet := range spreadsheet.Sheets {
+		existing[sheet.Properties.Title] = true
+		if sheet.Properties.SheetId > lastID {
+			lastID = sheet.Properties.SheetId
+		}
+	}
+
+	// New tabs get their IDs here so they can be marked in the same batch
+	var requests []*sheets.Request
+	for _, title := range titles {
+		if existing[title] {
+			continue
+		}
+		existing[title] = true
+		lastID++
+		requests = append(requests, &sheets.Request{
+			AddSheet: &sheets.AddSheetRequest{
+				Properties: &sheets.SheetProperties{SheetId: lastID, Title: title},
+			},
+		})
+		if !managed {
+			continue
+		}
+		requests = append(requests, &sheets.Request{
+			CreateDeveloperMetadata: &sheets.CreateDeveloperMetadataRequest{
+				DeveloperMetadata: &sheets.DeveloperMetadata{
+					MetadataKey:   createdTabKey,
+					MetadataValue: title,
+					Location:      &sheets.DeveloperMetadataLocation{SheetId: lastID},
+					Visibility:    "DOCUMENT",
 				},
 			},
-		}).Do()
-		if err != nil {
-			return fmt.Errorf("unable to create sheet: %v", err)
+		})
+	}
+
+	if managed {
+		wanted := make(map[string]bool)
+		for _, title := range titles {
+			wanted[title] = true
+		}
+		for _, sheet := range spreadsheet.Sheets {
+			if !wanted[sheet.Properties.Title] && createdHere(sheet) {
+				requests = append(requests, &sheets.Request{
+					DeleteSheet: &sheets.DeleteSheetRequest{SheetId: sheet.Properties.SheetId, ForceSendFields: []string{"SheetId"}},
+				})
+			}
 		}
+	}
+	if len(requests) == 0 {
+		return nil
+	}
+
+	_, err = s.Service.Spreadsheets.BatchUpdate(s.SheetID, &sheets.BatchUpdateSpreadsheetRequest{Requests: requests}).Do()
+	if err != nil {
+		return fmt.Errorf("unable to create or delete sheets: %w", err)
+	}
+	return nil
+}
+
+// createdHere reports whether sheet is marked as created by ReplaceTabs
+func createdHere(sheet *sheets.Sheet) bool {
+	for _, metadata := range sheet.DeveloperMetadata {
+		if metadata.MetadataKey == createdTabKey {
+			return true
+		}
+	}
+	return false
+}
+
+// ClearTabs removes all values from the given tabs
+func (s *SheetsService) ClearTabs(titles ...string) error {
+	ranges := make([]string, 0, len(titles))
+	for _, title := range titles {
+		ranges = append(ranges, quoteSheetName(title))
+	}
+	return s.ClearRanges(ranges...)
+}
 
-		return fmt.Errorf("unable to retrieve data from sheet: %v", err)
+// ClearRanges removes all values in the given A1 ranges
+func (s *SheetsService) ClearRanges(ranges ...string) error {
+	if len(ranges) == 0 {
+		return nil
 	}
 
-	_, err = s.Service.Spreadsheets.Values.Update(s.SheetID, rangeData, valueRange).ValueInputOption("RAW").Do()
+	_, err := s.Service.Spreadsheets.Values.BatchClear(s.SheetID, &sheets.BatchClearValuesRequest{Ranges: ranges}).Do()
 	if err != nil {
-		return fmt.Errorf("unable to update data in sheet: %v", err)
+		return fmt.Errorf("unable to clear sheets: %w", err)
+	}
+	return nil
+}
+
+// WriteTabs writes the values of every tab starting at its first cell. The tabs must exist.
+func (s *SheetsService) WriteTabs(tabs ...Tab) error {
+	if len(tabs) == 0 {
+		return nil
 	}
 
+	data := make([]*sheets.ValueRange, 0, len(tabs))
+	for _, tab := range tabs {
+		data = append(data, &sheets.ValueRange{
+			Range:  quoteSheetName(tab.Title) + "!A1",
+			Values: tab.Values,
+		})
+	}
+
+	_, err := s.Service.Spreadsheets.Values.BatchUpdate(s.SheetID, &sheets.BatchUpdateValuesRequest{
+		ValueInputOption: "RAW",
+		Data:             data,
+	}).Do()
+	if err != nil {
+		return fmt.Errorf("unable to update sheets: %w", err)
+	}
 	return nil
 }
+
+// quoteSheetName quotes a tab name for use in A1 notation
+func quoteSheetName(name string) string {
+	return "'" + strings.ReplaceAll(name, "'", "''") + "'"
+}
@@ -0,0 +1,146 @@
+package sheets_test
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jimmitjoo/livestream-results/pkg/sheets"
+	"github.com/jimmitjoo/livestream-results/pkg/sheets/sheetstest"
+	"google.golang.org/api/googleapi"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+const spreadsheetID = "results"
+
+func newService(t *testing.T, titles ...string) (*sheetstest.Server, *sheets.SheetsService) {
+	t.Helper()
+	server := sheetstest.NewServer()
+	t.Cleanup(server.Close)
+	server.AddSpreadsheet(spreadsheetID, titles...)
+
+	service, err := server.NewService(spreadsheetID)
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	return server, service
+}
+
+// text turns values as returned by the fake server into strings, numbers come back as float64
+func text(values [][]interface{}) [][]string {
+	rows := make([][]string, 0, len(values))
+	for _, row := range values {
+		cells := make([]string, 0, len(row))
+		for _, cell := range row {
+			cells = append(cells, fmt.Sprint(cell))
+		}
+		rows = append(rows, cells)
+	}
+	return rows
+}
+
+func TestReplaceTabsCreatesMissingTabs(t *testing.T) {
+	server, service := newService(t, "Sheet1")
+
+	err := service.ReplaceTabs([]sheets.Tab{
+		{Title: "Overall", Values: [][]interface{}{{"Plac"}, {1}}},
+		{Title: "Mila H21", Values: [][]interface{}{{"Plac"}, {1}}},
+	})
+	if err != nil {
+		t.Fatalf("ReplaceTabs: %v", err)
+	}
+
+	if got, want := server.Tabs(spreadsheetID), []string{"Sheet1", "Overall", "Mila H21"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tabs = %v, want %v", got, want)
+	}
+	if got, want := text(server.Values(spreadsheetID, "Mila H21")), [][]string{{"Plac"}, {"1"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("values = %v, want %v", got, want)
+	}
+}
+
+func TestReplaceTabsKeepsExistingTabs(t *testing.T) {
+	server, service := newService(t, "Overall")
+
+	for i := 0; i < 2; i++ {
+		if err := service.ReplaceTabs([]sheets.Tab{{Title: "Overall", Values: [][]interface{}{{"Plac"}}}}); err != nil {
+			t.Fatalf("ReplaceTabs %d: %v", i, err)
+		}
+	}
+	if got, want := server.Tabs(spreadsheetID), []string{"Overall"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tabs = %v, want %v", got, want)
+	}
+}
+
+func TestReplaceTabsClearsStaleRows(t *testing.T) {
+	server, service := newService(t)
+	server.SetValues(spreadsheetID, "Overall", [][]interface{}{{"Plac", "Startnr"}, {1, 5}, {2, 6}, {3, 7}})
+
+	if err := service.ReplaceTabs([]sheets.Tab{{Title: "Overall", Values: [][]interface{}{{"Plac"}, {1}}}}); err != nil {
+		t.Fatalf("ReplaceTabs: %v", err)
+	}
+
+	if got, want := text(server.Values(spreadsheetID, "Overall")), [][]string{{"Plac"}, {"1"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("values = %v, want %v", got, want)
+	}
+}
+
+func TestReplaceTabsDeletesTabsItCreated(t *testing.T) {
+	server, service := newService(t, "Sheet1")
+
+	tabs := []sheets.Tab{
+		{Title: "Overall", Values: [][]interface{}{{"Plac"}}},
+		{Title: "Mila H21", Values: [][]interface{}{{"Plac"}}},
+		{Title: "Mila D21", Values: [][]interface{}{{"Plac"}}},
+	}
+	if err := service.ReplaceTabs(tabs); err != nil {
+		t.Fatalf("ReplaceTabs: %v", err)
+	}
+	if err := service.ReplaceTabs(tabs[:2]); err != nil {
+		t.Fatalf("ReplaceTabs: %v", err)
+	}
+
+	// Sheet1 was there before and stays although it is not in the set
+	if got, want := server.Tabs(spreadsheetID), []string{"Sheet1", "Overall", "Mila H21"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tabs = %v, want %v", got, want)
+	}
+}
+
+func TestReplaceTabsKeepsTabsItDidNotCreate(t *testing.T) {
+	server, service := newService(t, "Overall", "Anteckningar")
+	if err := service.UpdateSheet("Startlista", [][]interface{}{{"Startnr"}}); err != nil {
+		t.Fatalf("UpdateSheet: %v", err)
+	}
+
+	if err := service.ReplaceTabs([]sheets.Tab{{Title: "Mila H21", Values: [][]interface{}{{"Plac"}}}}); err != nil {
+		t.Fatalf("ReplaceTabs: %v", err)
+	}
+	if err := service.ReplaceTabs([]sheets.Tab{{Title: "Overall", Values: [][]interface{}{{"Plac"}}}}); err != nil {
+		t.Fatalf("ReplaceTabs: %v", err)
+	}
+
+	if got, want := server.Tabs(spreadsheetID), []string{"Overall", "Anteckningar", "Startlista"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tabs = %v, want %v", got, want)
+	}
+}
+
+func TestReplaceTabsQuotesTitles(t *testing.T) {
+	server, service := newService(t)
+
+	if err := service.UpdateSheet("Damer 10 km 'Vårruset'", [][]interface{}{{"Plac"}}); err != nil {
+		t.Fatalf("UpdateSheet: %v", err)
+	}
+	if got := server.Values(spreadsheetID, "Damer 10 km 'Vårruset'"); len(got) != 1 {
+		t.Errorf("values = %v, want the header row", got)
+	}
+}
+
+func TestReplaceTabsReturnsQuotaErrors(t *testing.T) {
+	server, service := newService(t, "Overall")
+	server.FailNext(http.StatusTooManyRequests)
+
+	err := service.ReplaceTabs([]sheets.Tab{{Title: "Overall", Values: [][]interface{}{{"Plac"}}}})
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusTooManyRequests {
+		t.Fatalf("ReplaceTabs error = %v, want a googleapi.Error with status 429", err)
+	}
+}
@@ -0,0 +1,474 @@
+// Package sheetstest provides an in-memory fake of the Google Sheets API for tests.
+// It implements the subset of endpoints used by the sheets package.
+package sheetstest
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/jimmitjoo/livestream-results/pkg/sheets"
+	"google.golang.org/api/option"
+	sheetsapi "google.golang.org/api/sheets/v4"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Server is a fake Sheets API backed by in-memory spreadsheets
+type Server struct {
+	URL string
+
+	server       *httptest.Server
+	mu           sync.Mutex
+	spreadsheets map[string]*spreadsheet
+	failures     []int
+	requests     int
+}
+
+type spreadsheet struct {
+	tabs   []*tab
+	nextID int64
+}
+
+type tab struct {
+	id       int64
+	title    string
+	values   [][]interface{}
+	metadata []*sheetsapi.DeveloperMetadata
+}
+
+// NewServer starts a fake Sheets server. Call Close when done.
+func NewServer() *Server {
+	s := &Server{spreadsheets: make(map[string]*spreadsheet)}
+	s.server = httptest.NewServer(http.HandlerFunc(s.handle))
+	s.URL = s.server.URL
+	return s
+}
+
+// Close shuts down the server
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// ClientOptions returns the options needed to point a Sheets client at the server
+func (s *Server) ClientOptions() []option.ClientOption {
+	return []option.ClientOption{
+		option.WithEndpoint(s.URL + "/"),
+		option.WithHTTPClient(s.server.Client()),
+	}
+}
+
+// NewService creates a SheetsService for spreadsheetID talking to the server
+func (s *Server) NewService(spreadsheetID string) (*sheets.SheetsService, error) {
+	return sheets.NewSheetsServiceWithOptions(spreadsheetID, s.ClientOptions()...)
+}
+
+// AddSpreadsheet creates a spreadsheet with the given tabs
+func (s *Server) AddSpreadsheet(spreadsheetID string, titles ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ss := &spreadsheet{}
+	for _, title := range titles {
+		ss.addTab(title)
+	}
+	s.spreadsheets[spreadsheetID] = ss
+}
+
+// SetValues replaces the content of a tab, creating it if needed
+func (s *Server) SetValues(spreadsheetID string, title string, values [][]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ss, ok := s.spreadsheets[spreadsheetID]
+	if !ok {
+		ss = &spreadsheet{}
+		s.spreadsheets[spreadsheetID] = ss
+	}
+	t := ss.find(title)
+	if t == nil {
+		t = ss.addTab(title)
+	}
+	t.values = values
+}
+
+// Tabs returns the titles of all tabs in a spreadsheet
+func (s *Server) Tabs(spreadsheetID string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var titles []string
+	if ss, ok := s.spreadsheets[spreadsheetID]; ok {
+		for _, t := range ss.tabs {
+			titles = append(titles, t.title)
+		}
+	}
+	return titles
+}
+
+// Values returns the content of a tab, or nil if it does not exist.
+// Numbers are returned as float64, like the real API returns them.
+func (s *Server) Values(spreadsheetID string, title string) [][]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ss, ok := s.spreadsheets[spreadsheetID]
+	if !ok {
+		return nil
+	}
+	if t := ss.find(title); t != nil {
+		return t.values
+	}
+	return nil
+}
+
+// FailNext makes the next requests fail with the given HTTP status codes, in order
+func (s *Server) FailNext(codes ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, codes...)
+}
+
+// Requests returns the number of API requests the server has received
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func (ss *spreadsheet) find(title string) *tab {
+	for _, t := range ss.tabs {
+		if t.title == title {
+			return t
+		}
+	}
+	return nil
+}
+
+// addTab adds a tab with the next free ID
+func (ss *spreadsheet) addTab(title string) *tab {
+	return ss.addTabWithID(title, ss.nextID)
+}
+
+func (ss *spreadsheet) addTabWithID(title string, id int64) *tab {
+	t := &tab{id: id, title: title}
+	ss.tabs = append(ss.tabs, t)
+	if id >= ss.nextID {
+		ss.nextID = id + 1
+	}
+	return t
+}
+
+func (ss *spreadsheet) findID(id int64) *tab {
+	for _, t := range ss.tabs {
+		if t.id == id {
+			return t
+		}
+	}
+	return nil
+}
+
+func (ss *spreadsheet) deleteTab(id int64) {
+	for i, t := range ss.tabs {
+		if t.id == id {
+			ss.tabs = append(ss.tabs[:i], ss.tabs[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests++
+	if len(s.failures) > 0 {
+		code := s.failures[0]
+		s.failures = s.failures[1:]
+		writeError(w, code, "injected failure")
+		return
+	}
+
+	// Paths look like /v4/spreadsheets/{id}[:action] or /v4/spreadsheets/{id}/values[/{range}][:action]
+	segments := strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), "/"), "/")
+	for i, segment := range segments {
+		if unescaped, err := url.PathUnescape(segment); err == nil {
+			segments[i] = unescaped
+		}
+	}
+	if len(segments) < 3 || segments[0] != "v4" || segments[1] != "spreadsheets" {
+		writeError(w, http.StatusNotFound, "unknown path")
+		return
+	}
+
+	id, action := splitAction(segments[2], r.Method)
+	ss, ok := s.spreadsheets[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Requested entity was not found.")
+		return
+	}
+
+	switch {
+	case len(segments) == 3 && action == "" && r.Method == http.MethodGet:
+		s.getSpreadsheet(w, id, ss)
+	case len(segments) == 3 && action == "batchUpdate":
+		s.batchUpdate(w, r, ss)
+	case len(segments) == 4 && segments[3] == "values:batchClear":
+		s.batchClear(w, r, ss)
+	case len(segments) == 4 && segments[3] == "values:batchUpdate":
+		s.batchUpdateValues(w, r, ss)
+	case len(segments) == 5 && segments[3] == "values":
+		rangeName, action := splitAction(segments[4], r.Method)
+		switch {
+		case action == "clear":
+			s.clearRange(w, ss, rangeName)
+		case r.Method == http.MethodGet:
+			s.getValues(w, ss, rangeName)
+		case r.Method == http.MethodPut:
+			s.updateValues(w, r, ss, rangeName)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "unsupported method")
+		}
+	default:
+		writeError(w, http.StatusNotFound, "unsupported endpoint")
+	}
+}
+
+func (s *Server) getSpreadsheet(w http.ResponseWriter, id string, ss *spreadsheet) {
+	resp := sheetsapi.Spreadsheet{SpreadsheetId: id}
+	for _, t := range ss.tabs {
+		resp.Sheets = append(resp.Sheets, &sheetsapi.Sheet{
+			Properties:        &sheetsapi.SheetProperties{SheetId: t.id, Title: t.title},
+			DeveloperMetadata: t.metadata,
+		})
+	}
+	writeJSON(w, resp)
+}
+
+func (s *Server) batchUpdate(w http.ResponseWriter, r *http.Request, ss *spreadsheet) {
+	var req sheetsapi.BatchUpdateSpreadsheetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Apply the batch to a copy, the real API applies a batch atomically
+	staged := &spreadsheet{nextID: ss.nextID}
+	for _, t := range ss.tabs {
+		copied := *t
+		staged.tabs = append(staged.tabs, &copied)
+	}
+	resp := sheetsapi.BatchUpdateSpreadsheetResponse{}
+	for _, request := range req.Requests {
+		reply := &sheetsapi.Response{}
+		switch {
+		case request.AddSheet != nil && request.AddSheet.Properties != nil:
+			properties := request.AddSheet.Properties
+			if staged.find(properties.Title) != nil {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("A sheet with the name %q already exists.", properties.Title))
+				return
+			}
+			id := staged.nextID
+			if properties.SheetId != 0 {
+				id = properties.SheetId
+			}
+			if staged.findID(id) != nil {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("A sheet with the ID %d already exists.", id))
+				return
+			}
+			t := staged.addTabWithID(properties.Title, id)
+			reply.AddSheet = &sheetsapi.AddSheetResponse{
+				Properties: &sheetsapi.SheetProperties{SheetId: t.id, Title: t.title},
+			}
+		case request.DeleteSheet != nil:
+			if staged.findID(request.DeleteSheet.SheetId) == nil {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("No grid with id: %d", request.DeleteSheet.SheetId))
+				return
+			}
+			if len(staged.tabs) == 1 {
+				writeError(w, http.StatusBadRequest, "You can't remove all the sheets in a document.")
+				return
+			}
+			staged.deleteTab(request.DeleteSheet.SheetId)
+		case request.CreateDeveloperMetadata != nil && request.CreateDeveloperMetadata.DeveloperMetadata != nil:
+			metadata := *request.CreateDeveloperMetadata.DeveloperMetadata
+			if metadata.Location == nil {
+				writeError(w, http.StatusBadRequest, "developer metadata needs a location")
+				return
+			}
+			t := staged.findID(metadata.Location.SheetId)
+			if t == nil {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("No grid with id: %d", metadata.Location.SheetId))
+				return
+			}
+			t.metadata = append(t.metadata, &metadata)
+			reply.CreateDeveloperMetadata = &sheetsapi.CreateDeveloperMetadataResponse{DeveloperMetadata: &metadata}
+		default:
+			writeError(w, http.StatusBadRequest, "only addSheet, deleteSheet and createDeveloperMetadata requests are supported")
+			return
+		}
+		resp.Replies = append(resp.Replies, reply)
+	}
+
+	*ss = *staged
+	writeJSON(w, resp)
+}
+
+func (s *Server) batchClear(w http.ResponseWriter, r *http.Request, ss *spreadsheet) {
+	var req sheetsapi.BatchClearValuesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	for _, rangeName := range req.Ranges {
+		if _, _, _, ok := ss.resolve(rangeName); !ok {
+			writeError(w, http.StatusBadRequest, "Unable to parse range: "+rangeName)
+			return
+		}
+	}
+	for _, rangeName := range req.Ranges {
+		t, _, _, _ := ss.resolve(rangeName)
+		t.values = nil
+	}
+	writeJSON(w, sheetsapi.BatchClearValuesResponse{ClearedRanges: req.Ranges})
+}
+
+func (s *Server) batchUpdateValues(w http.ResponseWriter, r *http.Request, ss *spreadsheet) {
+	var req sheetsapi.BatchUpdateValuesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	for _, data := range req.Data {
+		if _, _, _, ok := ss.resolve(data.Range); !ok {
+			writeError(w, http.StatusBadRequest, "Unable to parse range: "+data.Range)
+			return
+		}
+	}
+	for _, data := range req.Data {
+		t, row, col, _ := ss.resolve(data.Range)
+		t.write(row, col, data.Values)
+	}
+	writeJSON(w, sheetsapi.BatchUpdateValuesResponse{SpreadsheetId: ""})
+}
+
+func (s *Server) clearRange(w http.ResponseWriter, ss *spreadsheet, rangeName string) {
+	t, _, _, ok := ss.resolve(rangeName)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Unable to parse range: "+rangeName)
+		return
+	}
+	t.values = nil
+	writeJSON(w, sheetsapi.ClearValuesResponse{ClearedRange: rangeName})
+}
+
+func (s *Server) getValues(w http.ResponseWriter, ss *spreadsheet, rangeName string) {
+	t, _, _, ok := ss.resolve(rangeName)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Unable to parse range: "+rangeName)
+		return
+	}
+	writeJSON(w, sheetsapi.ValueRange{Range: rangeName, MajorDimension: "ROWS", Values: t.values})
+}
+
+func (s *Server) updateValues(w http.ResponseWriter, r *http.Request, ss *spreadsheet, rangeName string) {
+	t, row, col, ok := ss.resolve(rangeName)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Unable to parse range: "+rangeName)
+		return
+	}
+
+	var req sheetsapi.ValueRange
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	t.write(row, col, req.Values)
+	writeJSON(w, sheetsapi.UpdateValuesResponse{UpdatedRange: rangeName, UpdatedRows: int64(len(req.Values))})
+}
+
+// resolve finds the tab and start cell of an A1 range such as 'My tab'!B2:Z1000.
+// Only the start cell is honoured; reads and clears always cover the whole tab.
+func (ss *spreadsheet) resolve(rangeName string) (*tab, int, int, bool) {
+	title, cell := rangeName, ""
+	if i := strings.LastIndex(rangeName, "!"); i >= 0 {
+		title, cell = rangeName[:i], rangeName[i+1:]
+	}
+	if strings.HasPrefix(title, "'") && strings.HasSuffix(title, "'") && len(title) >= 2 {
+		title = strings.ReplaceAll(title[1:len(title)-1], "''", "'")
+	}
+
+	t := ss.find(title)
+	if t == nil {
+		return nil, 0, 0, false
+	}
+
+	if i := strings.Index(cell, ":"); i >= 0 {
+		cell = cell[:i]
+	}
+	row, col := 0, 0
+	for _, c := range strings.ToUpper(cell) {
+		switch {
+		case c >= 'A' && c <= 'Z':
+			col = col*26 + int(c-'A'+1)
+		case c >= '0' && c <= '9':
+			row = row*10 + int(c-'0')
+		}
+	}
+	if row > 0 {
+		row--
+	}
+	if col > 0 {
+		col--
+	}
+	return t, row, col, true
+}
+
+// write stores values with their top left corner at row, col
+func (t *tab) write(row int, col int, values [][]interface{}) {
+	for len(t.values) < row+len(values) {
+		t.values = append(t.values, nil)
+	}
+	for i, rowValues := range values {
+		target := t.values[row+i]
+		for len(target) < col+len(rowValues) {
+			target = append(target, "")
+		}
+		copy(target[col:], rowValues)
+		t.values[row+i] = target
+	}
+}
+
+// splitAction splits a trailing custom method such as ":clear" off a path segment.
+// Ranges may themselves contain colons, so only known actions are split off.
+func splitAction(segment string, method string) (string, string) {
+	if method != http.MethodPost {
+		return segment, ""
+	}
+	for _, action := range []string{"batchUpdate", "clear", "append"} {
+		if strings.HasSuffix(segment, ":"+action) {
+			return strings.TrimSuffix(segment, ":"+action), action
+		}
+	}
+	return segment, ""
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    code,
+			"message": message,
+			"status":  http.StatusText(code),
+		},
+	})
+}
@@ -0,0 +1,332 @@
+// Package speaker builds the announcer's view of the race: who is approaching
+// the finish and who just finished.
+package speaker
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/jimmitjoo/livestream-results/pkg/db"
+	"github.com/jimmitjoo/livestream-results/pkg/publisher"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Runner is an athlete who passed the last split before the finish but has not
+// finished yet
+type Runner struct {
+	BibNumber       int    `json:"bibNumber"`
+	Name            string `json:"name"`
+	Club            string `json:"club"`
+	EventID         int    `json:"eventID"`
+	EventName       string `json:"eventName"`
+	Checkpoint      string `json:"checkpoint"`
+	Passed          string `json:"passed"`
+	Position        int    `json:"position"`
+	PredictedFinish string `json:"predictedFinish,omitempty"`
+	PredictedTime   string `json:"predictedTime,omitempty"`
+}
+
+// Finisher is an athlete who finished, with the placement in the class
+type Finisher struct {
+	Position  int    `json:"position"`
+	BibNumber int    `json:"bibNumber"`
+	Name      string `json:"name"`
+	Club      string `json:"club"`
+	EventID   int    `json:"eventID"`
+	EventName string `json:"eventName"`
+	Finished  string `json:"finished"`
+	Time      string `json:"time"`
+}
+
+// Board is the speaker screen
+type Board struct {
+	Approaching []Runner   `json:"approaching"`
+	Finished    []Finisher `json:"finished"`
+}
+
+// Query selects what the board shows. The window ends at the latest read rather
+// than the clock, so the board also works when an old timing file is replayed.
+type Query struct {
+	// FinishAntenna is the antenna at the finish line. Zero means every read is a finish.
+	FinishAntenna int
+	// Window is how far back passages of the last split and finishes are shown
+	Window time.Duration
+	// EventID limits the board to one race or class, zero shows all
+	EventID int
+	// Limit is the longest "just finished" feed, zero shows all
+	Limit int
+}
+
+// passage is the first read of a bib at one checkpoint
+type passage struct {
+	checkpoint string
+	at         time.Time
+}
+
+// athlete is everything known about one bib in one event
+type athlete struct {
+	participant db.Participant
+	passages    []passage
+	finish      time.Time
+	// raceTime is the race time shown for the finish
+	raceTime string
+	position int
+}
+
+func (a *athlete) split(checkpoint string) (time.Time, bool) {
+	for _, p := range a.passages {
+		if p.checkpoint == checkpoint {
+			return p.at, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Build reads all passages from the database and builds the board
+func Build(database *sql.DB, q Query) (Board, error) {
+	board := Board{Approaching: []Runner{}, Finished: []Finisher{}}
+
+	events, err := db.ListEvents(database)
+	if err != nil {
+		return board, err
+	}
+	participants, _, err := db.SearchParticipants(database, db.ParticipantQuery{})
+	if err != nil {
+		return board, err
+	}
+
+	starts, err := db.StartTimes(database)
+	if err != nil {
+		return board, err
+	}
+	results, err := db.GetResults(database, db.ResultQuery{FinishAntenna: q.FinishAntenna})
+	if err != nil {
+		return board, err
+	}
+	names := make(map[int]string)
+	for _, event := range events {
+		names[event.EventID] = event.EventName
+	}
+
+	athletes := make(map[string]*athlete)
+	for _, p := range participants {
+		athletes[key(p.EventID, p.BibNumber)] = &athlete{participant: p}
+	}
+	find := func(eventID, bibNumber int) *athlete {
+		a, ok := athletes[key(eventID, bibNumber)]
+		if !ok {
+			a = &athlete{participant: db.Participant{BibNumber: bibNumber, EventID: eventID, EventName: names[eventID]}}
+			athletes[key(eventID, bibNumber)] = a
+		}
+		return a
+	}
+
+	// Finishes and positions come from the results, so the board ranks like
+	// everything else, photo finishes included
+	for _, result := range results {
+		at, err := time.Parse(db.TimestampLayout, result.Timestamp)
+		if err != nil {
+			continue
+		}
+		a := find(result.EventID, result.BibNumber)
+		a.finish = at
+		a.raceTime = publisher.DisplayTime(result)
+		a.position = result.Position
+	}
+
+	var latest time.Time
+	err = db.EachRead(database, func(read db.Read) error {
+		at, err := time.Parse(db.TimestampLayout, read.Timestamp)
+		if err != nil {
+			return nil
+		}
+		if at.After(latest) {
+			latest = at
+		}
+
+		if db.IsFinish(read, q.FinishAntenna) {
+			return nil
+		}
+
+		// Reads are ordered by time, so only the first read at a checkpoint is
+		// kept, and none after the finish
+		a := find(read.EventID, read.BibNumber)
+		checkpoint := publisher.Checkpoint(read, q.FinishAntenna)
+		if _, ok := a.split(checkpoint); !ok && (a.finish.IsZero() || at.Before(a.finish)) {
+			a.passages = append(a.passages, passage{checkpoint: checkpoint, at: at})
+		}
+		return nil
+	})
+	if err != nil {
+		return board, err
+	}
+	since := latest.Add(-q.Window)
+
+	byEvent := make(map[int][]*athlete)
+	for _, a := range athletes {
+		byEvent[a.participant.EventID] = append(byEvent[a.participant.EventID], a)
+	}
+
+	for eventID, field := range byEvent {
+		if q.EventID != 0 && eventID != q.EventID && parentOf(events, eventID) != q.EventID {
+			continue
+		}
+		start := starts[eventID]
+
+		var finishers []*athlete
+		for _, a := range field {
+			if !a.finish.IsZero() {
+				finishers = append(finishers, a)
+			}
+		}
+		sort.Slice(finishers, func(i, j int) bool {
+			if finishers[i].position != finishers[j].position {
+				return finishers[i].position < finishers[j].position
+			}
+			return finishers[i].participant.BibNumber < finishers[j].participant.BibNumber
+		})
+
+		for _, a := range finishers {
+			if a.finish.Before(since) {
+				continue
+			}
+			board.Finished = append(board.Finished, Finisher{
+				Position:  a.position,
+				BibNumber: a.participant.BibNumber,
+				Name:      name(a.participant),
+				Club:      a.participant.Club,
+				EventID:   eventID,
+				EventName: a.participant.EventName,
+				Finished:  a.finish.Format(db.TimestampLayout),
+				Time:      a.raceTime,
+			})
+		}
+
+		// Runners who just passed an earlier split are still far from the finish
+		lastSplit := lastCheckpoint(field)
+		for _, a := range field {
+			if !a.finish.IsZero() || len(a.passages) == 0 {
+				continue
+			}
+			last := a.passages[len(a.passages)-1]
+			if last.checkpoint != lastSplit || last.at.Before(since) {
+				continue
+			}
+
+			runner := Runner{
+				BibNumber:  a.participant.BibNumber,
+				Name:       name(a.participant),
+				Club:       a.participant.Club,
+				EventID:    eventID,
+				EventName:  a.participant.EventName,
+				Checkpoint: last.checkpoint,
+				Passed:     last.at.Format(db.TimestampLayout),
+				Position:   1 + ahead(field, last),
+			}
+			if predicted, ok := predict(finishers, last, start); ok {
+				runner.PredictedFinish = predicted.Format("15:04:05")
+				runner.PredictedTime = publisher.TimeSince(predicted, start)
+			}
+			board.Approaching = append(board.Approaching, runner)
+		}
+	}
+
+	// The nearest finish first, the latest finisher first
+	sort.Slice(board.Approaching, func(i, j int) bool {
+		a, b := board.Approaching[i], board.Approaching[j]
+		if a.PredictedFinish != b.PredictedFinish {
+			return b.PredictedFinish == "" || (a.PredictedFinish != "" && a.PredictedFinish < b.PredictedFinish)
+		}
+		return a.Passed < b.Passed
+	})
+	sort.SliceStable(board.Finished, func(i, j int) bool {
+		return board.Finished[i].Finished > board.Finished[j].Finished
+	})
+	if q.Limit > 0 && len(board.Finished) > q.Limit {
+		board.Finished = board.Finished[:q.Limit]
+	}
+
+	return board, nil
+}
+
+// lastCheckpoint finds the last split before the finish of an event. The
+// leaders pass the splits in the order of the course, so it is the split with
+// the latest first passage.
+func lastCheckpoint(field []*athlete) string {
+	first := make(map[string]time.Time)
+	for _, a := range field {
+		for _, p := range a.passages {
+			if at, ok := first[p.checkpoint]; !ok || p.at.Before(at) {
+				first[p.checkpoint] = p.at
+			}
+		}
+	}
+
+	var last string
+	var lastAt time.Time
+	for checkpoint, at := range first {
+		if last == "" || at.After(lastAt) || at.Equal(lastAt) && checkpoint > last {
+			last, lastAt = checkpoint, at
+		}
+	}
+	return last
+}
+
+// ahead counts the athletes in the field who passed the checkpoint before p
+func ahead(field []*athlete, p passage) int {
+	count := 0
+	for _, a := range field {
+		if at, ok := a.split(p.checkpoint); ok && at.Before(p.at) {
+			count++
+		}
+	}
+	return count
+}
+
+// predict estimates when a runner at p finishes from how the finishers ran.
+// With a start time the runner's own pace so far is scaled by the finishers'
+// median ratio of finish time to split time, otherwise the median time from
+// the split to the finish is added.
+func predict(finishers []*athlete, p passage, start time.Time) (time.Time, bool) {
+	var ratios []float64
+	var gaps []time.Duration
+	for _, f := range finishers {
+		at, ok := f.split(p.checkpoint)
+		if !ok {
+			continue
+		}
+		gaps = append(gaps, f.finish.Sub(at))
+		if !start.IsZero() && at.After(start) {
+			ratios = append(ratios, float64(f.finish.Sub(start))/float64(at.Sub(start)))
+		}
+	}
+
+	if len(ratios) > 0 && p.at.After(start) {
+		sort.Float64s(ratios)
+		elapsed := time.Duration(float64(p.at.Sub(start)) * ratios[len(ratios)/2])
+		return start.Add(elapsed), true
+	}
+	if len(gaps) > 0 {
+		sort.Slice(gaps, func(i, j int) bool { return gaps[i] < gaps[j] })
+		return p.at.Add(gaps[len(gaps)/2]), true
+	}
+	return time.Time{}, false
+}
+
+func parentOf(events []db.Event, eventID int) int {
+	for _, event := range events {
+		if event.EventID == eventID {
+			return event.ParentEventID
+		}
+	}
+	return 0
+}
+
+func key(eventID, bibNumber int) string {
+	return fmt.Sprintf("%d/%d", eventID, bibNumber)
+}
+
+func name(p db.Participant) string {
+	return strings.TrimSpace(p.FirstName + " " + p.LastName)
+}
@@ -0,0 +1,102 @@
+package speaker
+
+import (
+	"database/sql"
+	"github.com/jimmitjoo/livestream-results/pkg/db"
+	"github.com/jimmitjoo/livestream-results/pkg/parser"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// finishAntenna is the antenna at the finish, 1 and 2 are the splits
+const finishAntenna = 3
+
+var start = time.Date(2024, 5, 4, 10, 0, 0, 0, time.UTC)
+
+// setupRace creates a race that starts at start with runners numbered from 1
+func setupRace(t *testing.T, runners int) *sql.DB {
+	t.Helper()
+	database, err := db.SetupDatabase(filepath.Join(t.TempDir(), "race.db"))
+	if err != nil {
+		t.Fatalf("SetupDatabase: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	eventID, err := db.InsertEvent(database, db.Event{EventName: "Mila", StartTime: start.Format(db.StartTimeLayout), Distance: 10000})
+	if err != nil {
+		t.Fatalf("InsertEvent: %v", err)
+	}
+	for bibNumber := 1; bibNumber <= runners; bibNumber++ {
+		participant := db.Participant{BibNumber: bibNumber, FirstName: "Löpare", LastName: string(rune('A' + bibNumber - 1))}
+		if err := db.InsertParticipant(database, participant, eventID); err != nil {
+			t.Fatalf("InsertParticipant: %v", err)
+		}
+	}
+	return database
+}
+
+// pass stores a read of bibNumber at antenna minutes after the start
+func pass(t *testing.T, database *sql.DB, bibNumber int, antenna int, minutes int) {
+	t.Helper()
+	read := parser.TimingResult{BibNumber: bibNumber, Timestamp: start.Add(time.Duration(minutes) * time.Minute), Antenna: &antenna}
+	if _, err := db.IngestReads(database, []parser.TimingResult{read}); err != nil {
+		t.Fatalf("IngestReads: %v", err)
+	}
+}
+
+func TestBuildApproachingOnlyAfterLastSplit(t *testing.T) {
+	database := setupRace(t, 4)
+	// Bib 1 finished, bib 2 passed both splits and bib 3 only the first
+	pass(t, database, 1, 1, 10)
+	pass(t, database, 1, 2, 20)
+	pass(t, database, 1, finishAntenna, 30)
+	pass(t, database, 2, 1, 12)
+	pass(t, database, 2, 2, 24)
+	pass(t, database, 3, 1, 25)
+
+	board, err := Build(database, Query{FinishAntenna: finishAntenna, Window: time.Hour})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	if len(board.Approaching) != 1 {
+		t.Fatalf("approaching = %+v, want only bib 2", board.Approaching)
+	}
+	runner := board.Approaching[0]
+	if runner.BibNumber != 2 || runner.Checkpoint != "Antenn 2" || runner.Position != 2 || runner.Name != "Löpare B" {
+		t.Errorf("runner = %+v", runner)
+	}
+	// Bib 1 finished in 1.5 times its time at the last split
+	if runner.PredictedFinish != "10:36:00" || runner.PredictedTime != "0:36:00" {
+		t.Errorf("predicted %s in %s, want 10:36:00 in 0:36:00", runner.PredictedFinish, runner.PredictedTime)
+	}
+
+	if len(board.Finished) != 1 {
+		t.Fatalf("finished = %+v, want bib 1", board.Finished)
+	}
+	if finisher := board.Finished[0]; finisher.BibNumber != 1 || finisher.Position != 1 || finisher.Time != "0:30:00" {
+		t.Errorf("finisher = %+v", finisher)
+	}
+}
+
+func TestBuildWindow(t *testing.T) {
+	database := setupRace(t, 3)
+	pass(t, database, 1, 1, 10)
+	pass(t, database, 1, 2, 20)
+	pass(t, database, 2, 1, 12)
+	pass(t, database, 2, 2, 35)
+	pass(t, database, 3, finishAntenna, 40)
+
+	// The window ends at the latest read, 40 minutes after the start
+	board, err := Build(database, Query{FinishAntenna: finishAntenna, Window: 10 * time.Minute})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if len(board.Approaching) != 1 || board.Approaching[0].BibNumber != 2 {
+		t.Errorf("approaching = %+v, want only bib 2", board.Approaching)
+	}
+	if len(board.Finished) != 1 || board.Finished[0].BibNumber != 3 {
+		t.Errorf("finished = %+v, want bib 3", board.Finished)
+	}
+}
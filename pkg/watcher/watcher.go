@@ -0,0 +1,305 @@
+package watcher
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"github.com/jimmitjoo/livestream-results/pkg/db"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// State is the lifecycle state of a watched source
+type State string
+
+const (
+	StateWatching State = "watching"
+	StateStopped  State = "stopped"
+	StateFailed   State = "failed"
+)
+
+// retryInterval is how often a failed source tries to open its file again.
+// Reader software often creates the timing file only at the first read.
+const retryInterval = 2 * time.Second
+
+// Status describes a watched timing file
+type Status struct {
+	Path      string    `json:"path"`
+	State     State     `json:"state"`
+	StartedAt time.Time `json:"startedAt"`
+	LastRead  time.Time `json:"lastRead"`
+	Lines     int       `json:"lines"`
+	Errors    int       `json:"errors"`
+	LastError string    `json:"lastError,omitempty"`
+}
+
+// IngestFunc reads the timing file at path into the database and returns the
+// number of timing lines in it. It may return an error together with lines it
+// could still read.
+type IngestFunc func(path string) (int, error)
+
+// Manager keeps track of all watched timing files. Every file gets its own
+// fsnotify watcher so events for one file are never handled for another.
+// Active sources are stored in the database and resumed after a restart.
+type Manager struct {
+	database *sql.DB
+	ingest   IngestFunc
+
+	mu      sync.Mutex
+	sources map[string]*source
+}
+
+type source struct {
+	path string
+	stop chan struct{}
+	done chan struct{}
+
+	mu     sync.Mutex
+	status Status
+}
+
+// NewManager creates a Manager that calls ingest whenever a watched file changes
+func NewManager(database *sql.DB, ingest IngestFunc) *Manager {
+	return &Manager{
+		database: database,
+		ingest:   ingest,
+		sources:  make(map[string]*source),
+	}
+}
+
+// Resume starts watching all sources that were active when the server stopped
+func (m *Manager) Resume() error {
+	paths, err := db.GetActiveWatchSources(m.database)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		if err := m.Start(path); err != nil {
+			log.Printf("Error resuming watch of %s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// Start begins watching path. A source that is already watched is restarted.
+// If the file cannot be watched, e.g. because it does not exist yet, the source
+// is marked as failed and retried until the file appears.
+func (m *Manager) Start(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s, ok := m.sources[path]; ok {
+		s.halt()
+	}
+
+	if err := db.SetWatchSource(m.database, path, true); err != nil {
+		return err
+	}
+
+	s := &source{
+		path:   path,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+		status: Status{Path: path, State: StateWatching, StartedAt: time.Now()},
+	}
+	m.sources[path] = s
+
+	go m.run(s)
+	return nil
+}
+
+// Status returns the status of the source watching path
+func (m *Manager) Status(path string) (Status, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sources[path]
+	if !ok {
+		return Status{}, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status, true
+}
+
+// Stop stops watching path. The source stays listed so it can be restarted.
+func (m *Manager) Stop(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sources[path]
+	if !ok {
+		return fmt.Errorf("%s is not watched", path)
+	}
+
+	s.halt()
+	s.mu.Lock()
+	s.status.State = StateStopped
+	s.mu.Unlock()
+
+	return db.SetWatchSource(m.database, path, false)
+}
+
+// Restart stops and starts watching path again, reading the whole file anew
+func (m *Manager) Restart(path string) error {
+	m.mu.Lock()
+	_, ok := m.sources[path]
+	m.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%s is not watched", path)
+	}
+
+	return m.Start(path)
+}
+
+// List returns the status of all sources, sorted by path
+func (m *Manager) List() []Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	statuses := make([]Status, 0, len(m.sources))
+	for _, s := range m.sources {
+		s.mu.Lock()
+		statuses = append(statuses, s.status)
+		s.mu.Unlock()
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Path < statuses[j].Path
+	})
+	return statuses
+}
+
+// Close stops all watchers without marking them as stopped in the database,
+// so they are resumed on the next start
+func (m *Manager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, s := range m.sources {
+		s.halt()
+	}
+}
+
+func (m *Manager) run(s *source) {
+	defer close(s.done)
+
+	for {
+		fsWatcher, err := open(s.path)
+		if err != nil {
+			s.fail(err)
+			select {
+			case <-s.stop:
+				return
+			case <-time.After(retryInterval):
+				continue
+			}
+		}
+
+		s.mu.Lock()
+		s.status.State = StateWatching
+		s.mu.Unlock()
+
+		removed := m.watch(s, fsWatcher)
+		fsWatcher.Close()
+		if !removed {
+			return
+		}
+		s.fail(fmt.Errorf("%s was removed or renamed", s.path))
+	}
+}
+
+// open creates an fsnotify watcher for path
+func open(path string) (*fsnotify.Watcher, error) {
+	fsWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("error creating file watcher: %w", err)
+	}
+	if err := fsWatcher.Add(path); err != nil {
+		fsWatcher.Close()
+		return nil, fmt.Errorf("error adding file to watcher: %w", err)
+	}
+	return fsWatcher, nil
+}
+
+// watch reads the file on every change until the source is stopped. It returns
+// true if the file was removed or renamed, so it has to be opened again.
+func (m *Manager) watch(s *source, fsWatcher *fsnotify.Watcher) bool {
+	// Read what is already in the file before waiting for changes
+	m.read(s)
+
+	for {
+		select {
+		case <-s.stop:
+			return false
+		case event, ok := <-fsWatcher.Events:
+			if !ok {
+				return false
+			}
+			if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+				return true
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Chmod) != 0 {
+				m.read(s)
+			}
+		case err, ok := <-fsWatcher.Errors:
+			if !ok {
+				return false
+			}
+			s.recordError(err)
+		}
+	}
+}
+
+// read ingests the source file and updates its status
+func (m *Manager) read(s *source) {
+	lines, err := m.ingest(s.path)
+	if err != nil {
+		s.recordError(err)
+		// Malformed lines are reported but the rest of the file is still read
+		if lines == 0 {
+			return
+		}
+	}
+
+	s.mu.Lock()
+	s.status.LastRead = time.Now()
+	s.status.Lines = lines
+	s.mu.Unlock()
+}
+
+// halt stops the source goroutine and waits for it to finish
+func (s *source) halt() {
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+	<-s.done
+}
+
+func (s *source) recordError(err error) {
+	log.Printf("Error watching file: %v", err)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.Errors++
+	s.status.LastError = err.Error()
+}
+
+// fail marks the source as failed. Repeated retries failing with the same
+// error are only counted once.
+func (s *source) fail(err error) {
+	s.mu.Lock()
+	repeated := s.status.State == StateFailed && s.status.LastError == err.Error()
+	s.status.State = StateFailed
+	s.mu.Unlock()
+
+	if !repeated {
+		s.recordError(err)
+	}
+}
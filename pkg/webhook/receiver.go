@@ -0,0 +1,65 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// maxPayload limits the size of a payload a Receiver accepts
+const maxPayload = 1 << 20
+
+// Receiver is an HTTP handler that accepts deliveries signed with Secret, for
+// trying out webhooks locally and in integration tests. Handle is called with
+// every accepted payload.
+type Receiver struct {
+	Secret string
+	Handle func(delivery string, p Payload)
+	// Fail answers the first Fail attempts of every delivery with 503, to try retries
+	Fail int
+
+	mu       sync.Mutex
+	attempts map[string]int
+}
+
+func (rc *Receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPayload))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !Verify(rc.Secret, body, r.Header.Get(SignatureHeader)) {
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	delivery := r.Header.Get(DeliveryHeader)
+	if rc.Fail > 0 {
+		rc.mu.Lock()
+		if rc.attempts == nil {
+			rc.attempts = make(map[string]int)
+		}
+		rc.attempts[delivery]++
+		attempt := rc.attempts[delivery]
+		rc.mu.Unlock()
+		if attempt <= rc.Fail {
+			http.Error(w, "Failing on purpose", http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	var p Payload
+	if err := json.Unmarshal(body, &p); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if rc.Handle != nil {
+		rc.Handle(delivery, p)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
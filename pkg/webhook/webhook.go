@@ -0,0 +1,367 @@
+// Package webhook sends signed JSON notifications about a race to URLs that
+// clubs and others register, retrying failed deliveries with backoff.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/jimmitjoo/livestream-results/pkg/db"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Types of notifications
+const (
+	// Finish is sent when a runner's first read at the finish is stored
+	Finish = "finish"
+	// Split is sent when a runner's first read at a split antenna is stored
+	Split = "split"
+	// Status is sent when a race clock is started or stopped
+	Status = "status"
+	// Correction is sent when stored results change, e.g. a new start time
+	Correction = "correction"
+	// Test is only sent when asked for, to try a webhook
+	Test = "test"
+)
+
+// Types lists the types of notifications webhooks can ask for
+var Types = []string{Finish, Split, Status, Correction}
+
+// IsType reports whether t is one of Types
+func IsType(t string) bool {
+	for _, known := range Types {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Headers of a delivery
+const (
+	SignatureHeader = "X-Signature-256"
+	TypeHeader      = "X-Webhook-Type"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+const (
+	// requestTimeout limits how long a receiver may take to answer
+	requestTimeout = 10 * time.Second
+
+	// maxAttempts is how many times a delivery is tried before it has failed
+	maxAttempts = 8
+
+	// Backoff between attempts of a delivery, doubled after every failure
+	minBackoff = 2 * time.Second
+	maxBackoff = 5 * time.Minute
+
+	// idleCheck is how often the queue is checked when nothing is pending
+	idleCheck = time.Minute
+	batchSize = 20
+)
+
+// Event is something that happened in a race. EventID is the race or class it
+// happened in and Data is sent as is.
+type Event struct {
+	Type    string
+	EventID int
+	Data    interface{}
+}
+
+// Payload is the JSON body of a delivery
+type Payload struct {
+	Type    string          `json:"type"`
+	EventID int             `json:"eventID"`
+	RaceID  int             `json:"raceID"`
+	SentAt  string          `json:"sentAt"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// Sign returns the signature of body for secret as sent in SignatureHeader
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is the signature of body for secret
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// Dispatcher queues notifications for the webhooks that want them and delivers
+// them in the background. Deliveries are stored before they are sent, so
+// pending ones survive a restart.
+type Dispatcher struct {
+	database *sql.DB
+	client   *http.Client
+	wake     chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewDispatcher creates a Dispatcher and starts delivering, beginning with
+// deliveries left pending by the last run
+func NewDispatcher(database *sql.DB) *Dispatcher {
+	d := &Dispatcher{
+		database: database,
+		client:   &http.Client{Timeout: requestTimeout},
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go d.run()
+	return d
+}
+
+// Send queues events for every active webhook of their race that wants them
+func (d *Dispatcher) Send(events ...Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	webhooks, err := db.ListWebhooks(d.database)
+	if err != nil {
+		return err
+	}
+	if len(webhooks) == 0 {
+		return nil
+	}
+	races, err := raceIDs(d.database)
+	if err != nil {
+		return err
+	}
+
+	var deliveries []db.WebhookDelivery
+	for _, event := range events {
+		raceID := races[event.EventID]
+		body, err := encode(event, raceID)
+		if err != nil {
+			return err
+		}
+
+		for _, webhook := range webhooks {
+			if !webhook.Active || !webhook.Wants(event.Type) {
+				continue
+			}
+			if webhook.EventID != 0 && webhook.EventID != raceID && webhook.EventID != event.EventID {
+				continue
+			}
+			deliveries = append(deliveries, db.WebhookDelivery{WebhookID: webhook.WebhookID, Type: event.Type, Payload: body})
+		}
+	}
+
+	// One transaction for the whole batch, as every commit is synced to disk
+	if err := db.CreateWebhookDeliveries(d.database, deliveries); err != nil {
+		return err
+	}
+	if len(deliveries) > 0 {
+		d.Wake()
+	}
+	return nil
+}
+
+// SendTest queues a test notification for one webhook, whatever it wants, and
+// returns the ID of the delivery
+func (d *Dispatcher) SendTest(webhook db.Webhook) (int, error) {
+	body, err := encode(Event{Type: Test, EventID: webhook.EventID, Data: map[string]string{}}, webhook.EventID)
+	if err != nil {
+		return 0, err
+	}
+	deliveryID, err := db.CreateWebhookDelivery(d.database, webhook.WebhookID, Test, body)
+	if err != nil {
+		return 0, err
+	}
+	d.Wake()
+	return deliveryID, nil
+}
+
+// Wake makes the dispatcher look for due deliveries at once
+func (d *Dispatcher) Wake() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops delivering after the current attempt. Deliveries that are still
+// pending are sent after the next start.
+func (d *Dispatcher) Close() {
+	close(d.stop)
+	<-d.done
+}
+
+func (d *Dispatcher) run() {
+	defer close(d.done)
+
+	for {
+		d.deliverDue()
+
+		wait := idleCheck
+		if next, ok, err := db.NextWebhookAttempt(d.database); err != nil {
+			log.Printf("Error checking webhook queue: %v", err)
+		} else if ok {
+			// Due deliveries were just tried, so only an error leaves one due now
+			wait = time.Until(next)
+			if wait < time.Second {
+				wait = time.Second
+			}
+			if wait > idleCheck {
+				wait = idleCheck
+			}
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-d.wake:
+			timer.Stop()
+		case <-d.stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// deliverDue tries every delivery that is due, a batch at a time
+func (d *Dispatcher) deliverDue() {
+	for {
+		deliveries, err := db.DueWebhookDeliveries(d.database, time.Now(), batchSize)
+		if err != nil {
+			log.Printf("Error reading webhook queue: %v", err)
+			return
+		}
+		if len(deliveries) == 0 {
+			return
+		}
+
+		webhooks := make(map[int]db.Webhook)
+		for _, delivery := range deliveries {
+			select {
+			case <-d.stop:
+				return
+			default:
+			}
+
+			webhook, ok := webhooks[delivery.WebhookID]
+			if !ok {
+				if webhook, err = db.GetWebhook(d.database, delivery.WebhookID); err != nil {
+					log.Printf("Error reading webhook %d: %v", delivery.WebhookID, err)
+					webhook = db.Webhook{}
+				}
+				webhooks[delivery.WebhookID] = webhook
+			}
+			d.attempt(webhook, delivery)
+		}
+	}
+}
+
+// attempt sends a delivery once and records the outcome
+func (d *Dispatcher) attempt(webhook db.Webhook, delivery db.WebhookDelivery) {
+	delivery.Attempts++
+	delivery.ResponseStatus = 0
+	delivery.Error = ""
+
+	if webhook.URL == "" {
+		delivery.Status = db.DeliveryFailed
+		delivery.Error = "webhook no longer exists"
+	} else if status, err := d.post(webhook, delivery); err != nil {
+		delivery.ResponseStatus = status
+		delivery.Error = err.Error()
+		delivery.Status = db.DeliveryPending
+		if delivery.Attempts >= maxAttempts {
+			delivery.Status = db.DeliveryFailed
+		}
+		log.Printf("Error delivering %s notification %d to %s, attempt %d: %v", delivery.Type, delivery.DeliveryID, webhook.URL, delivery.Attempts, err)
+	} else {
+		delivery.ResponseStatus = status
+		delivery.Status = db.DeliveryDelivered
+	}
+
+	if err := db.RecordWebhookAttempt(d.database, delivery, time.Now().Add(backoff(delivery.Attempts))); err != nil {
+		log.Printf("Error recording webhook delivery %d: %v", delivery.DeliveryID, err)
+	}
+}
+
+// post sends the payload of a delivery and returns the response status
+func (d *Dispatcher) post(webhook db.Webhook, delivery db.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("error creating webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, body))
+	req.Header.Set(TypeHeader, delivery.Type)
+	req.Header.Set(DeliveryHeader, strconv.Itoa(delivery.DeliveryID))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("error posting webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook responded with status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// encode returns the payload of an event as JSON
+func encode(event Event, raceID int) (string, error) {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return "", fmt.Errorf("error encoding %s notification: %w", event.Type, err)
+	}
+	body, err := json.Marshal(Payload{
+		Type:    event.Type,
+		EventID: event.EventID,
+		RaceID:  raceID,
+		SentAt:  time.Now().Format(time.RFC3339Nano),
+		Data:    data,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error encoding %s notification: %w", event.Type, err)
+	}
+	return string(body), nil
+}
+
+// backoff is the wait before the attempt after attempts failed ones
+func backoff(attempts int) time.Duration {
+	wait := minBackoff
+	for i := 1; i < attempts; i++ {
+		wait *= 2
+		if wait >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return wait
+}
+
+// raceIDs maps every event to its race, which is itself for a race
+func raceIDs(database *sql.DB) (map[int]int, error) {
+	events, err := db.ListEvents(database)
+	if err != nil {
+		return nil, err
+	}
+	races := make(map[int]int, len(events))
+	for _, event := range events {
+		races[event.EventID] = event.EventID
+		if event.ParentEventID != 0 {
+			races[event.EventID] = event.ParentEventID
+		}
+	}
+	return races, nil
+}
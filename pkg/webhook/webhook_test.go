@@ -0,0 +1,256 @@
+package webhook
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/jimmitjoo/livestream-results/pkg/db"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func setupDatabase(t *testing.T) *sql.DB {
+	t.Helper()
+	database, err := db.SetupDatabase(filepath.Join(t.TempDir(), "race.db"))
+	if err != nil {
+		t.Fatalf("SetupDatabase: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database
+}
+
+// createRace creates a race with one class and returns their IDs
+func createRace(t *testing.T, database *sql.DB, name string) (raceID int, classID int) {
+	t.Helper()
+	raceID, err := db.InsertEvent(database, db.Event{EventName: name})
+	if err != nil {
+		t.Fatalf("InsertEvent: %v", err)
+	}
+	classID, err = db.InsertEvent(database, db.Event{EventName: name + " H21", ParentEventID: raceID, Classification: "H21"})
+	if err != nil {
+		t.Fatalf("InsertEvent: %v", err)
+	}
+	return raceID, classID
+}
+
+func createWebhook(t *testing.T, database *sql.DB, webhook db.Webhook) db.Webhook {
+	t.Helper()
+	webhook.Active = true
+	webhookID, err := db.CreateWebhook(database, webhook)
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+	webhook, err = db.GetWebhook(database, webhookID)
+	if err != nil {
+		t.Fatalf("GetWebhook: %v", err)
+	}
+	return webhook
+}
+
+func deliveries(t *testing.T, database *sql.DB, webhookID int) []db.WebhookDelivery {
+	t.Helper()
+	list, err := db.ListWebhookDeliveries(database, webhookID, 50)
+	if err != nil {
+		t.Fatalf("ListWebhookDeliveries: %v", err)
+	}
+	return list
+}
+
+func TestSign(t *testing.T) {
+	// The example of HMAC-SHA256 on Wikipedia
+	body := []byte("The quick brown fox jumps over the lazy dog")
+	want := "sha256=f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"
+	if got := Sign("key", body); got != want {
+		t.Errorf("Sign = %s, want %s", got, want)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"type":"finish"}`)
+	signature := Sign("secret", body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		body      []byte
+		signature string
+		want      bool
+	}{
+		{"valid", "secret", body, signature, true},
+		{"other secret", "other", body, signature, false},
+		{"changed body", "secret", []byte(`{"type":"split"}`), signature, false},
+		{"without prefix", "secret", body, strings.TrimPrefix(signature, "sha256="), false},
+		{"missing", "secret", body, "", false},
+	}
+	for _, test := range tests {
+		if got := Verify(test.secret, test.body, test.signature); got != test.want {
+			t.Errorf("%s: Verify = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestReceiverChecksSignature(t *testing.T) {
+	var received []Payload
+	receiver := &Receiver{Secret: "secret", Handle: func(delivery string, p Payload) {
+		received = append(received, p)
+	}}
+	body := `{"type":"finish","eventID":2,"raceID":1,"data":{}}`
+
+	post := func(signature string) int {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set(SignatureHeader, signature)
+		rec := httptest.NewRecorder()
+		receiver.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := post(Sign("wrong", []byte(body))); code != http.StatusUnauthorized {
+		t.Errorf("wrong signature answered %d, want 401", code)
+	}
+	if code := post(Sign("secret", []byte(body))); code != http.StatusNoContent {
+		t.Errorf("valid signature answered %d, want 204", code)
+	}
+	if len(received) != 1 || received[0].Type != Finish || received[0].RaceID != 1 {
+		t.Errorf("received %+v, want the finish", received)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, minBackoff},
+		{2, 2 * minBackoff},
+		{3, 4 * minBackoff},
+		{7, 64 * minBackoff},
+		{20, maxBackoff},
+	}
+	for _, test := range tests {
+		if got := backoff(test.attempts); got != test.want {
+			t.Errorf("backoff(%d) = %s, want %s", test.attempts, got, test.want)
+		}
+	}
+}
+
+func TestSendQueuesForMatchingWebhooks(t *testing.T) {
+	database := setupDatabase(t)
+	raceID, classID := createRace(t, database, "Mila")
+	otherRaceID, _ := createRace(t, database, "Halvmara")
+
+	all := createWebhook(t, database, db.Webhook{URL: "http://127.0.0.1:1/all", Secret: "s"})
+	race := createWebhook(t, database, db.Webhook{URL: "http://127.0.0.1:1/race", Secret: "s", EventID: raceID, Types: []string{Finish}})
+	other := createWebhook(t, database, db.Webhook{URL: "http://127.0.0.1:1/other", Secret: "s", EventID: otherRaceID})
+	splits := createWebhook(t, database, db.Webhook{URL: "http://127.0.0.1:1/splits", Secret: "s", Types: []string{Split}})
+
+	// Not started, so the queue is only written
+	d := &Dispatcher{database: database, wake: make(chan struct{}, 1)}
+	if err := d.Send(Event{Type: Finish, EventID: classID, Data: map[string]int{"bibNumber": 5}}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	for _, test := range []struct {
+		webhook db.Webhook
+		want    int
+	}{{all, 1}, {race, 1}, {other, 0}, {splits, 0}} {
+		if got := len(deliveries(t, database, test.webhook.WebhookID)); got != test.want {
+			t.Errorf("webhook %s has %d deliveries, want %d", test.webhook.URL, got, test.want)
+		}
+	}
+
+	delivery := deliveries(t, database, race.WebhookID)[0]
+	var p Payload
+	if err := json.Unmarshal([]byte(delivery.Payload), &p); err != nil {
+		t.Fatalf("payload %s: %v", delivery.Payload, err)
+	}
+	if delivery.Status != db.DeliveryPending || p.Type != Finish || p.EventID != classID || p.RaceID != raceID || string(p.Data) != `{"bibNumber":5}` {
+		t.Errorf("delivery = %+v with payload %+v", delivery, p)
+	}
+}
+
+func TestDispatcherRetriesWithBackoff(t *testing.T) {
+	database := setupDatabase(t)
+	raceID, classID := createRace(t, database, "Mila")
+
+	var mu sync.Mutex
+	var attempts []time.Time
+	received := make(chan Payload, 1)
+	receiver := &Receiver{Secret: "secret", Fail: 1, Handle: func(delivery string, p Payload) {
+		received <- p
+	}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts = append(attempts, time.Now())
+		mu.Unlock()
+		receiver.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	webhook := createWebhook(t, database, db.Webhook{URL: server.URL, Secret: "secret", EventID: raceID})
+
+	d := NewDispatcher(database)
+	defer d.Close()
+	if err := d.Send(Event{Type: Finish, EventID: classID, Data: map[string]int{"bibNumber": 5}}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	select {
+	case p := <-received:
+		if p.Type != Finish || p.RaceID != raceID {
+			t.Errorf("received %+v, want the finish", p)
+		}
+	case <-time.After(3 * minBackoff):
+		t.Fatal("the delivery was not retried")
+	}
+
+	mu.Lock()
+	if len(attempts) != 2 || attempts[1].Sub(attempts[0]) < minBackoff-100*time.Millisecond {
+		t.Errorf("attempts at %v, want 2 with %s in between", attempts, minBackoff)
+	}
+	mu.Unlock()
+
+	// The log is written after the receiver answered
+	var log []db.WebhookDelivery
+	deadline := time.Now().Add(time.Second)
+	for {
+		log = deliveries(t, database, webhook.WebhookID)
+		if len(log) == 1 && log[0].Status == db.DeliveryDelivered || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(log) != 1 {
+		t.Fatalf("%d deliveries logged, want 1", len(log))
+	}
+	if delivery := log[0]; delivery.Status != db.DeliveryDelivered || delivery.Attempts != 2 || delivery.ResponseStatus != http.StatusNoContent || delivery.Error != "" || delivery.DeliveredAt == "" {
+		t.Errorf("delivery = %+v, want delivered at the second attempt", delivery)
+	}
+}
+
+func TestAttemptGivesUpAfterMaxAttempts(t *testing.T) {
+	database := setupDatabase(t)
+	server := httptest.NewServer(&Receiver{Secret: "other"})
+	defer server.Close()
+	webhook := createWebhook(t, database, db.Webhook{URL: server.URL, Secret: "secret"})
+
+	d := &Dispatcher{database: database, client: http.DefaultClient}
+	if _, err := db.CreateWebhookDelivery(database, webhook.WebhookID, Test, `{"type":"test"}`); err != nil {
+		t.Fatalf("CreateWebhookDelivery: %v", err)
+	}
+
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		delivery := deliveries(t, database, webhook.WebhookID)[0]
+		if delivery.Status != db.DeliveryPending {
+			t.Fatalf("delivery is %s before attempt %d", delivery.Status, attempt)
+		}
+		d.attempt(webhook, delivery)
+	}
+
+	delivery := deliveries(t, database, webhook.WebhookID)[0]
+	if delivery.Status != db.DeliveryFailed || delivery.Attempts != maxAttempts || delivery.ResponseStatus != http.StatusUnauthorized || !strings.Contains(delivery.Error, "401") {
+		t.Errorf("delivery = %+v, want failed after %d attempts", delivery, maxAttempts)
+	}
+}